@@ -25,6 +25,20 @@ DROP TABLE IF EXISTS `psjudge_builder`.`assignment` ;
 CREATE TABLE IF NOT EXISTS `psjudge_builder`.`assignment` (
   `id` INT NOT NULL AUTO_INCREMENT,
   `key` VARCHAR(32) NULL,
+  `time_limit_ms` INT NOT NULL DEFAULT 2000,
+  `memory_limit_mb` INT NOT NULL DEFAULT 256,
+  `output_limit_kb` INT NOT NULL DEFAULT 16384,
+  `stack_size_mb` INT NOT NULL DEFAULT 64,
+  `checker` ENUM('exact', 'trailing_whitespace', 'tokens', 'case_insensitive', 'float', 'custom', 'interactor') NOT NULL DEFAULT 'exact',
+  `checker_abs_epsilon` DOUBLE NOT NULL DEFAULT 0,
+  `checker_rel_epsilon` DOUBLE NOT NULL DEFAULT 0,
+  `checker_source` MEDIUMTEXT NULL,
+  `checker_language` VARCHAR(32) NOT NULL DEFAULT '',
+  `checker_revision` INT NOT NULL DEFAULT 0,
+  `testset_revision` INT NOT NULL DEFAULT 0,
+  `io_mode` ENUM('stdio', 'file') NOT NULL DEFAULT 'stdio',
+  `input_file` VARCHAR(64) NOT NULL DEFAULT 'input.txt',
+  `output_file` VARCHAR(64) NOT NULL DEFAULT 'output.txt',
   PRIMARY KEY (`id`),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC),
   UNIQUE INDEX `key_UNIQUE` (`key` ASC))
@@ -40,11 +54,24 @@ CREATE TABLE IF NOT EXISTS `psjudge_builder`.`build` (
   `id` INT NOT NULL AUTO_INCREMENT,
   `assignment_id` INT NULL,
   `key` VARCHAR(32) NULL,
-  `status` ENUM('pending', 'building', 'failed', 'succeed', 'exception') NULL,
-  `language` ENUM('c++', 'pascal') NULL,
+  `status` ENUM('pending', 'building', 'failed', 'succeed', 'exception', 'compilation_timeout') NULL,
+  `language` VARCHAR(32) NULL,
   `source` MEDIUMTEXT NULL,
+  `source_hash` VARCHAR(64) NOT NULL DEFAULT '',
+  `claim_token` VARCHAR(32) NULL,
+  `builder_node` VARCHAR(64) NULL,
+  `builder_worker` INT NULL,
+  `claimed_at` DATETIME NULL,
+  `lease_expires_at` DATETIME NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `priority` INT NOT NULL DEFAULT 1,
+  `mode` ENUM('full', 'stop_on_first_failure', 'samples_only') NOT NULL DEFAULT 'full',
+  `submitted_at` DATETIME NULL,
+  `testset_revision` INT NULL,
   PRIMARY KEY (`id`),
   UNIQUE INDEX `key_UNIQUE` (`key` ASC),
+  INDEX `status_priority_idx` (`status` ASC, `priority` ASC, `submitted_at` ASC),
+  UNIQUE INDEX `claim_token_UNIQUE` (`claim_token` ASC),
   INDEX `fk_assignment_id_idx` (`assignment_id` ASC),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC),
   CONSTRAINT `fk_assignment_id`
@@ -64,11 +91,20 @@ CREATE TABLE IF NOT EXISTS `psjudge_builder`.`testcase` (
   `id` INT NOT NULL AUTO_INCREMENT,
   `assignment_id` INT NULL,
   `key` VARCHAR(32) NULL,
+  `test_index` INT NOT NULL DEFAULT 0,
+  `group_name` VARCHAR(64) NOT NULL DEFAULT '',
+  `weight` INT NOT NULL DEFAULT 1,
+  `sample` TINYINT(1) NOT NULL DEFAULT 0,
   `input` MEDIUMTEXT NULL,
   `expected` MEDIUMTEXT NULL,
+  `input_hash` VARCHAR(64) NOT NULL DEFAULT '',
+  `expected_hash` VARCHAR(64) NOT NULL DEFAULT '',
+  `revision_added` INT NOT NULL DEFAULT 1,
+  `revision_removed` INT NULL,
   PRIMARY KEY (`id`),
   INDEX `fk_assignment_id_idx` (`assignment_id` ASC),
-  UNIQUE INDEX `key_UNIQUE` (`key` ASC),
+  UNIQUE INDEX `key_revision_UNIQUE` (`key` ASC, `revision_added` ASC),
+  INDEX `assignment_revision_idx` (`assignment_id` ASC, `revision_added` ASC),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC),
   CONSTRAINT `fk_testcase_assignment_id`
     FOREIGN KEY (`assignment_id`)
@@ -86,14 +122,22 @@ DROP TABLE IF EXISTS `psjudge_builder`.`report` ;
 CREATE TABLE IF NOT EXISTS `psjudge_builder`.`report` (
   `id` INT NOT NULL AUTO_INCREMENT,
   `build_id` INT NOT NULL,
+  `version` INT NOT NULL DEFAULT 1,
+  `status` ENUM('failed', 'succeed', 'exception', 'compilation_timeout') NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `builder_node` VARCHAR(64) NOT NULL DEFAULT '',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `testset_revision` INT NOT NULL DEFAULT 0,
+  `checker_revision` INT NOT NULL DEFAULT 0,
   `tests_passed` INT NOT NULL,
   `tests_total` INT NOT NULL,
-  `exception` TINYTEXT NOT NULL,
+  `exception` TEXT NOT NULL,
   `build_log` MEDIUMTEXT NOT NULL,
   `tests_log` MEDIUMTEXT NOT NULL,
   PRIMARY KEY (`id`),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC),
   INDEX `fk_build_id_idx` (`build_id` ASC),
+  UNIQUE INDEX `build_version_UNIQUE` (`build_id` ASC, `version` ASC),
   CONSTRAINT `fk_build_id`
     FOREIGN KEY (`build_id`)
     REFERENCES `psjudge_builder`.`build` (`id`)
@@ -102,6 +146,113 @@ CREATE TABLE IF NOT EXISTS `psjudge_builder`.`report` (
 ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `psjudge_builder`.`test_result`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `psjudge_builder`.`test_result` ;
+
+CREATE TABLE IF NOT EXISTS `psjudge_builder`.`test_result` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `report_id` INT NOT NULL,
+  `test_index` INT NOT NULL,
+  `verdict` ENUM('AC', 'WA', 'TLE', 'WTLE', 'MLE', 'RE', 'OLE', 'NOF') NOT NULL,
+  `limit_exceeded` ENUM('', 'cpu', 'wall', 'memory', 'output') NOT NULL DEFAULT '',
+  `wall_time_ms` INT NOT NULL,
+  `cpu_time_ms` INT NOT NULL,
+  `memory_kb` INT NOT NULL,
+  `exit_code` INT NOT NULL,
+  `signal` INT NOT NULL,
+  `stdout` TEXT NOT NULL,
+  `stderr` TEXT NOT NULL,
+  `message` TEXT NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `id_UNIQUE` (`id` ASC),
+  INDEX `fk_report_id_idx` (`report_id` ASC),
+  CONSTRAINT `fk_report_id`
+    FOREIGN KEY (`report_id`)
+    REFERENCES `psjudge_builder`.`report` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `psjudge_builder`.`test_group`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `psjudge_builder`.`test_group` ;
+
+CREATE TABLE IF NOT EXISTS `psjudge_builder`.`test_group` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `assignment_id` INT NOT NULL,
+  `group_index` INT NOT NULL,
+  `name` VARCHAR(64) NOT NULL,
+  `points` INT NOT NULL,
+  `scoring` ENUM('all', 'sum') NOT NULL DEFAULT 'all',
+  `dependencies` VARCHAR(1024) NOT NULL DEFAULT '',
+  `revision_added` INT NOT NULL,
+  `revision_removed` INT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `id_UNIQUE` (`id` ASC),
+  INDEX `assignment_revision_idx` (`assignment_id` ASC, `revision_added` ASC),
+  CONSTRAINT `fk_test_group_assignment_id`
+    FOREIGN KEY (`assignment_id`)
+    REFERENCES `psjudge_builder`.`assignment` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `psjudge_builder`.`group_result`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `psjudge_builder`.`group_result` ;
+
+CREATE TABLE IF NOT EXISTS `psjudge_builder`.`group_result` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `report_id` INT NOT NULL,
+  `group_index` INT NOT NULL,
+  `name` VARCHAR(64) NOT NULL,
+  `points` INT NOT NULL,
+  `score` DOUBLE NOT NULL,
+  `tests_passed` INT NOT NULL,
+  `tests_total` INT NOT NULL,
+  `passed` TINYINT(1) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `id_UNIQUE` (`id` ASC),
+  INDEX `fk_group_result_report_id_idx` (`report_id` ASC),
+  CONSTRAINT `fk_group_result_report_id`
+    FOREIGN KEY (`report_id`)
+    REFERENCES `psjudge_builder`.`report` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `psjudge_builder`.`diagnostic`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `psjudge_builder`.`diagnostic` ;
+
+CREATE TABLE IF NOT EXISTS `psjudge_builder`.`diagnostic` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `report_id` INT NOT NULL,
+  `diagnostic_index` INT NOT NULL,
+  `file` VARCHAR(255) NOT NULL,
+  `line` INT NOT NULL,
+  `column` INT NOT NULL DEFAULT 0,
+  `severity` ENUM('error', 'warning', 'note') NOT NULL,
+  `message` TEXT NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `id_UNIQUE` (`id` ASC),
+  INDEX `fk_diagnostic_report_id_idx` (`report_id` ASC),
+  CONSTRAINT `fk_diagnostic_report_id`
+    FOREIGN KEY (`report_id`)
+    REFERENCES `psjudge_builder`.`report` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
 SET SQL_MODE=@OLD_SQL_MODE;
 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type apiContext struct {
@@ -204,11 +205,13 @@ func getContestResults(ctx interface{}, req restapi.Request) restapi.Response {
 }
 
 // CommitSolutionParams - parameters to commit solution
+// Mode - one of "full" (default), "stop_on_first_failure", "samples_only"
 type CommitSolutionParams struct {
 	UUID         string `json:"uuid"`
 	AssignmentID int64  `json:"assignment_id"`
 	Language     string `json:"language"`
 	Source       string `json:"source"`
+	Mode         string `json:"mode"`
 }
 
 func commitSolution(ctx interface{}, req restapi.Request) restapi.Response {
@@ -222,6 +225,14 @@ func commitSolution(ctx interface{}, req restapi.Request) restapi.Response {
 	if err != nil {
 		return &restapi.BadRequest{errors.Wrap(err, "invalid JSON")}
 	}
+	mode := params.Mode
+	switch mode {
+	case "":
+		mode = JudgingModeFull
+	case JudgingModeFull, JudgingModeStopOnFirstFailure, JudgingModeSamplesOnly:
+	default:
+		return &restapi.BadRequest{errors.New("unknown judging mode '" + mode + "'")}
+	}
 
 	c := ctx.(*apiContext)
 	defer c.Close()
@@ -247,12 +258,22 @@ func commitSolution(ctx interface{}, req restapi.Request) restapi.Response {
 		return &restapi.InternalError{err}
 	}
 
-	err = repository.createCommit(solution.ID, params.UUID)
+	// Solutions sent during the contest are judged before practice ones.
+	priority := BuildPriorityPractice
+	active, err := repository.hasActiveAppointment(userID, assignment.ContestID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	if active {
+		priority = BuildPriorityContest
+	}
+
+	err = repository.createCommit(solution.ID, params.UUID, mode)
 	if err != nil {
 		return &restapi.InternalError{err}
 	}
 
-	response, err := c.BuilderAPI().RegisterNewBuild(params.UUID, assignment.UUID, params.Language, params.Source)
+	response, err := c.BuilderAPI().RegisterNewBuild(params.UUID, assignment.UUID, params.Language, params.Source, priority, mode)
 	if err != nil {
 		return &restapi.InternalError{err}
 	}
@@ -260,6 +281,104 @@ func commitSolution(ctx interface{}, req restapi.Request) restapi.Response {
 	return &restapi.Ok{response}
 }
 
+func rejudgeAssignment(ctx interface{}, req restapi.Request) restapi.Response {
+	assignmentID, err := parseID(req, "id")
+	if err != nil {
+		return &restapi.BadRequest{errors.Wrap(err, "invalid id")}
+	}
+
+	c := ctx.(*apiContext)
+	defer c.Close()
+	repository, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	assignment, err := repository.getAssignment(assignmentID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	if assignment == nil {
+		return &restapi.BadRequest{errors.New("no assignment with given ID")}
+	}
+
+	rejudged, err := rejudgeAssignmentCommits(c, repository, *assignment)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	return &restapi.Ok{&valuesMap{
+		"rejudged": rejudged,
+	}}
+}
+
+func rejudgeContest(ctx interface{}, req restapi.Request) restapi.Response {
+	contestID, err := parseID(req, "id")
+	if err != nil {
+		return &restapi.BadRequest{errors.Wrap(err, "invalid id")}
+	}
+
+	c := ctx.(*apiContext)
+	defer c.Close()
+	repository, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	assignments, err := repository.getContestAssignments(contestID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	// Each assignment is rejudged separately, so failed assignment doesn't stop rejudge of the others,
+	// response lists both rejudged and failed assignments.
+	var total int64
+	rejudgedAssignments := []int64{}
+	failedAssignments := valuesMapList{}
+	for _, assignment := range assignments {
+		rejudged, err := rejudgeAssignmentCommits(c, repository, assignment)
+		if err != nil {
+			logrus.WithField("assignment", assignment.ID).WithField("error", err).Error("cannot rejudge assignment")
+			failedAssignments = append(failedAssignments, valuesMap{
+				"id":    assignment.ID,
+				"error": err.Error(),
+			})
+			continue
+		}
+		total += rejudged
+		rejudgedAssignments = append(rejudgedAssignments, assignment.ID)
+	}
+	if len(rejudgedAssignments) == 0 && len(failedAssignments) != 0 {
+		return &restapi.InternalError{errors.New("cannot rejudge contest assignments: " + failedAssignments[0]["error"].(string))}
+	}
+
+	return &restapi.Ok{&valuesMap{
+		"rejudged":             total,
+		"rejudged_assignments": rejudgedAssignments,
+		"failed_assignments":   failedAssignments,
+	}}
+}
+
+// rejudgeAssignmentCommits - marks assignment commits as pending and rejudges their builds,
+// commits get their status back if builder failed to rejudge. Reset is saved before builder request,
+// so commits are not locked while builder rejudges. Solution scores are recomputed by build listener
+// when builds finish.
+func rejudgeAssignmentCommits(c *apiContext, repository *BackendRepository, assignment AssignmentInfoModel) (int64, error) {
+	commits, err := repository.resetAssignmentCommits(assignment.ID)
+	if err != nil {
+		return 0, err
+	}
+	response, err := c.BuilderAPI().RejudgeAssignment(assignment.UUID)
+	if err != nil {
+		restoreErr := repository.restoreCommits(commits)
+		if restoreErr != nil {
+			logrus.WithField("assignment", assignment.ID).WithField("error", restoreErr).Error("cannot restore commits after failed rejudge")
+		}
+		return 0, errors.Wrap(err, "cannot rejudge assignment "+assignment.UUID)
+	}
+	return response.Rejudged, nil
+}
+
 func getCommitReport(ctx interface{}, req restapi.Request) restapi.Response {
 	commitID, err := parseID(req, "id")
 	if err != nil {
@@ -286,6 +405,42 @@ func getCommitReport(ctx interface{}, req restapi.Request) restapi.Response {
 	return &restapi.Ok{response}
 }
 
+func getCommitReports(ctx interface{}, req restapi.Request) restapi.Response {
+	commitID, err := parseID(req, "id")
+	if err != nil {
+		return &restapi.BadRequest{errors.Wrap(err, "invalid id")}
+	}
+
+	c := ctx.(*apiContext)
+	defer c.Close()
+	repository, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	commitUUID, err := repository.getCommitUUID(commitID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	response, err := c.BuilderAPI().GetBuildReports(commitUUID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	return &restapi.Ok{response}
+}
+
+func getLanguages(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	response, err := c.BuilderAPI().GetLanguages()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	return &restapi.Ok{response}
+}
+
 func getContestAssignments(ctx interface{}, req restapi.Request) restapi.Response {
 	contestID, err := parseID(req, "id")
 	if err != nil {
@@ -413,11 +568,26 @@ func createUser(ctx interface{}, req restapi.Request) restapi.Response {
 }
 
 // CreateAssignmentParams - parameters for the new contest assignment
+// Resource limits are optional, zero value means builder default.
+// Checker is optional, output compared byte-for-byte by default.
+// IOMode is optional, solution reads stdin and writes stdout by default.
 type CreateAssignmentParams struct {
-	UUID        string `json:"uuid"`
-	ContestID   int64  `json:"contest_id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	UUID              string  `json:"uuid"`
+	ContestID         int64   `json:"contest_id"`
+	Title             string  `json:"title"`
+	Description       string  `json:"description"`
+	TimeLimitMs       int     `json:"time_limit_ms"`
+	MemoryLimitMB     int     `json:"memory_limit_mb"`
+	OutputLimitKB     int     `json:"output_limit_kb"`
+	StackSizeMB       int     `json:"stack_size_mb"`
+	Checker           string  `json:"checker"`
+	CheckerAbsEpsilon float64 `json:"checker_abs_epsilon"`
+	CheckerRelEpsilon float64 `json:"checker_rel_epsilon"`
+	CheckerSource     string  `json:"checker_source"`
+	CheckerLanguage   string  `json:"checker_language"`
+	IOMode            string  `json:"io_mode"`
+	InputFile         string  `json:"input_file"`
+	OutputFile        string  `json:"output_file"`
 }
 
 func createAssignment(ctx interface{}, req restapi.Request) restapi.Response {
@@ -440,6 +610,30 @@ func createAssignment(ctx interface{}, req restapi.Request) restapi.Response {
 		Title:       params.Title,
 		Description: params.Description,
 	}
+
+	// Builder rejects invalid settings, so assignment is saved only after builder accepted it
+	limits := AssignmentLimits{
+		TimeLimitMs:   params.TimeLimitMs,
+		MemoryLimitMB: params.MemoryLimitMB,
+		OutputLimitKB: params.OutputLimitKB,
+		StackSizeMB:   params.StackSizeMB,
+	}
+	checker := AssignmentChecker{
+		Kind:       params.Checker,
+		AbsEpsilon: params.CheckerAbsEpsilon,
+		RelEpsilon: params.CheckerRelEpsilon,
+		Source:     params.CheckerSource,
+		Language:   params.CheckerLanguage,
+	}
+	assignmentIO := AssignmentIO{
+		Mode:       params.IOMode,
+		InputFile:  params.InputFile,
+		OutputFile: params.OutputFile,
+	}
+	_, err = c.builderService.RegisterAssignment(model.UUID, limits, checker, assignmentIO)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
 	err = repository.createAssignment(&model)
 	if err != nil {
 		return &restapi.InternalError{err}
@@ -455,6 +649,9 @@ type CreateTestCaseParams struct {
 	AssignmentID int64  `json:"assignment_id"`
 	Input        string `json:"input"`
 	Expected     string `json:"expected"`
+	Group        string `json:"group"`
+	Weight       int    `json:"weight"`
+	Sample       bool   `json:"sample"`
 }
 
 func createTestCase(ctx interface{}, req restapi.Request) restapi.Response {
@@ -477,7 +674,13 @@ func createTestCase(ctx interface{}, req restapi.Request) restapi.Response {
 		return &restapi.InternalError{err}
 	}
 
-	_, err = c.builderService.RegisterTestCase(params.UUID, assignment.UUID, params.Input, params.Expected)
+	_, err = c.builderService.RegisterTestCase(params.UUID, assignment.UUID, TestCaseParams{
+		Input:    params.Input,
+		Expected: params.Expected,
+		Group:    params.Group,
+		Weight:   params.Weight,
+		Sample:   params.Sample,
+	})
 	if err != nil {
 		return &restapi.InternalError{err}
 	}
@@ -485,6 +688,111 @@ func createTestCase(ctx interface{}, req restapi.Request) restapi.Response {
 	return &restapi.Ok{nil}
 }
 
+func updateTestCase(ctx interface{}, req restapi.Request) restapi.Response {
+	testUUID := req.Var("uuid")
+	var params TestCaseParams
+	err := req.ReadJSON(&params)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+
+	c := ctx.(*apiContext)
+	response, err := c.BuilderAPI().UpdateTestCase(testUUID, params)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	return &restapi.Ok{response}
+}
+
+func deleteTestCase(ctx interface{}, req restapi.Request) restapi.Response {
+	testUUID := req.Var("uuid")
+
+	c := ctx.(*apiContext)
+	response, err := c.BuilderAPI().DeleteTestCase(testUUID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	return &restapi.Ok{response}
+}
+
+// SetTestGroupsParams - all test groups of the assignment in order
+type SetTestGroupsParams struct {
+	Groups []TestGroup `json:"groups"`
+}
+
+func setTestGroups(ctx interface{}, req restapi.Request) restapi.Response {
+	assignmentID, err := parseID(req, "id")
+	if err != nil {
+		return &restapi.BadRequest{errors.Wrap(err, "invalid id")}
+	}
+	var params SetTestGroupsParams
+	err = req.ReadJSON(&params)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+
+	c := ctx.(*apiContext)
+	defer c.Close()
+	repo, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	assignment, err := repo.getAssignment(assignmentID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	if assignment == nil {
+		return &restapi.BadRequest{errors.New("no assignment with given ID")}
+	}
+
+	response, err := c.BuilderAPI().SetTestGroups(assignment.UUID, params.Groups)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	return &restapi.Ok{response}
+}
+
+// MaxTestArchiveSize - max size of uploaded ZIP archive with assignment tests
+const MaxTestArchiveSize = 64 * 1024 * 1024
+
+// importTestSet - replaces assignment tests with tests from ZIP archive sent as request body
+func importTestSet(ctx interface{}, req restapi.Request) restapi.Response {
+	assignmentID, err := parseID(req, "id")
+	if err != nil {
+		return &restapi.BadRequest{errors.Wrap(err, "invalid id")}
+	}
+	archive, err := req.ReadBody(MaxTestArchiveSize)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+
+	c := ctx.(*apiContext)
+	defer c.Close()
+	repo, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	assignment, err := repo.getAssignment(assignmentID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	if assignment == nil {
+		return &restapi.BadRequest{errors.New("no assignment with given ID")}
+	}
+
+	response, err := c.BuilderAPI().ImportTestSet(assignment.UUID, archive)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	return &restapi.Ok{response}
+}
+
 // CreateAppointmentParams - parameters for the new contest assignment
 type CreateAppointmentParams struct {
 	GroupID   int64 `json:"group_id"`
@@ -10,31 +10,182 @@ const (
 	DefaultScheme = "http://"
 )
 
+// Build priorities, builder dispatches contest builds first and rejudges last
+const (
+	BuildPriorityContest  = "contest"
+	BuildPriorityPractice = "practice"
+	BuildPriorityRejudge  = "rejudge"
+)
+
+// Judging modes, "samples_only" builds run sample tests only and do not change solution score
+const (
+	JudgingModeFull               = "full"
+	JudgingModeStopOnFirstFailure = "stop_on_first_failure"
+	JudgingModeSamplesOnly        = "samples_only"
+)
+
 // BuilderService - accessor to the builder service REST API
 type BuilderService interface {
-	RegisterNewBuild(buildUUID string, assignmentUUID string, language string, source string) (*RegisterResponse, error)
-	RegisterTestCase(testUUID string, assignmentUUID string, input string, expected string) (*RegisterResponse, error)
+	RegisterNewBuild(buildUUID string, assignmentUUID string, language string, source string, priority string, mode string) (*RegisterResponse, error)
+	RegisterAssignment(assignmentUUID string, limits AssignmentLimits, checker AssignmentChecker, assignmentIO AssignmentIO) (*RegisterResponse, error)
+	RegisterTestCase(testUUID string, assignmentUUID string, test TestCaseParams) (*RegisterResponse, error)
+	UpdateTestCase(testUUID string, test TestCaseParams) (*TestSetChangeResponse, error)
+	DeleteTestCase(testUUID string) (*TestSetChangeResponse, error)
+	SetTestGroups(assignmentUUID string, groups []TestGroup) (*TestSetChangeResponse, error)
+	ImportTestSet(assignmentUUID string, archive []byte) (*TestSetImportResponse, error)
 	GetBuildReport(buildUUID string) (*BuildReportResponse, error)
+	GetBuildReports(buildUUID string) ([]BuildReportResponse, error)
+	GetLanguages() ([]LanguageResponse, error)
+	RejudgeAssignment(assignmentUUID string) (*RejudgeResponse, error)
 }
 
 type builderServiceImpl struct {
 	client *restapi.Client
 }
 
+// AssignmentLimits - resource limits for the assignment solutions
+// Zero limit value means builder default.
+type AssignmentLimits struct {
+	TimeLimitMs   int `json:"time_limit_ms"`
+	MemoryLimitMB int `json:"memory_limit_mb"`
+	OutputLimitKB int `json:"output_limit_kb"`
+	StackSizeMB   int `json:"stack_size_mb"`
+}
+
+// AssignmentChecker - checker which compares solution output with expected answer
+// Kind - one of "exact" (default), "trailing_whitespace", "tokens", "case_insensitive", "float", "custom", "interactor"
+// Source - source code of testlib-compatible checker or interactor, required for "custom" and "interactor" checkers
+type AssignmentChecker struct {
+	Kind       string
+	AbsEpsilon float64
+	RelEpsilon float64
+	Source     string
+	Language   string
+}
+
+// AssignmentIO - how solutions read input and write output
+// Mode - either "stdio" (default) or "file"; in "file" mode solution reads InputFile and writes OutputFile,
+// empty file names mean builder defaults "input.txt" and "output.txt"
+type AssignmentIO struct {
+	Mode       string
+	InputFile  string
+	OutputFile string
+}
+
+// TestCaseParams - test case input, expected answer, group, weight and sample flag
+// Group - name of the test group, Weight - weight of the test inside "sum" scoring group, 1 if zero
+// Sample - test is shown to students as an example and runs in "samples_only" mode
+type TestCaseParams struct {
+	Input    string `json:"input"`
+	Expected string `json:"expected"`
+	Group    string `json:"group"`
+	Weight   int    `json:"weight"`
+	Sample   bool   `json:"sample"`
+}
+
+// TestGroup - test group with points, like olympiad subtask
+// Scoring - "all" (default) gives points only if all group tests passed, "sum" gives points for passed tests weight
+// Dependencies - names of groups listed earlier, group gives no points unless all of them passed
+type TestGroup struct {
+	Name         string   `json:"name"`
+	Points       int      `json:"points"`
+	Scoring      string   `json:"scoring"`
+	Dependencies []string `json:"dependencies"`
+}
+
+// LanguageResponse - contains information about language enabled on builder
+type LanguageResponse struct {
+	ID               string  `json:"id"`
+	Title            string  `json:"title"`
+	TimeMultiplier   float64 `json:"time_multiplier"`
+	MemoryMultiplier float64 `json:"memory_multiplier"`
+}
+
 // RegisterResponse - contains UUID of registered object.
 type RegisterResponse struct {
 	UUID string `json:"uuid"`
 }
 
+// TestSetChangeResponse - contains test set revision created by the test case or test groups change
+type TestSetChangeResponse struct {
+	UUID            string `json:"uuid"`
+	TestSetRevision int    `json:"testset_revision"`
+}
+
+// TestSetImportResponse - contains test set revision created by the archive import
+// LimitsUpdated, CheckerUpdated - archive had limits or checker and they replaced assignment settings
+type TestSetImportResponse struct {
+	UUID            string `json:"uuid"`
+	TestSetRevision int    `json:"testset_revision"`
+	Tests           int    `json:"tests"`
+	Groups          int    `json:"groups"`
+	LimitsUpdated   bool   `json:"limits_updated"`
+	CheckerUpdated  bool   `json:"checker_updated"`
+}
+
+// RejudgeResponse - contains number of builds returned to queue
+type RejudgeResponse struct {
+	Rejudged int64 `json:"rejudged"`
+}
+
 // BuildReportResponse - contains detailed report about finished build
+// Version - number of the report in build history, each rejudge adds new version
+// TestSetRevision, CheckerRevision - revisions of the assignment test set and checker used for the build
+// Mode - judging mode of the build
 type BuildReportResponse struct {
-	UUID        string `json:"uuid"`
-	Status      string `json:"status"`
-	Exception   string `json:"exception"`
-	BuildLog    string `json:"build_log"`
-	TestsLog    string `json:"tests_log"`
-	TestsPassed int64  `json:"tests_passed"`
-	TestsTotal  int64  `json:"tests_total"`
+	UUID            string                `json:"uuid"`
+	Status          string                `json:"status"`
+	Exception       string                `json:"exception"`
+	BuildLog        string                `json:"build_log"`
+	TestsLog        string                `json:"tests_log"`
+	TestsPassed     int64                 `json:"tests_passed"`
+	TestsTotal      int64                 `json:"tests_total"`
+	Attempts        int                   `json:"attempts"`
+	Version         int                   `json:"version"`
+	CreatedAt       int64                 `json:"created_at"`
+	BuilderNode     string                `json:"builder_node"`
+	TestSetRevision int                   `json:"testset_revision"`
+	CheckerRevision int                   `json:"checker_revision"`
+	Mode            string                `json:"mode"`
+	Groups          []GroupResultResponse `json:"groups"`
+	Tests           []TestResultResponse  `json:"tests"`
+	Diagnostics     []DiagnosticResponse  `json:"diagnostics"`
+}
+
+// DiagnosticResponse - contains compiler message about the source line
+// Severity - one of "error", "warning", "note"
+type DiagnosticResponse struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// GroupResultResponse - contains result of the test group
+type GroupResultResponse struct {
+	Name        string  `json:"name"`
+	Points      int     `json:"points"`
+	Score       float64 `json:"score"`
+	TestsPassed int     `json:"tests_passed"`
+	TestsTotal  int     `json:"tests_total"`
+	Passed      bool    `json:"passed"`
+}
+
+// TestResultResponse - contains result of the single test case run
+// Verdict - one of "AC", "WA", "TLE", "WTLE", "MLE", "RE", "OLE", "NOF"
+// LimitExceeded - either empty or one of "cpu", "wall", "memory", "output"
+type TestResultResponse struct {
+	Verdict       string `json:"verdict"`
+	LimitExceeded string `json:"limit_exceeded"`
+	WallTimeMs    int64  `json:"wall_time_ms"`
+	CPUTimeMs     int64  `json:"cpu_time_ms"`
+	MemoryKB      int64  `json:"memory_kb"`
+	ExitCode      int    `json:"exit_code"`
+	Signal        int    `json:"signal"`
+	Stdout        string `json:"stdout"`
+	Stderr        string `json:"stderr"`
+	Message       string `json:"message"`
 }
 
 // NewBuilderService - creates new builder service accessor
@@ -44,13 +195,15 @@ func NewBuilderService(builderURL string) BuilderService {
 	return bs
 }
 
-// RegisterNewBuild - registers new solution build
-func (bs *builderServiceImpl) RegisterNewBuild(buildUUID string, assignmentUUID string, language string, source string) (*RegisterResponse, error) {
+// RegisterNewBuild - registers new solution build with one of build priorities and judging modes
+func (bs *builderServiceImpl) RegisterNewBuild(buildUUID string, assignmentUUID string, language string, source string, priority string, mode string) (*RegisterResponse, error) {
 	params := map[string]string{
 		"uuid":            buildUUID,
 		"assignment_uuid": assignmentUUID,
 		"language":        language,
 		"source":          source,
+		"priority":        priority,
+		"mode":            mode,
 	}
 	var result RegisterResponse
 	err := bs.client.Post("build/new", params, &result)
@@ -60,13 +213,41 @@ func (bs *builderServiceImpl) RegisterNewBuild(buildUUID string, assignmentUUID
 	return &result, nil
 }
 
+// RegisterAssignment - registers assignment with resource limits, checker and I/O mode for its solutions
+func (bs *builderServiceImpl) RegisterAssignment(assignmentUUID string, limits AssignmentLimits, checker AssignmentChecker, assignmentIO AssignmentIO) (*RegisterResponse, error) {
+	params := map[string]interface{}{
+		"uuid":                assignmentUUID,
+		"time_limit_ms":       limits.TimeLimitMs,
+		"memory_limit_mb":     limits.MemoryLimitMB,
+		"output_limit_kb":     limits.OutputLimitKB,
+		"stack_size_mb":       limits.StackSizeMB,
+		"checker":             checker.Kind,
+		"checker_abs_epsilon": checker.AbsEpsilon,
+		"checker_rel_epsilon": checker.RelEpsilon,
+		"checker_source":      checker.Source,
+		"checker_language":    checker.Language,
+		"io_mode":             assignmentIO.Mode,
+		"input_file":          assignmentIO.InputFile,
+		"output_file":         assignmentIO.OutputFile,
+	}
+	var result RegisterResponse
+	err := bs.client.Post("assignment/new", params, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // RegisterTestCase - registers new test case for assignment solutions.
-func (bs *builderServiceImpl) RegisterTestCase(testUUID string, assignmentUUID string, input string, expected string) (*RegisterResponse, error) {
-	params := map[string]string{
+func (bs *builderServiceImpl) RegisterTestCase(testUUID string, assignmentUUID string, test TestCaseParams) (*RegisterResponse, error) {
+	params := map[string]interface{}{
 		"uuid":            testUUID,
 		"assignment_uuid": assignmentUUID,
-		"input":           input,
-		"expected":        expected,
+		"input":           test.Input,
+		"expected":        test.Expected,
+		"group":           test.Group,
+		"weight":          test.Weight,
+		"sample":          test.Sample,
 	}
 	var result RegisterResponse
 	err := bs.client.Post("testcase/new", params, &result)
@@ -76,6 +257,49 @@ func (bs *builderServiceImpl) RegisterTestCase(testUUID string, assignmentUUID s
 	return &result, nil
 }
 
+// UpdateTestCase - replaces test case in the new test set revision, builds judged earlier keep old revision
+func (bs *builderServiceImpl) UpdateTestCase(testUUID string, test TestCaseParams) (*TestSetChangeResponse, error) {
+	var result TestSetChangeResponse
+	err := bs.client.Post("testcase/"+testUUID+"/update", test, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTestCase - removes test case in the new test set revision, builds judged earlier keep old revision
+func (bs *builderServiceImpl) DeleteTestCase(testUUID string) (*TestSetChangeResponse, error) {
+	var result TestSetChangeResponse
+	err := bs.client.Post("testcase/"+testUUID+"/delete", map[string]string{}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTestGroups - replaces test groups of the assignment in the new test set revision
+func (bs *builderServiceImpl) SetTestGroups(assignmentUUID string, groups []TestGroup) (*TestSetChangeResponse, error) {
+	params := map[string]interface{}{
+		"groups": groups,
+	}
+	var result TestSetChangeResponse
+	err := bs.client.Post("assignment/"+assignmentUUID+"/groups", params, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ImportTestSet - replaces assignment tests with tests from ZIP archive in the new test set revision
+func (bs *builderServiceImpl) ImportTestSet(assignmentUUID string, archive []byte) (*TestSetImportResponse, error) {
+	var result TestSetImportResponse
+	err := bs.client.PostBody("assignment/"+assignmentUUID+"/testset/import", "application/zip", archive, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // GetBuildReport - queries report for the finished build
 func (bs *builderServiceImpl) GetBuildReport(buildUUID string) (*BuildReportResponse, error) {
 	var result BuildReportResponse
@@ -85,3 +309,33 @@ func (bs *builderServiceImpl) GetBuildReport(buildUUID string) (*BuildReportResp
 	}
 	return &result, nil
 }
+
+// GetBuildReports - queries all reports of the build ordered by version
+func (bs *builderServiceImpl) GetBuildReports(buildUUID string) ([]BuildReportResponse, error) {
+	var result []BuildReportResponse
+	err := bs.client.Get("build/"+buildUUID+"/reports", &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetLanguages - queries languages enabled on builder
+func (bs *builderServiceImpl) GetLanguages() ([]LanguageResponse, error) {
+	var result []LanguageResponse
+	err := bs.client.Get("languages", &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RejudgeAssignment - returns all finished builds of the assignment to queue, previous reports are kept
+func (bs *builderServiceImpl) RejudgeAssignment(assignmentUUID string) (*RejudgeResponse, error) {
+	var result RejudgeResponse
+	err := bs.client.Post("assignment/"+assignmentUUID+"/rejudge", map[string]string{}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
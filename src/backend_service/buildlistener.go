@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"ps-group/judgeevents"
 
 	"github.com/sirupsen/logrus"
@@ -59,22 +60,44 @@ func (listener *buildListener) processBuild(event judgeevents.BuildFinishedEvent
 		if err != nil {
 			return err
 		}
-		if report.TestsTotal > 0 {
-			newScore = MaxPercentage * report.TestsPassed / report.TestsTotal
-		}
+		newScore = getReportScore(report)
 	}
 
 	db, err := listener.connector.Connect()
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 	repo := NewBackendRepository(db)
 
+	// Rejudged commit receives BuildFinished again, its new score replaces the previous one.
 	commit, err := listener.updateCommit(repo, event.Key, status, newScore)
 	if err != nil {
 		return err
 	}
-	return listener.updateSolution(repo, commit.SolutionID, commit.BuildScore)
+	return repo.updateSolutionScoreFromCommits(commit.SolutionID)
+}
+
+// getReportScore - returns percentage of the test group points earned by the build,
+// reports without groups are scored by passed tests
+func getReportScore(report *BuildReportResponse) int64 {
+	if len(report.Groups) == 0 {
+		if report.TestsTotal > 0 {
+			return MaxPercentage * report.TestsPassed / report.TestsTotal
+		}
+		return 0
+	}
+	var points int
+	var score float64
+	for _, group := range report.Groups {
+		points += group.Points
+		score += group.Score
+	}
+	if points == 0 {
+		return 0
+	}
+	// Epsilon protects from rounding down sum of fractional scores, like 99.99999 instead of 100.
+	return int64(math.Floor(MaxPercentage*score/float64(points) + 1e-9))
 }
 
 func (listener *buildListener) updateCommit(repo *BackendRepository, buildUUID string, status string, newScore int64) (*CommitModel, error) {
@@ -93,19 +116,3 @@ func (listener *buildListener) updateCommit(repo *BackendRepository, buildUUID s
 
 	return commit, nil
 }
-
-func (listener *buildListener) updateSolution(repo *BackendRepository, solutionID int64, newScore int64) error {
-	solution, err := repo.getSolution(solutionID)
-	if err != nil {
-		return err
-	}
-
-	if solution.Score < newScore {
-		err := repo.updateSolutionScore(solutionID, newScore)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
@@ -206,6 +206,23 @@ type SolutionModel struct {
 	Score        int64
 }
 
+// hasActiveAppointment - checks if user belongs to group which is appointed to the contest right now
+func (r *BackendRepository) hasActiveAppointment(userID int64, contestID int64) (bool, error) {
+	sql := "SELECT `appointment`.`id`" +
+		" FROM `appointment`" +
+		" INNER JOIN `group_relation`" +
+		" ON `group_relation`.`group_id`=`appointment`.`group_id`" +
+		" WHERE `group_relation`.`user_id`=? AND `appointment`.`contest_id`=?" +
+		" AND `appointment`.`start_time`<=NOW() AND NOW()<`appointment`.`end_time`" +
+		" LIMIT 1"
+
+	rows, err := r.query(sql, userID, contestID)
+	if err != nil {
+		return false, err
+	}
+	return rows.Next(), nil
+}
+
 func (r *BackendRepository) getUserAssignmentSolution(userID int64, assignmentID int64) (*SolutionModel, error) {
 	rows, err := r.query("SELECT `id`, `score` FROM solution WHERE user_id=? AND assignment_id=? LIMIT 1", userID, assignmentID)
 	if err != nil {
@@ -272,6 +289,16 @@ func (r *BackendRepository) updateSolutionScore(solutionID int64, score int64) e
 	return err
 }
 
+// updateSolutionScoreFromCommits - sets solution score to the best build score of its commits,
+// so score can decrease after rejudge. Commits judged on sample tests only are not scored.
+func (r *BackendRepository) updateSolutionScoreFromCommits(solutionID int64) error {
+	sql := "UPDATE `solution` SET `score`=" +
+		" (SELECT COALESCE(MAX(`build_score`), 0) FROM `commit` WHERE `solution_id`=? AND `mode`<>'samples_only')" +
+		" WHERE `id`=?"
+	_, err := r.query(sql, solutionID, solutionID)
+	return err
+}
+
 func (r *BackendRepository) getAssignment(assignmentID int64) (*AssignmentInfoModel, error) {
 	rows, err := r.query("SELECT `contest_id`, `uuid`, `title` FROM assignment WHERE id=?", assignmentID)
 	if err != nil {
@@ -347,8 +374,8 @@ func (r *BackendRepository) getCommitUUID(commitID int64) (string, error) {
 	return uuid, err
 }
 
-func (r *BackendRepository) createCommit(solutionID int64, uuid string) error {
-	_, err := r.query("INSERT INTO commit (solution_id, uuid) VALUES (?, ?)", solutionID, uuid)
+func (r *BackendRepository) createCommit(solutionID int64, uuid string, mode string) error {
+	_, err := r.query("INSERT INTO commit (solution_id, uuid, mode) VALUES (?, ?, ?)", solutionID, uuid, mode)
 	return err
 }
 
@@ -401,6 +428,68 @@ func (r *BackendRepository) updateCommit(model *CommitModel) error {
 	return err
 }
 
+// ResetCommitModel - commit returned to 'pending' status for rejudge and its status before reset
+type ResetCommitModel struct {
+	ID          int64
+	BuildStatus string
+}
+
+// resetAssignmentCommits - marks finished commits of the assignment as pending and returns their previous statuses,
+// so they can be restored with restoreCommits if rejudge failed. Build scores are kept until new build reports arrive.
+func (r *BackendRepository) resetAssignmentCommits(assignmentID int64) ([]ResetCommitModel, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	join := " FROM `commit` INNER JOIN `solution` ON `solution`.`id`=`commit`.`solution_id`" +
+		" WHERE `solution`.`assignment_id`=? AND `commit`.`build_status`<>'pending'"
+	rows, err := tx.Query("SELECT `commit`.`id`, `commit`.`build_status`"+join+" FOR UPDATE", assignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	var commits []ResetCommitModel
+	for rows.Next() {
+		var commit ResetCommitModel
+		err = rows.Scan(&commit.ID, &commit.BuildStatus)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "failed to scan SQL rows")
+		}
+		commits = append(commits, commit)
+	}
+	rows.Close()
+
+	_, err = tx.Exec("UPDATE `commit` INNER JOIN `solution` ON `solution`.`id`=`commit`.`solution_id`"+
+		" SET `commit`.`build_status`='pending'"+
+		" WHERE `solution`.`assignment_id`=? AND `commit`.`build_status`<>'pending'", assignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	return commits, nil
+}
+
+// restoreCommits - returns statuses of the reset commits, commits which got build status meanwhile are not changed
+func (r *BackendRepository) restoreCommits(commits []ResetCommitModel) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	for _, commit := range commits {
+		_, err = tx.Exec("UPDATE `commit` SET `build_status`=? WHERE `id`=? AND `build_status`='pending'", commit.BuildStatus, commit.ID)
+		if err != nil {
+			return errors.Wrap(err, "SQL UPDATE query failed")
+		}
+	}
+	return tx.Commit()
+}
+
 // Creates contest and sets ID if succeed
 func (r *BackendRepository) createContest(model *ContestModel) error {
 	stmt, err := r.prepare("INSERT INTO contest (title, max_reviews) VALUES (?, ?)")
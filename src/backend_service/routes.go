@@ -46,6 +46,16 @@ var routes = restapi.RouterConfig{
 			"/commit/{id}/report",
 			getCommitReport,
 		},
+		restapi.Route{
+			"GET",
+			"/commit/{id}/reports",
+			getCommitReports,
+		},
+		restapi.Route{
+			"GET",
+			"/languages",
+			getLanguages,
+		},
 		restapi.Route{
 			"GET",
 			"/contest/{id}/assignments",
@@ -56,6 +66,26 @@ var routes = restapi.RouterConfig{
 			"/assignment/{id}",
 			getAssignmentInfo,
 		},
+		restapi.Route{
+			"POST",
+			"/assignment/{id}/rejudge",
+			rejudgeAssignment,
+		},
+		restapi.Route{
+			"POST",
+			"/assignment/{id}/groups",
+			setTestGroups,
+		},
+		restapi.Route{
+			"POST",
+			"/assignment/{id}/testset/import",
+			importTestSet,
+		},
+		restapi.Route{
+			"POST",
+			"/contest/{id}/rejudge",
+			rejudgeContest,
+		},
 		restapi.Route{
 			"POST",
 			"/contest/create",
@@ -76,6 +106,16 @@ var routes = restapi.RouterConfig{
 			"/testcase/create",
 			createTestCase,
 		},
+		restapi.Route{
+			"POST",
+			"/testcase/{uuid}/update",
+			updateTestCase,
+		},
+		restapi.Route{
+			"POST",
+			"/testcase/{uuid}/delete",
+			deleteTestCase,
+		},
 	},
 	BackendAPIPrefix,
 }
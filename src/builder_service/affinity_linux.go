@@ -0,0 +1,47 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// cpuSetSize - number of CPUs in the affinity mask, same as CPU_SETSIZE in glibc
+const cpuSetSize = 1024
+
+// cpuSet - CPU affinity mask of the thread
+type cpuSet [cpuSetSize / 64]uint64
+
+// setThreadCPUAffinity - pins current OS thread to given CPU
+func setThreadCPUAffinity(cpu int) error {
+	var mask cpuSet
+	if cpu < 0 || cpu >= cpuSetSize {
+		return errors.Errorf("invalid CPU number %d", cpu)
+	}
+	mask[cpu/64] |= 1 << uint(cpu%64)
+	err := setThreadCPUSet(&mask)
+	if err != nil {
+		return errors.Wrapf(err, "cannot set affinity to CPU %d", cpu)
+	}
+	return nil
+}
+
+// getThreadCPUSet - returns CPUs which current OS thread can run on
+func getThreadCPUSet() (*cpuSet, error) {
+	var mask cpuSet
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return nil, errors.Wrap(errno, "cannot get CPU affinity")
+	}
+	return &mask, nil
+}
+
+// setThreadCPUSet - pins current OS thread to given CPUs
+func setThreadCPUSet(mask *cpuSet) error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
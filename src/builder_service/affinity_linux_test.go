@@ -0,0 +1,34 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestThreadCPUAffinity(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Thread stays locked, so the pinned thread exits with goroutine.
+		runtime.LockOSThread()
+		err := setThreadCPUAffinity(0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		cpus, err := getThreadCPUSet()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var want cpuSet
+		want[0] = 1
+		if *cpus != want {
+			t.Errorf("thread is not pinned to CPU 0")
+		}
+		if setThreadCPUAffinity(cpuSetSize) == nil {
+			t.Errorf("invalid CPU accepted")
+		}
+	}()
+	<-done
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// cpuSet - CPU affinity mask of the thread
+type cpuSet struct{}
+
+var errAffinityUnsupported = errors.New("CPU affinity is supported only on Linux")
+
+func setThreadCPUAffinity(cpu int) error {
+	return errAffinityUnsupported
+}
+
+func getThreadCPUSet() (*cpuSet, error) {
+	return nil, errAffinityUnsupported
+}
+
+func setThreadCPUSet(mask *cpuSet) error {
+	return errAffinityUnsupported
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	blobStoreLocal = "local"
+	blobStoreS3    = "s3"
+
+	defaultBlobStoreDir  = "blobs"
+	defaultInlineLimitKB = 64
+)
+
+// errBlobNotFound - blob with given hash is not stored
+var errBlobNotFound = errors.New("blob not found")
+
+// BlobStore - content-addressed storage for large tests and sources,
+// blob is addressed by hex SHA-256 hash of its content, so equal content is stored once.
+type BlobStore interface {
+	// Put - stores content and returns its hash
+	Put(content io.Reader) (string, error)
+	// Open - returns reader of the blob content or errBlobNotFound
+	Open(hash string) (io.ReadCloser, error)
+}
+
+// newBlobStore - creates blob store for given configuration
+func newBlobStore(config BlobStoreConfig) (BlobStore, error) {
+	dir := config.Dir
+	if len(dir) == 0 {
+		dir = defaultBlobStoreDir
+	}
+	local, err := newLocalBlobStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch config.Kind {
+	case "", blobStoreLocal:
+		return local, nil
+	case blobStoreS3:
+		remote, err := newS3BlobStore(config.S3)
+		if err != nil {
+			return nil, err
+		}
+		return &cachedBlobStore{remote: remote, cache: local}, nil
+	}
+	return nil, errors.New("unknown blob store '" + config.Kind + "'")
+}
+
+// checkBlobHash - validates hash before it is used in file path or URL
+func checkBlobHash(hash string) error {
+	if len(hash) != sha256.Size*2 {
+		return errors.New("invalid blob hash '" + hash + "'")
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return errors.New("invalid blob hash '" + hash + "'")
+	}
+	return nil
+}
+
+// blobPath - returns relative path of the blob, blobs are spread between subdirectories by hash prefix
+func blobPath(hash string) string {
+	return hash[:2] + "/" + hash[2:]
+}
+
+// localBlobStore - keeps blobs in local directory, directory can be shared by builder nodes
+type localBlobStore struct {
+	dir string
+}
+
+func newLocalBlobStore(dir string) (*localBlobStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create blob store directory")
+	}
+	return &localBlobStore{dir: dir}, nil
+}
+
+// Put - writes content into temporary file while hashing it, then moves file to its final path,
+// so readers never see partially written blob
+func (s *localBlobStore) Put(content io.Reader) (string, error) {
+	file, err := ioutil.TempFile(s.dir, "upload-")
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create blob file")
+	}
+	defer os.Remove(file.Name())
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hasher), content)
+	closeErr := file.Close()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot write blob file")
+	}
+	if closeErr != nil {
+		return "", errors.Wrap(closeErr, "cannot write blob file")
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	target := filepath.Join(s.dir, filepath.FromSlash(blobPath(hash)))
+	if _, err := os.Stat(target); err == nil {
+		return hash, nil
+	}
+	err = os.MkdirAll(filepath.Dir(target), os.ModePerm)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create blob directory")
+	}
+	err = os.Rename(file.Name(), target)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot save blob file")
+	}
+	return hash, nil
+}
+
+func (s *localBlobStore) Open(hash string) (io.ReadCloser, error) {
+	err := checkBlobHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(blobPath(hash))))
+	if os.IsNotExist(err) {
+		return nil, errBlobNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open blob file")
+	}
+	return file, nil
+}
+
+// cachedBlobStore - keeps blobs in remote store and caches them on the builder node
+type cachedBlobStore struct {
+	remote BlobStore
+	cache  *localBlobStore
+}
+
+// Put - saves content into cache, then uploads cached blob
+func (s *cachedBlobStore) Put(content io.Reader) (string, error) {
+	hash, err := s.cache.Put(content)
+	if err != nil {
+		return "", err
+	}
+	cached, err := s.cache.Open(hash)
+	if err != nil {
+		return "", err
+	}
+	defer cached.Close()
+	_, err = s.remote.Put(cached)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *cachedBlobStore) Open(hash string) (io.ReadCloser, error) {
+	cached, err := s.cache.Open(hash)
+	if err != errBlobNotFound {
+		return cached, err
+	}
+	content, err := s.remote.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	cachedHash, err := s.cache.Put(content)
+	if err != nil {
+		return nil, err
+	}
+	if cachedHash != hash {
+		return nil, errors.New("blob '" + hash + "' content does not match its hash")
+	}
+	return s.cache.Open(hash)
+}
+
+// dataStore - keeps small tests and sources inline in database rows and larger ones in blob store
+type dataStore struct {
+	blobs       BlobStore
+	inlineLimit int
+}
+
+func newDataStore(blobs BlobStore, config BlobStoreConfig) *dataStore {
+	inlineLimitKB := config.InlineLimitKB
+	if inlineLimitKB == 0 {
+		inlineLimitKB = defaultInlineLimitKB
+	}
+	return &dataStore{blobs: blobs, inlineLimit: inlineLimitKB * 1024}
+}
+
+// save - returns either inline content or hash of the blob with content
+func (s *dataStore) save(content string) (inline string, hash string, err error) {
+	if len(content) <= s.inlineLimit {
+		return content, "", nil
+	}
+	hash, err = s.blobs.Put(strings.NewReader(content))
+	if err != nil {
+		return "", "", errors.Wrap(err, "cannot save blob")
+	}
+	return "", hash, nil
+}
+
+// load - returns content saved with save
+func (s *dataStore) load(inline string, hash string) (string, error) {
+	if len(hash) == 0 {
+		return inline, nil
+	}
+	blob, err := s.blobs.Open(hash)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot open blob '"+hash+"'")
+	}
+	defer blob.Close()
+	content, err := ioutil.ReadAll(blob)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read blob '"+hash+"'")
+	}
+	return string(content), nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3SignedHeaders = "host;x-amz-content-sha256;x-amz-date"
+)
+
+// s3EmptyPayloadHash - SHA-256 hash of empty request body
+var s3EmptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// s3BlobStore - keeps blobs in S3-compatible object storage, like MinIO, using path-style URLs
+// and AWS Signature Version 4. Blob hash is also used as payload hash of the upload request.
+type s3BlobStore struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func newS3BlobStore(config S3Config) (*s3BlobStore, error) {
+	if len(config.Endpoint) == 0 || len(config.Bucket) == 0 {
+		return nil, errors.New("S3 blob store requires 'endpoint' and 'bucket'")
+	}
+	store := &s3BlobStore{
+		endpoint:  strings.TrimSuffix(config.Endpoint, "/"),
+		region:    config.Region,
+		bucket:    config.Bucket,
+		accessKey: config.AccessKey,
+		secretKey: config.SecretKey,
+		client:    new(http.Client),
+	}
+	if len(store.region) == 0 {
+		store.region = s3DefaultRegion
+	}
+	return store, nil
+}
+
+// Put - spools content into temporary file to calculate its hash, then uploads it unless object already exists
+func (s *s3BlobStore) Put(content io.Reader) (string, error) {
+	file, err := ioutil.TempFile("", "blob-")
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create temporary blob file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hasher), content)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot write temporary blob file")
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	exists, err := s.exists(hash)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return hash, nil
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	request, err := http.NewRequest("PUT", s.objectURL(hash), file)
+	if err != nil {
+		return "", err
+	}
+	request.ContentLength = size
+	response, err := s.do(request, hash)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf("S3 upload of blob '%s' failed with status %d", hash, response.StatusCode)
+	}
+	return hash, nil
+}
+
+func (s *s3BlobStore) Open(hash string) (io.ReadCloser, error) {
+	err := checkBlobHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", s.objectURL(hash), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.do(request, s3EmptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		return response.Body, nil
+	case http.StatusNotFound:
+		response.Body.Close()
+		return nil, errBlobNotFound
+	}
+	response.Body.Close()
+	return nil, errors.Errorf("S3 download of blob '%s' failed with status %d", hash, response.StatusCode)
+}
+
+func (s *s3BlobStore) exists(hash string) (bool, error) {
+	request, err := http.NewRequest("HEAD", s.objectURL(hash), nil)
+	if err != nil {
+		return false, err
+	}
+	response, err := s.do(request, s3EmptyPayloadHash)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, errors.Errorf("S3 check of blob '%s' failed with status %d", hash, response.StatusCode)
+}
+
+func (s *s3BlobStore) objectURL(hash string) string {
+	return s.endpoint + "/" + s.bucket + "/" + blobPath(hash)
+}
+
+// do - signs request with AWS Signature Version 4 and sends it
+func (s *s3BlobStore) do(request *http.Request, payloadHash string) (*http.Response, error) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		s3SignedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", s3Algorithm+" Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+s3SignedHeaders+", Signature="+signature)
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "S3 request failed")
+	}
+	return response, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// readBlob - returns content of the blob or fails test
+func readBlob(t *testing.T, store BlobStore, hash string) string {
+	blob, err := store.Open(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	content, err := ioutil.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func hashOf(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := store.Put(strings.NewReader("1 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != hashOf("1 2\n") {
+		t.Errorf("got hash %s", hash)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, hash[:2], hash[2:])); err != nil {
+		t.Errorf("blob is not stored by hash prefix: %v", err)
+	}
+	again, err := store.Put(strings.NewReader("1 2\n"))
+	if err != nil || again != hash {
+		t.Errorf("equal content got hash %s, error %v", again, err)
+	}
+	if content := readBlob(t, store, hash); content != "1 2\n" {
+		t.Errorf("got content %q", content)
+	}
+	files, _ := filepath.Glob(filepath.Join(store.dir, "upload-*"))
+	if len(files) != 0 {
+		t.Errorf("temporary files left: %v", files)
+	}
+
+	if _, err := store.Open(hashOf("missed")); err != errBlobNotFound {
+		t.Errorf("missed blob: got %v, want errBlobNotFound", err)
+	}
+	if _, err := store.Open("../../etc/passwd"); err == nil || err == errBlobNotFound {
+		t.Errorf("invalid hash: got %v", err)
+	}
+}
+
+func TestCachedBlobStore(t *testing.T) {
+	remote, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &cachedBlobStore{remote: remote, cache: cache}
+
+	hash, err := store.Put(strings.NewReader("uploaded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readBlob(t, remote, hash); content != "uploaded" {
+		t.Errorf("blob is not uploaded, got %q", content)
+	}
+
+	// Blob uploaded by another builder node is downloaded into cache on first use.
+	hash, err = remote.Put(strings.NewReader("remote"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readBlob(t, store, hash); content != "remote" {
+		t.Errorf("got content %q", content)
+	}
+	if content := readBlob(t, cache, hash); content != "remote" {
+		t.Errorf("downloaded blob is not cached, got %q", content)
+	}
+
+	// Corrupted remote blob is not returned.
+	corrupted := hashOf("expected")
+	target := filepath.Join(remote.dir, corrupted[:2], corrupted[2:])
+	os.MkdirAll(filepath.Dir(target), os.ModePerm)
+	err = ioutil.WriteFile(target, []byte("corrupted"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(corrupted); err == nil {
+		t.Error("blob which does not match its hash is returned")
+	}
+}
+
+func TestDataStoreKeepsSmallDataInline(t *testing.T) {
+	blobs, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := newDataStore(blobs, BlobStoreConfig{InlineLimitKB: 1})
+	small := strings.Repeat("a", 1024)
+	inline, hash, err := data.save(small)
+	if err != nil || inline != small || hash != "" {
+		t.Errorf("data up to inline limit is not kept inline, got hash %q, error %v", hash, err)
+	}
+	large := small + "b"
+	inline, hash, err = data.save(large)
+	if err != nil || inline != "" || hash != hashOf(large) {
+		t.Errorf("data over inline limit is not saved to blob store, got hash %q, error %v", hash, err)
+	}
+	for _, saved := range [][2]string{{small, ""}, {"", hash}} {
+		content, err := data.load(saved[0], saved[1])
+		if err != nil || len(content) < 1024 {
+			t.Errorf("got %d bytes, error %v", len(content), err)
+		}
+	}
+}
+
+// fakeS3Server - keeps objects uploaded with PUT and checks that requests are signed
+type fakeS3Server struct {
+	t       *testing.T
+	mutex   sync.Mutex
+	objects map[string]string
+	puts    int
+}
+
+func (s *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), s3Algorithm+" Credential=access/") || r.Header.Get("x-amz-date") == "" {
+		s.t.Errorf("%s %s is not signed", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	content, ok := s.objects[r.URL.Path]
+	switch r.Method {
+	case "HEAD", "GET":
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(content))
+	case "PUT":
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("x-amz-content-sha256") != hashOf(string(body)) {
+			s.t.Error("payload hash does not match uploaded content")
+		}
+		s.objects[r.URL.Path] = string(body)
+		s.puts++
+	}
+}
+
+func TestS3BlobStore(t *testing.T) {
+	server := &fakeS3Server{t: t, objects: make(map[string]string)}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	store, err := newS3BlobStore(S3Config{Endpoint: httpServer.URL + "/", Bucket: "tests", AccessKey: "access", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		hash, err := store.Put(strings.NewReader("3 4\n"))
+		if err != nil || hash != hashOf("3 4\n") {
+			t.Fatalf("got hash %s, error %v", hash, err)
+		}
+	}
+	if server.puts != 1 {
+		t.Errorf("existing object uploaded %d times", server.puts)
+	}
+	hash := hashOf("3 4\n")
+	if _, ok := server.objects["/tests/"+hash[:2]+"/"+hash[2:]]; !ok {
+		t.Errorf("object is not stored by path-style URL: %v", server.objects)
+	}
+	if content := readBlob(t, store, hash); content != "3 4\n" {
+		t.Errorf("got content %q", content)
+	}
+	if _, err := store.Open(hashOf("missed")); err != errBlobNotFound {
+		t.Errorf("missed object: got %v, want errBlobNotFound", err)
+	}
+}
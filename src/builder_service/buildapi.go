@@ -2,19 +2,36 @@ package main
 
 import (
 	"database/sql"
+	"ps-group/judgeevents"
 	"ps-group/restapi"
+	"strconv"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type apiContext struct {
 	dbConnector DatabaseConnector
+	languages   *languageRegistry
+	events      judgeevents.BuilderEvents
+	data        *dataStore
 }
 
 func (c *apiContext) ConnectDB() (*sql.DB, error) {
 	return c.dbConnector.Connect()
 }
 
+// saveTestData - returns test case which large input and answer are moved to blob store
+func (c *apiContext) saveTestData(testCase TestCase) (TestCase, error) {
+	var err error
+	testCase.Input, testCase.InputHash, err = c.data.save(testCase.Input)
+	if err != nil {
+		return testCase, err
+	}
+	testCase.Expected, testCase.ExpectedHash, err = c.data.save(testCase.Expected)
+	return testCase, err
+}
+
 // BuildStatusResponse - contains build status.
 type BuildStatusResponse struct {
 	UUID   string `json:"uuid"`
@@ -22,31 +39,188 @@ type BuildStatusResponse struct {
 }
 
 // BuildReportResponse - contains full build information.
+// Version - number of the report in build history, each rejudge adds new version
+// CreatedAt - unix time when report was saved
+// BuilderNode - builder node which ran the build
+// TestSetRevision, CheckerRevision - revisions of the assignment test set and checker used for the build
+// Mode - judging mode of the build, "samples_only" builds are not scored
 type BuildReportResponse struct {
-	UUID        string `json:"uuid"`
-	Status      Status `json:"status"`
-	Exception   string `json:"exception"`
-	BuildLog    string `json:"build_log"`
-	TestsLog    string `json:"tests_log"`
-	TestsPassed int64  `json:"tests_passed"`
-	TestsTotal  int64  `json:"tests_total"`
+	UUID            string                `json:"uuid"`
+	Status          Status                `json:"status"`
+	Exception       string                `json:"exception"`
+	BuildLog        string                `json:"build_log"`
+	TestsLog        string                `json:"tests_log"`
+	TestsPassed     int64                 `json:"tests_passed"`
+	TestsTotal      int64                 `json:"tests_total"`
+	Attempts        int                   `json:"attempts"`
+	Version         int                   `json:"version"`
+	CreatedAt       int64                 `json:"created_at"`
+	BuilderNode     string                `json:"builder_node"`
+	TestSetRevision int                   `json:"testset_revision"`
+	CheckerRevision int                   `json:"checker_revision"`
+	Mode            JudgingMode           `json:"mode"`
+	Groups          []GroupResultResponse `json:"groups"`
+	Tests           []TestResultResponse  `json:"tests"`
+	Diagnostics     []DiagnosticResponse  `json:"diagnostics"`
+}
+
+// DiagnosticResponse - contains compiler message about the source line
+// Severity - one of "error", "warning", "note"
+// Column - 0 if compiler did not report it
+type DiagnosticResponse struct {
+	File     string             `json:"file"`
+	Line     int                `json:"line"`
+	Column   int                `json:"column"`
+	Severity DiagnosticSeverity `json:"severity"`
+	Message  string             `json:"message"`
+}
+
+// TestResultResponse - contains result of the single test case run
+// Verdict - one of "AC", "WA", "TLE", "WTLE", "MLE", "RE", "OLE", "NOF"
+// LimitExceeded - either empty or one of "cpu", "wall", "memory", "output"
+type TestResultResponse struct {
+	Verdict       Verdict   `json:"verdict"`
+	LimitExceeded LimitKind `json:"limit_exceeded"`
+	WallTimeMs    int64     `json:"wall_time_ms"`
+	CPUTimeMs     int64     `json:"cpu_time_ms"`
+	MemoryKB      int64     `json:"memory_kb"`
+	ExitCode      int       `json:"exit_code"`
+	Signal        int       `json:"signal"`
+	Stdout        string    `json:"stdout"`
+	Stderr        string    `json:"stderr"`
+	Message       string    `json:"message"`
+}
+
+// LanguageResponse - contains information about language enabled on builder
+type LanguageResponse struct {
+	ID               language `json:"id"`
+	Title            string   `json:"title"`
+	TimeMultiplier   float64  `json:"time_multiplier"`
+	MemoryMultiplier float64  `json:"memory_multiplier"`
 }
 
 // RegisterBuildRequest - contains information required to register new build
-// Language - either "c++" or "pascal"
+// Language - one of languages listed by "/languages"
+// Priority - one of "contest", "practice" (default), "rejudge"
+// Mode - one of "full" (default), "stop_on_first_failure", "samples_only"
 type RegisterBuildRequest struct {
-	UUID           string   `json:"uuid"`
-	AssignmentUUID string   `json:"assignment_uuid"`
-	Language       language `json:"language"`
-	Source         string   `json:"source"`
+	UUID           string        `json:"uuid"`
+	AssignmentUUID string        `json:"assignment_uuid"`
+	Language       language      `json:"language"`
+	Source         string        `json:"source"`
+	Priority       BuildPriority `json:"priority"`
+	Mode           JudgingMode   `json:"mode"`
 }
 
 // RegisterTestCaseRequest - contains information required to register tes case
+// Group - name of the test group, tests without listed group are scored by weight
+// Weight - weight of the test inside "sum" scoring group, 1 by default
+// Sample - test is shown to students as an example and runs in "samples_only" mode
 type RegisterTestCaseRequest struct {
 	UUID           string `json:"uuid"`
 	AssignmentUUID string `json:"assignment_uuid"`
 	Input          string `json:"input"`
 	Expected       string `json:"expected"`
+	Group          string `json:"group"`
+	Weight         int    `json:"weight"`
+	Sample         bool   `json:"sample"`
+}
+
+// UpdateTestCaseRequest - contains new input, expected answer, group, weight and sample flag of the test case
+type UpdateTestCaseRequest struct {
+	Input    string `json:"input"`
+	Expected string `json:"expected"`
+	Group    string `json:"group"`
+	Weight   int    `json:"weight"`
+	Sample   bool   `json:"sample"`
+}
+
+// SetTestGroupsRequest - contains all test groups of the assignment in order
+type SetTestGroupsRequest struct {
+	Groups []TestGroupRequest `json:"groups"`
+}
+
+// TestGroupRequest - contains test group settings
+// Scoring - "all" (default) gives points only if all group tests passed, "sum" gives points for passed tests weight
+// Dependencies - names of groups listed earlier, group gives no points unless all of them passed
+type TestGroupRequest struct {
+	Name         string       `json:"name"`
+	Points       int          `json:"points"`
+	Scoring      GroupScoring `json:"scoring"`
+	Dependencies []string     `json:"dependencies"`
+}
+
+// TestSetChangeResponse - contains test set revision created by the test case or test groups change
+// UUID - UUID of the changed test case or assignment
+type TestSetChangeResponse struct {
+	UUID            string `json:"uuid"`
+	TestSetRevision int    `json:"testset_revision"`
+}
+
+// TestSetImportResponse - contains test set revision created by the archive import
+// LimitsUpdated, CheckerUpdated - archive had limits or checker and they replaced assignment settings
+type TestSetImportResponse struct {
+	UUID            string `json:"uuid"`
+	TestSetRevision int    `json:"testset_revision"`
+	Tests           int    `json:"tests"`
+	Groups          int    `json:"groups"`
+	LimitsUpdated   bool   `json:"limits_updated"`
+	CheckerUpdated  bool   `json:"checker_updated"`
+}
+
+// TestSetResponse - contains ordered test cases and test groups of the assignment test set revision
+type TestSetResponse struct {
+	Revision int                `json:"revision"`
+	Groups   []TestGroupRequest `json:"groups"`
+	Tests    []TestCaseResponse `json:"tests"`
+}
+
+// TestCaseResponse - contains single test case of the test set
+// InputHash, ExpectedHash - hashes of large input and answer kept in blob store, Input and Expected are empty for them
+type TestCaseResponse struct {
+	UUID         string `json:"uuid"`
+	Index        int    `json:"index"`
+	Input        string `json:"input"`
+	Expected     string `json:"expected"`
+	InputHash    string `json:"input_hash"`
+	ExpectedHash string `json:"expected_hash"`
+	Group        string `json:"group"`
+	Weight       int    `json:"weight"`
+	Sample       bool   `json:"sample"`
+}
+
+// GroupResultResponse - contains result of the test group
+// Score - points earned by the group, can be fractional for "sum" scoring
+// Passed - all tests of the group and its dependencies passed
+type GroupResultResponse struct {
+	Name        string  `json:"name"`
+	Points      int     `json:"points"`
+	Score       float64 `json:"score"`
+	TestsPassed int     `json:"tests_passed"`
+	TestsTotal  int     `json:"tests_total"`
+	Passed      bool    `json:"passed"`
+}
+
+// RegisterAssignmentRequest - contains resource limits and checker for the assignment solutions
+// Zero limit value means builder default.
+// Checker - one of "exact" (default), "trailing_whitespace", "tokens", "case_insensitive", "float", "custom", "interactor"
+// CheckerSource - source code of testlib-compatible checker or interactor, required for "custom" and "interactor" checkers
+// IOMode - either "stdio" (default) or "file"; in "file" mode solution reads InputFile and writes OutputFile,
+// "input.txt" and "output.txt" by default
+type RegisterAssignmentRequest struct {
+	UUID              string      `json:"uuid"`
+	TimeLimitMs       int         `json:"time_limit_ms"`
+	MemoryLimitMB     int         `json:"memory_limit_mb"`
+	OutputLimitKB     int         `json:"output_limit_kb"`
+	StackSizeMB       int         `json:"stack_size_mb"`
+	Checker           CheckerKind `json:"checker"`
+	CheckerAbsEpsilon float64     `json:"checker_abs_epsilon"`
+	CheckerRelEpsilon float64     `json:"checker_rel_epsilon"`
+	CheckerSource     string      `json:"checker_source"`
+	CheckerLanguage   language    `json:"checker_language"`
+	IOMode            IOMode      `json:"io_mode"`
+	InputFile         string      `json:"input_file"`
+	OutputFile        string      `json:"output_file"`
 }
 
 // RegisterResponse - contains UUID of registered object.
@@ -54,6 +228,11 @@ type RegisterResponse struct {
 	UUID string `json:"uuid"`
 }
 
+// RejudgeResponse - contains number of builds returned to queue.
+type RejudgeResponse struct {
+	Rejudged int64 `json:"rejudged"`
+}
+
 func getBuildReport(ctx interface{}, req restapi.Request) restapi.Response {
 	c := ctx.(*apiContext)
 
@@ -73,14 +252,117 @@ func getBuildReport(ctx interface{}, req restapi.Request) restapi.Response {
 		return &restapi.InternalError{err}
 	}
 
-	res := &BuildReportResponse{
-		UUID:        key,
-		Status:      report.Status,
-		Exception:   report.Exception,
-		BuildLog:    report.BuildLog,
-		TestsLog:    report.TestsLog,
-		TestsPassed: report.TestsPassed,
-		TestsTotal:  report.TestsTotal,
+	res := newBuildReportResponse(*report)
+	return &restapi.Ok{&res}
+}
+
+func getBuildReports(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+	repo := NewBuilderRepository(db)
+	reports, err := repo.GetBuildReports(key)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	res := make([]BuildReportResponse, 0, len(reports))
+	for _, report := range reports {
+		res = append(res, newBuildReportResponse(report))
+	}
+	return &restapi.Ok{&res}
+}
+
+func newBuildReportResponse(report BuildReport) BuildReportResponse {
+	return BuildReportResponse{
+		UUID:            report.Key,
+		Status:          report.Status,
+		Exception:       report.Exception,
+		BuildLog:        report.BuildLog,
+		TestsLog:        report.TestsLog,
+		TestsPassed:     report.TestsPassed,
+		TestsTotal:      report.TestsTotal,
+		Attempts:        report.Attempts,
+		Version:         report.Version,
+		CreatedAt:       report.CreatedAt,
+		BuilderNode:     report.BuilderNode,
+		TestSetRevision: report.TestSetRevision,
+		CheckerRevision: report.CheckerRevision,
+		Mode:            report.Mode,
+		Groups:          newGroupResultsResponse(report.GroupResults),
+		Tests:           newTestResultsResponse(report.TestResults),
+		Diagnostics:     newDiagnosticsResponse(report.Diagnostics),
+	}
+}
+
+func newDiagnosticsResponse(diagnostics []Diagnostic) []DiagnosticResponse {
+	responses := make([]DiagnosticResponse, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		responses = append(responses, DiagnosticResponse{
+			File:     diagnostic.File,
+			Line:     diagnostic.Line,
+			Column:   diagnostic.Column,
+			Severity: diagnostic.Severity,
+			Message:  diagnostic.Message,
+		})
+	}
+	return responses
+}
+
+func newGroupResultsResponse(results []GroupResult) []GroupResultResponse {
+	responses := make([]GroupResultResponse, 0, len(results))
+	for _, result := range results {
+		responses = append(responses, GroupResultResponse{
+			Name:        result.Name,
+			Points:      result.Points,
+			Score:       result.Score,
+			TestsPassed: result.TestsPassed,
+			TestsTotal:  result.TestsTotal,
+			Passed:      result.Passed,
+		})
+	}
+	return responses
+}
+
+func newTestResultsResponse(results []TestResult) []TestResultResponse {
+	responses := make([]TestResultResponse, 0, len(results))
+	for _, result := range results {
+		responses = append(responses, TestResultResponse{
+			Verdict:       result.Verdict,
+			LimitExceeded: result.LimitExceeded,
+			WallTimeMs:    result.WallTimeMs,
+			CPUTimeMs:     result.CPUTimeMs,
+			MemoryKB:      result.MemoryKB,
+			ExitCode:      result.ExitCode,
+			Signal:        result.Signal,
+			Stdout:        result.Stdout,
+			Stderr:        result.Stderr,
+			Message:       result.Message,
+		})
+	}
+	return responses
+}
+
+func getLanguages(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+
+	res := make([]LanguageResponse, 0, len(c.languages.list()))
+	for _, config := range c.languages.list() {
+		res = append(res, LanguageResponse{
+			ID:               config.ID,
+			Title:            config.Title,
+			TimeMultiplier:   config.TimeMultiplier,
+			MemoryMultiplier: config.MemoryMultiplier,
+		})
 	}
 	return &restapi.Ok{&res}
 }
@@ -118,6 +400,17 @@ func createBuild(ctx interface{}, req restapi.Request) restapi.Response {
 	if err != nil {
 		return &restapi.BadRequest{err}
 	}
+	if _, ok := c.languages.get(params.Language); !ok {
+		return &restapi.BadRequest{errors.New("unknown language '" + string(params.Language) + "'")}
+	}
+	priority, err := getBuildPriorityLevel(params.Priority)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	mode, err := validateJudgingMode(params.Mode)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
 
 	db, err := c.ConnectDB()
 	if err != nil {
@@ -130,23 +423,117 @@ func createBuild(ctx interface{}, req restapi.Request) restapi.Response {
 	if err != nil {
 		return &restapi.InternalError{err}
 	}
+	source, sourceHash, err := c.data.save(params.Source)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
 
 	err = repo.RegisterBuild(RegisterBuildParams{
 		AssignmentID: assignmentID,
 		Key:          params.UUID,
 		Language:     params.Language,
-		Source:       params.Source,
+		Source:       source,
+		SourceHash:   sourceHash,
+		Priority:     priority,
+		Mode:         mode,
 	})
 	if err != nil {
 		return &restapi.InternalError{err}
 	}
 
+	c.fireBuildRequested(params.UUID, 1)
+
 	res := RegisterResponse{
 		UUID: params.UUID,
 	}
 	return &restapi.Ok{&res}
 }
 
+func rejudgeBuild(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+	priority, err := getBuildPriorityLevel(PriorityRejudge)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	rejudged, err := repo.RejudgeBuild(key, priority)
+	if err == errBuildNotFound {
+		return &restapi.NotFound{errors.Wrap(err, key)}
+	}
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	if !rejudged {
+		return &restapi.BadRequest{errors.New("build with key '" + key + "' is not finished yet")}
+	}
+	c.fireBuildRequested(key, 1)
+
+	res := RejudgeResponse{
+		Rejudged: 1,
+	}
+	return &restapi.Ok{&res}
+}
+
+func rejudgeAssignment(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+	priority, err := getBuildPriorityLevel(PriorityRejudge)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	assignmentID, err := repo.FindAssignmentID(key)
+	if err == errAssignmentNotFound {
+		return &restapi.NotFound{errors.Wrap(err, key)}
+	}
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	rejudged, err := repo.RejudgeAssignmentBuilds(assignmentID, priority)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	if rejudged != 0 {
+		c.fireBuildRequested(key, rejudged)
+	}
+
+	res := RejudgeResponse{
+		Rejudged: rejudged,
+	}
+	return &restapi.Ok{&res}
+}
+
+// fireBuildRequested - wakes idle workers, builds are already queued,
+// so workers will find them by polling even if event is lost
+func (c *apiContext) fireBuildRequested(key string, count int64) {
+	c.events.PublishBuildRequested(judgeevents.BuildRequestedEvent{Key: key, Count: count})
+	err := c.events.Error()
+	if err != nil {
+		logrus.WithField("uuid", key).WithField("error", err).Warn("cannot post build requested")
+	}
+}
+
 func createTestCase(ctx interface{}, req restapi.Request) restapi.Response {
 	c := ctx.(*apiContext)
 
@@ -155,6 +542,10 @@ func createTestCase(ctx interface{}, req restapi.Request) restapi.Response {
 	if err != nil {
 		return &restapi.BadRequest{err}
 	}
+	weight, err := newTestCaseWeight(params.Weight)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
 
 	db, err := c.ConnectDB()
 	if err != nil {
@@ -167,19 +558,461 @@ func createTestCase(ctx interface{}, req restapi.Request) restapi.Response {
 	if err != nil {
 		return &restapi.InternalError{err}
 	}
+	data, err := c.saveTestData(TestCase{Input: params.Input, Expected: params.Expected})
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
 
-	err = repo.RegisterTestCase(RegisterTestCaseParams{
+	revision, err := repo.RegisterTestCase(RegisterTestCaseParams{
 		AssignmentID: assignmentID,
 		Key:          params.UUID,
-		Input:        params.Input,
-		Expected:     params.Expected,
+		Input:        data.Input,
+		Expected:     data.Expected,
+		InputHash:    data.InputHash,
+		ExpectedHash: data.ExpectedHash,
+		Group:        params.Group,
+		Weight:       weight,
+		Sample:       params.Sample,
 	})
 	if err != nil {
 		return &restapi.InternalError{err}
 	}
 
+	res := TestSetChangeResponse{
+		UUID:            params.UUID,
+		TestSetRevision: revision,
+	}
+	return &restapi.Ok{&res}
+}
+
+func updateTestCase(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+
+	var params UpdateTestCaseRequest
+	err := req.ReadJSON(&params)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	weight, err := newTestCaseWeight(params.Weight)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	data, err := c.saveTestData(TestCase{Input: params.Input, Expected: params.Expected})
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	repo := NewBuilderRepository(db)
+	revision, err := repo.UpdateTestCase(UpdateTestCaseParams{
+		Key:          key,
+		Input:        data.Input,
+		Expected:     data.Expected,
+		InputHash:    data.InputHash,
+		ExpectedHash: data.ExpectedHash,
+		Group:        params.Group,
+		Weight:       weight,
+		Sample:       params.Sample,
+	})
+	if err == errTestCaseNotFound {
+		return &restapi.BadRequest{errors.Wrap(err, key)}
+	}
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	res := TestSetChangeResponse{
+		UUID:            key,
+		TestSetRevision: revision,
+	}
+	return &restapi.Ok{&res}
+}
+
+func deleteTestCase(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	revision, err := repo.DeleteTestCase(key)
+	if err == errTestCaseNotFound {
+		return &restapi.BadRequest{errors.Wrap(err, key)}
+	}
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	res := TestSetChangeResponse{
+		UUID:            key,
+		TestSetRevision: revision,
+	}
+	return &restapi.Ok{&res}
+}
+
+// getTestSet - returns assignment test set with revision given in URL, or the current one
+func getTestSet(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	assignmentID, err := repo.FindAssignmentID(key)
+	if err == errAssignmentNotFound {
+		return &restapi.NotFound{errors.Wrap(err, key)}
+	}
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	current, err := repo.GetTestSetRevision(assignmentID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	revision := current
+	if value := req.Var("revision"); len(value) != 0 {
+		revision, err = strconv.Atoi(value)
+		if err != nil || revision < 0 || revision > current {
+			return &restapi.BadRequest{errors.New("invalid test set revision '" + value + "'")}
+		}
+	}
+	cases, err := repo.GetTestCases(assignmentID, revision)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	groups, err := repo.GetTestGroups(assignmentID, revision)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	res := TestSetResponse{
+		Revision: revision,
+		Groups:   make([]TestGroupRequest, 0, len(groups)),
+		Tests:    make([]TestCaseResponse, 0, len(cases)),
+	}
+	for _, group := range groups {
+		res.Groups = append(res.Groups, TestGroupRequest{
+			Name:         group.Name,
+			Points:       group.Points,
+			Scoring:      group.Scoring,
+			Dependencies: group.Dependencies,
+		})
+	}
+	for _, testCase := range cases {
+		res.Tests = append(res.Tests, TestCaseResponse{
+			UUID:         testCase.Key,
+			Index:        testCase.Index,
+			Input:        testCase.Input,
+			Expected:     testCase.Expected,
+			InputHash:    testCase.InputHash,
+			ExpectedHash: testCase.ExpectedHash,
+			Group:        testCase.Group,
+			Weight:       testCase.Weight,
+			Sample:       testCase.Sample,
+		})
+	}
+	return &restapi.Ok{&res}
+}
+
+func setTestGroups(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+
+	var params SetTestGroupsRequest
+	err := req.ReadJSON(&params)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	groups := make([]TestGroup, 0, len(params.Groups))
+	for _, group := range params.Groups {
+		groups = append(groups, TestGroup{
+			Name:         group.Name,
+			Points:       group.Points,
+			Scoring:      group.Scoring,
+			Dependencies: group.Dependencies,
+		})
+	}
+	err = validateTestGroups(groups)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	assignmentID, err := repo.GetAssignmentID(key)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	revision, err := repo.SetTestGroups(assignmentID, groups)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	res := TestSetChangeResponse{
+		UUID:            key,
+		TestSetRevision: revision,
+	}
+	return &restapi.Ok{&res}
+}
+
+// importTestSet - replaces assignment tests with tests from ZIP archive sent as request body, see parseTestArchive
+func importTestSet(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+	key := req.Var("uuid")
+	if len(key) == 0 {
+		return &restapi.BadRequest{errors.New("missed 'uuid' request parameter")}
+	}
+
+	data, err := req.ReadBody(maxTestArchiveSize)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	archive, err := parseTestArchive(data, c.languages)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	if archive.Groups != nil {
+		err = validateTestGroups(archive.Groups)
+		if err != nil {
+			return &restapi.BadRequest{err}
+		}
+	}
+	if archive.TimeLimitMs < 0 || archive.MemoryLimitMB < 0 {
+		return &restapi.BadRequest{errors.New("archive limits cannot be negative")}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	assignmentID, err := repo.GetAssignmentID(key)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	params := ImportTestSetParams{
+		AssignmentID: assignmentID,
+		Groups:       archive.Groups,
+		Checker:      archive.Checker,
+	}
+	for _, testCase := range archive.Cases {
+		testKey, err := newRandomKey()
+		if err != nil {
+			return &restapi.InternalError{err}
+		}
+		testCase, err = c.saveTestData(testCase)
+		if err != nil {
+			return &restapi.InternalError{err}
+		}
+		params.Cases = append(params.Cases, RegisterTestCaseParams{
+			AssignmentID: assignmentID,
+			Key:          testKey,
+			Input:        testCase.Input,
+			Expected:     testCase.Expected,
+			InputHash:    testCase.InputHash,
+			ExpectedHash: testCase.ExpectedHash,
+			Group:        testCase.Group,
+			Weight:       testCase.Weight,
+			Sample:       testCase.Sample,
+		})
+	}
+	if archive.TimeLimitMs != 0 || archive.MemoryLimitMB != 0 {
+		limits, err := repo.GetAssignmentLimits(int(assignmentID))
+		if err != nil {
+			return &restapi.InternalError{err}
+		}
+		if archive.TimeLimitMs != 0 {
+			limits.TimeLimitMs = archive.TimeLimitMs
+		}
+		if archive.MemoryLimitMB != 0 {
+			limits.MemoryLimitMB = archive.MemoryLimitMB
+		}
+		params.Limits = limits
+	}
+
+	revision, err := repo.ImportTestSet(params)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	res := TestSetImportResponse{
+		UUID:            key,
+		TestSetRevision: revision,
+		Tests:           len(params.Cases),
+		Groups:          len(params.Groups),
+		LimitsUpdated:   params.Limits != nil,
+		CheckerUpdated:  params.Checker != nil,
+	}
+	return &restapi.Ok{&res}
+}
+
+// newTestCaseWeight - validates requested test weight, zero weight means default
+func newTestCaseWeight(weight int) (int, error) {
+	if weight < 0 {
+		return 0, errors.New("'weight' cannot be negative")
+	}
+	if weight == 0 {
+		return 1, nil
+	}
+	return weight, nil
+}
+
+func createAssignment(ctx interface{}, req restapi.Request) restapi.Response {
+	c := ctx.(*apiContext)
+
+	var params RegisterAssignmentRequest
+	err := req.ReadJSON(&params)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	limits, err := newAssignmentLimits(params)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	checker, err := newAssignmentChecker(params, c.languages)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+	assignmentIO, err := newAssignmentIO(params)
+	if err != nil {
+		return &restapi.BadRequest{err}
+	}
+
+	db, err := c.ConnectDB()
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	assignmentID, err := repo.GetAssignmentID(params.UUID)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
+	err = repo.SetAssignmentSettings(assignmentID, limits, checker, assignmentIO)
+	if err != nil {
+		return &restapi.InternalError{err}
+	}
+
 	res := RegisterResponse{
 		UUID: params.UUID,
 	}
 	return &restapi.Ok{&res}
 }
+
+// newAssignmentLimits - validates requested limits and replaces missed ones with defaults
+func newAssignmentLimits(params RegisterAssignmentRequest) (AssignmentLimits, error) {
+	limits := newDefaultAssignmentLimits()
+	values := []struct {
+		name   string
+		value  int
+		target *int
+	}{
+		{"time_limit_ms", params.TimeLimitMs, &limits.TimeLimitMs},
+		{"memory_limit_mb", params.MemoryLimitMB, &limits.MemoryLimitMB},
+		{"output_limit_kb", params.OutputLimitKB, &limits.OutputLimitKB},
+		{"stack_size_mb", params.StackSizeMB, &limits.StackSizeMB},
+	}
+	for _, v := range values {
+		if v.value < 0 {
+			return limits, errors.New("'" + v.name + "' cannot be negative")
+		}
+		if v.value != 0 {
+			*v.target = v.value
+		}
+	}
+	return limits, nil
+}
+
+// newAssignmentChecker - validates requested checker settings
+func newAssignmentChecker(params RegisterAssignmentRequest, languages *languageRegistry) (AssignmentChecker, error) {
+	checker := AssignmentChecker{
+		Kind:       params.Checker,
+		AbsEpsilon: params.CheckerAbsEpsilon,
+		RelEpsilon: params.CheckerRelEpsilon,
+	}
+	switch params.Checker {
+	case "":
+		checker.Kind = CheckerExact
+	case CheckerExact, CheckerTrailingSpace, CheckerTokens, CheckerCaseInsensitive, CheckerFloat:
+	case CheckerCustom, CheckerInteractor:
+		if len(params.CheckerSource) == 0 {
+			return checker, errors.New("missed 'checker_source' for " + string(params.Checker) + " checker")
+		}
+		if _, ok := languages.get(params.CheckerLanguage); !ok {
+			return checker, errors.New("unknown checker language '" + string(params.CheckerLanguage) + "'")
+		}
+		checker.Source = params.CheckerSource
+		checker.Language = params.CheckerLanguage
+	default:
+		return checker, errors.New("unknown checker '" + string(params.Checker) + "'")
+	}
+	if checker.AbsEpsilon < 0 || checker.RelEpsilon < 0 {
+		return checker, errors.New("checker epsilon cannot be negative")
+	}
+	return checker, nil
+}
+
+// newAssignmentIO - validates requested I/O mode and file names, replaces missed ones with defaults
+func newAssignmentIO(params RegisterAssignmentRequest) (AssignmentIO, error) {
+	assignmentIO := newDefaultAssignmentIO()
+	switch params.IOMode {
+	case "":
+	case IOStdio, IOFile:
+		assignmentIO.Mode = params.IOMode
+	default:
+		return assignmentIO, errors.New("unknown I/O mode '" + string(params.IOMode) + "'")
+	}
+	if len(params.InputFile) != 0 {
+		assignmentIO.InputFile = params.InputFile
+	}
+	if len(params.OutputFile) != 0 {
+		assignmentIO.OutputFile = params.OutputFile
+	}
+	for _, name := range []string{assignmentIO.InputFile, assignmentIO.OutputFile} {
+		err := validateIOFileName(name)
+		if err != nil {
+			return assignmentIO, err
+		}
+	}
+	if assignmentIO.InputFile == assignmentIO.OutputFile {
+		return assignmentIO, errors.New("input and output files cannot be the same")
+	}
+	return assignmentIO, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewAssignmentLimits(t *testing.T) {
+	limits, err := newAssignmentLimits(RegisterAssignmentRequest{TimeLimitMs: 3000, StackSizeMB: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := newDefaultAssignmentLimits()
+	want.TimeLimitMs = 3000
+	want.StackSizeMB = 8
+	if limits != want {
+		t.Errorf("got limits %+v, want %+v", limits, want)
+	}
+
+	_, err = newAssignmentLimits(RegisterAssignmentRequest{MemoryLimitMB: -1})
+	if err == nil {
+		t.Error("negative memory limit accepted")
+	}
+}
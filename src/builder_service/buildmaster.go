@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -9,62 +11,145 @@ import (
 	"ps-group/judgeevents"
 )
 
+// BuilderBuildRequestsQueue - prefix of the queue which receives BuildRequested events, each node has its own queue
+const BuilderBuildRequestsQueue = "BuilderBuildRequests"
+
 // BuildMaster - reads build tasks from database and passes them to the workers.
 type BuildMaster struct {
 	reports          chan BuildReport
+	wakeup           chan struct{}
 	stopWorkers      chan struct{}
-	stopListening    chan struct{}
+	listenerDone     chan struct{}
+	reaperDone       chan struct{}
 	workersWaitGroup *sync.WaitGroup
+	workerOptions    workerPoolOptions
 	generator        TaskGenerator
 	dbConnector      DatabaseConnector
 	events           judgeevents.BuilderEvents
+	nodeID           string
 }
 
 // NewBuildMaster - creates build master with given database
-func NewBuildMaster(dbConnector DatabaseConnector, events judgeevents.BuilderEvents) *BuildMaster {
+func NewBuildMaster(dbConnector DatabaseConnector, events judgeevents.BuilderEvents, runner processRunner, languages *languageRegistry, compiler *solutionCompiler, data *dataStore, nodeID string, workers WorkersConfig, maxReportSizeKB int) *BuildMaster {
 	var master BuildMaster
+	master.workerOptions = newWorkerPoolOptions(workers)
 	master.reports = make(chan BuildReport)
+	master.wakeup = make(chan struct{}, master.workerOptions.workers)
 	master.stopWorkers = make(chan struct{})
-	master.stopListening = make(chan struct{})
-	master.generator = newBuildTaskGenerator(dbConnector, master.reports)
+	master.listenerDone = make(chan struct{})
+	master.reaperDone = make(chan struct{})
+	master.generator = newBuildTaskGenerator(dbConnector, master.reports, runner, languages, compiler, data, nodeID, master.workerOptions.lease, maxReportSizeKB)
 	master.dbConnector = dbConnector
 	master.events = events
+	master.nodeID = nodeID
 
 	return &master
 }
 
 // RunWorkerPool - runs workers that accept tasks
 func (master *BuildMaster) RunWorkerPool() {
-	master.workersWaitGroup = RunWorkerPool(master.generator, master.stopWorkers)
+	logrus.WithField("workers", master.workerOptions.workers).Info("starting build workers")
 	go master.listenBuildReports()
+	go master.reapExpiredBuilds()
+	master.listenBuildRequests()
+	master.workersWaitGroup = RunWorkerPool(master.generator, master.workerOptions, master.wakeup, master.stopWorkers)
 }
 
-// Shutdown - stops all workers and closes channels
+// Shutdown - stops pulling new builds, waits until workers finish current builds
+// and their reports are saved, then closes channels
 func (master *BuildMaster) Shutdown() {
-	master.stopWorkers <- struct{}{}
-	master.stopListening <- struct{}{}
-	<-master.stopListening
+	close(master.stopWorkers)
+	master.events.Close()
 	master.workersWaitGroup.Wait()
+	<-master.reaperDone
 	close(master.reports)
-	close(master.stopWorkers)
-	close(master.stopListening)
+	<-master.listenerDone
+}
+
+// listenBuildRequests - wakes idle workers when new builds registered,
+// workers still poll database if events are not available
+func (master *BuildMaster) listenBuildRequests() {
+	queue := BuilderBuildRequestsQueue + "-" + master.nodeID
+	master.events.ConsumeBuildRequested(queue, func(event judgeevents.BuildRequestedEvent) {
+		for i := int64(0); i < event.Count || i == 0; i++ {
+			select {
+			case master.wakeup <- struct{}{}:
+			default:
+				// All workers are already woken up or busy, they pull pending builds anyway.
+				return
+			}
+		}
+	})
+	err := master.events.Error()
+	if err != nil {
+		logrus.WithField("error", err).Warn("cannot consume build requests, workers will poll database")
+	}
 }
 
 func (master *BuildMaster) listenBuildReports() {
+	defer close(master.listenerDone)
+	for report := range master.reports {
+		err := master.processBuildReport(report)
+		if err != nil {
+			logrus.Errorf("cannot process build report: %v", err)
+		}
+	}
+}
+
+// reapExpiredBuilds - periodically returns to queue builds which were claimed by crashed builders
+func (master *BuildMaster) reapExpiredBuilds() {
+	defer close(master.reaperDone)
+	ticker := time.NewTicker(master.workerOptions.lease / 2)
+	defer ticker.Stop()
 	for {
 		select {
-		case report := <-master.reports:
-			err := master.processBuildReport(report)
+		case <-master.stopWorkers:
+			return
+		case <-ticker.C:
+			err := master.requeueExpiredBuilds()
 			if err != nil {
-				logrus.Errorf("cannot process build report: %v", err)
+				logrus.Errorf("cannot requeue expired builds: %v", err)
 			}
-		case <-master.stopListening:
-			master.stopListening <- struct{}{}
-			return
 		}
 	}
 }
 
+// requeueExpiredBuilds - returns expired builds to queue, or fails them if attempts limit reached
+func (master *BuildMaster) requeueExpiredBuilds() error {
+	db, err := master.dbConnector.Connect()
+	if err != nil {
+		return errors.Wrap(err, "database connect failed")
+	}
+	defer db.Close()
+
+	repo := NewBuilderRepository(db)
+	builds, err := repo.GetExpiredBuilds()
+	if err != nil {
+		return err
+	}
+	for _, build := range builds {
+		if build.Attempts >= master.workerOptions.maxAttempts {
+			logrus.WithField("uuid", build.Key).WithField("attempts", build.Attempts).Warn("build lease expired, attempts limit reached")
+			err = master.processBuildReport(BuildReport{
+				Key:        build.Key,
+				ClaimToken: build.ClaimToken,
+				Status:     StatusException,
+				Exception:  fmt.Sprintf("build abandoned: builder lease expired %d times", build.Attempts),
+			})
+		} else {
+			var requeued bool
+			requeued, err = repo.RequeueBuild(build)
+			if requeued {
+				logrus.WithField("uuid", build.Key).WithField("attempts", build.Attempts).Warn("build lease expired, build returned to queue")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (master *BuildMaster) processBuildReport(report BuildReport) error {
 	db, err := master.dbConnector.Connect()
 	if err != nil {
@@ -74,6 +159,10 @@ func (master *BuildMaster) processBuildReport(report BuildReport) error {
 
 	repo := NewBuilderRepository(db)
 	err = repo.AddBuildReport(report)
+	if err == errBuildClaimLost {
+		logrus.WithField("uuid", report.Key).Warn("build report dropped: build was returned to queue or finished by another builder")
+		return nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "cannot add build report")
 	}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"ps-group/judgeevents"
+)
+
+// fakeConnector - connects to the fake database
+type fakeConnector struct {
+	db *sql.DB
+}
+
+func (c *fakeConnector) Connect() (*sql.DB, error) {
+	return c.db, nil
+}
+
+func TestRequeueExpiredBuilds(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT `key`, `claim_token`, `attempts` FROM build", fakeQueryResult{
+		columns: []string{"key", "claim_token", "attempts"},
+		rows:    [][]driver.Value{{"first", "token-1", int64(1)}, {"second", "token-2", int64(2)}},
+	})
+	database.expect("UPDATE build SET `status`='pending'", fakeQueryResult{rowsAffected: 1})
+	master := &BuildMaster{dbConnector: &fakeConnector{db}, workerOptions: newWorkerPoolOptions(WorkersConfig{MaxAttempts: 3})}
+
+	err := master.requeueExpiredBuilds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requeued := database.executed("UPDATE build SET `status`='pending'")
+	if len(requeued) != 2 {
+		t.Fatalf("got %d builds returned to queue, want 2", len(requeued))
+	}
+	for i, build := range []ExpiredBuild{{"first", "token-1", 1}, {"second", "token-2", 2}} {
+		// Build is returned to queue only if it's still claimed with the expired token.
+		if requeued[i].args[0] != build.Key || requeued[i].args[1] != build.ClaimToken {
+			t.Errorf("got requeue arguments %v, want %s and %s", requeued[i].args, build.Key, build.ClaimToken)
+		}
+	}
+	database.checkRowsClosed(t)
+}
+
+func TestGetExpiredBuildsClosesRowsOnError(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT `key`, `claim_token`, `attempts` FROM build", fakeQueryResult{
+		columns: []string{"key", "claim_token", "attempts"},
+		rows:    [][]driver.Value{{"first", "token-1", "not a number"}, {"second", "token-2", int64(2)}},
+	})
+	_, err := NewBuilderRepository(db).GetExpiredBuilds()
+	if err == nil {
+		t.Fatal("scan error is not reported")
+	}
+	database.checkRowsClosed(t)
+}
+
+// fakeBuilderEvents - keeps BuildRequested callback, so test can send events without RabbitMQ
+type fakeBuilderEvents struct {
+	judgeevents.BuilderEvents
+	queue          string
+	buildRequested judgeevents.BuildRequestedCallback
+}
+
+func (e *fakeBuilderEvents) ConsumeBuildRequested(queue string, cb judgeevents.BuildRequestedCallback) {
+	e.queue = queue
+	e.buildRequested = cb
+}
+
+func (e *fakeBuilderEvents) Error() error {
+	return nil
+}
+
+func TestListenBuildRequestsWakesWorkers(t *testing.T) {
+	events := new(fakeBuilderEvents)
+	master := &BuildMaster{events: events, nodeID: "node-1", wakeup: make(chan struct{}, 2)}
+	master.listenBuildRequests()
+	if events.queue != BuilderBuildRequestsQueue+"-node-1" {
+		t.Errorf("got queue %q, each node should have its own queue", events.queue)
+	}
+
+	events.buildRequested(judgeevents.BuildRequestedEvent{Key: "build"})
+	if len(master.wakeup) != 1 {
+		t.Errorf("event without count woke %d workers, want 1", len(master.wakeup))
+	}
+	// Event for more builds than idle workers does not block consumer.
+	events.buildRequested(judgeevents.BuildRequestedEvent{Count: 5})
+	if len(master.wakeup) != 2 {
+		t.Errorf("got %d wakeup signals, want 2", len(master.wakeup))
+	}
+}
@@ -2,65 +2,178 @@ package main
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// leaseProlongRatio - worker prolongs build lease this number of times per lease duration
+	leaseProlongRatio      = 3
+	defaultMaxReportSizeKB = 1024
+)
+
 type buildTask struct {
-	language language
-	source   string
-	key      string
-	cases    []TestCase
-	reports  chan BuildReport
+	languages  *languageRegistry
+	compiler   *solutionCompiler
+	language   language
+	source     string
+	sourceHash string
+	key        string
+	cases      []TestCase
+	data       *dataStore
+	groups     []TestGroup
+	testSetRev int
+	mode       JudgingMode
+	reports    chan BuildReport
+	runner     processRunner
+	limits     *processLimits
+	checker    AssignmentChecker
+	io         AssignmentIO
+	connector  DatabaseConnector
+	claimToken string
+	lease      time.Duration
+	// maxReportSize - max total size of logs and test outputs saved with report, in bytes
+	maxReportSize int
 }
 
-func (t *buildTask) Run(workerID int) error {
-	workdir := fmt.Sprintf("builder_%d", workerID)
-	logrus.WithField("uuid", t.key).Info("running build")
-	result := buildSolution(t.source, t.language, t.cases, workdir)
+func (t *buildTask) Run(workerID int, workdir string) error {
+	logrus.WithField("uuid", t.key).WithField("worker", workerID).Info("running build")
+	stopHeartbeat := t.startHeartbeat()
+	defer close(stopHeartbeat)
+	var result BuildResult
+	source, err := t.data.load(t.source, t.sourceHash)
+	if err != nil {
+		result.internalError = err
+	} else {
+		result = buildSolution(t.runner, t.languages, t.compiler, source, t.language, t.cases, t.data, t.limits, t.checker, t.io, t.mode, workdir)
+	}
 	report := t.createBuildReport(result)
 	t.reports <- report
 	return nil
 }
 
+// startHeartbeat - prolongs build lease until returned channel closed,
+// so other builders don't take this build while it's running
+func (t *buildTask) startHeartbeat() chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(t.lease / leaseProlongRatio)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := t.prolongLease()
+				if err != nil {
+					logrus.WithField("uuid", t.key).WithField("error", err).Warn("cannot prolong build lease")
+				}
+			}
+		}
+	}()
+	return stop
+}
+
+func (t *buildTask) prolongLease() error {
+	db, err := t.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return NewBuilderRepository(db).ProlongBuildLease(t.claimToken, t.lease)
+}
+
 type buildTaskGenerator struct {
 	connector DatabaseConnector
 	reports   chan BuildReport
+	runner    processRunner
+	languages *languageRegistry
+	compiler  *solutionCompiler
+	data      *dataStore
+	nodeID    string
+	lease     time.Duration
+	// maxReportSize - max total size of logs and test outputs saved with report, in bytes
+	maxReportSize int
 }
 
 func (t *buildTask) createBuildReport(result BuildResult) BuildReport {
 	var report BuildReport
 	report.Key = t.key
+	report.ClaimToken = t.claimToken
+	report.TestSetRevision = t.testSetRev
+	report.CheckerRevision = t.checker.Revision
+	report.Mode = t.mode
 	if result.internalError != nil {
 		report.Exception = result.internalError.Error()
 		report.Status = StatusException
 	} else if result.buildError != nil {
 		report.BuildLog = result.buildError.Error()
+		report.Diagnostics = result.diagnostics
 		report.Status = StatusFailed
+		if result.compileTimeout {
+			report.Status = StatusCompilationTimeout
+		}
 	} else {
 		report.Status = StatusSucceed
-		report.TestsTotal = int64(len(result.testCaseErrors))
+		report.BuildLog = result.compileLog
+		report.Diagnostics = result.diagnostics
+		// Tests skipped after the first failure are counted as not passed.
+		report.TestsTotal = int64(len(t.cases))
 		report.TestsPassed = 0
-		for i, err := range result.testCaseErrors {
-			if err == nil {
+		report.TestResults = result.testResults
+		report.GroupResults = scoreTestGroups(t.groups, t.cases, result.testResults)
+		for i, testResult := range result.testResults {
+			if testResult.Accepted() {
 				report.TestsPassed++
 			} else {
-				report.TestsLog += fmt.Sprintf("--- FAILURE IN TEST %d ---\n%s\n", i, err.Error())
+				report.TestsLog += fmt.Sprintf("--- FAILURE IN TEST %d (%s) ---\n%s\n", i, testResult.Verdict, testResult.Message)
 			}
 		}
+		if skipped := len(t.cases) - len(result.testResults); skipped > 0 {
+			report.TestsLog += fmt.Sprintf("--- %d TESTS SKIPPED AFTER FIRST FAILURE ---\n", skipped)
+		}
 	}
+	limitReportSize(&report, t.maxReportSize)
 	return report
 }
 
-func newBuildTaskGenerator(connector DatabaseConnector, reports chan BuildReport) *buildTaskGenerator {
+// limitReportSize - truncates logs and test outputs, so text saved with report fits maxSize bytes.
+// Exception, build log and tests log get up to a quarter of the limit each, test outputs and messages share the rest in test order.
+func limitReportSize(report *BuildReport, maxSize int) {
+	report.Exception = truncateToSize(report.Exception, maxSize/4)
+	report.BuildLog = truncateToSize(report.BuildLog, maxSize/4)
+	report.TestsLog = truncateToSize(report.TestsLog, maxSize/4)
+	remaining := maxSize - len(report.Exception) - len(report.BuildLog) - len(report.TestsLog)
+	for i := range report.TestResults {
+		result := &report.TestResults[i]
+		for _, output := range []*string{&result.Stdout, &result.Stderr, &result.Message} {
+			*output = truncateToSize(*output, remaining)
+			remaining -= len(*output)
+		}
+	}
+}
+
+func newBuildTaskGenerator(connector DatabaseConnector, reports chan BuildReport, runner processRunner, languages *languageRegistry, compiler *solutionCompiler, data *dataStore, nodeID string, lease time.Duration, maxReportSizeKB int) *buildTaskGenerator {
 	var generator buildTaskGenerator
 	generator.connector = connector
 	generator.reports = reports
+	generator.runner = runner
+	generator.languages = languages
+	generator.compiler = compiler
+	generator.data = data
+	generator.nodeID = nodeID
+	generator.lease = lease
+	if maxReportSizeKB == 0 {
+		maxReportSizeKB = defaultMaxReportSizeKB
+	}
+	generator.maxReportSize = maxReportSizeKB * 1024
 
 	return &generator
 }
 
-func (g *buildTaskGenerator) Next() (bool, Task) {
+func (g *buildTaskGenerator) Next(workerID int) (bool, Task) {
 	db, err := g.connector.Connect()
 	if err != nil {
 		logrus.WithField("error", err).Error("database connect failed")
@@ -68,7 +181,7 @@ func (g *buildTaskGenerator) Next() (bool, Task) {
 	}
 	defer db.Close()
 	repo := NewBuilderRepository(db)
-	build, err := repo.PullPendingBuild()
+	build, err := repo.PullPendingBuild(g.nodeID, workerID, g.lease)
 	if err != nil {
 		logrus.WithField("error", err).Error("read task from database failed")
 		return false, nil
@@ -76,16 +189,61 @@ func (g *buildTaskGenerator) Next() (bool, Task) {
 	if build == nil {
 		return false, nil
 	}
-	cases, err := repo.GetTestCases(build.AssignmentID)
+	task, err := g.newTask(repo, build)
 	if err != nil {
-		logrus.WithField("error", err).Error("cannot read test cases")
+		logrus.WithField("uuid", build.Key).WithField("error", err).Error("cannot read build task")
+		// Build returns to queue at once instead of waiting for expired lease.
+		_, err = repo.RequeueBuild(ExpiredBuild{Key: build.Key, ClaimToken: build.ClaimToken})
+		if err != nil {
+			logrus.WithField("uuid", build.Key).WithField("error", err).Error("cannot return build to queue")
+		}
 		return false, nil
 	}
+	return true, task
+}
+
+// newTask - reads tests and assignment settings of the claimed build
+func (g *buildTaskGenerator) newTask(repo *BuilderRepository, build *PendingBuildResult) (*buildTask, error) {
+	cases, err := repo.GetTestCases(int64(build.AssignmentID), build.TestSetRevision)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read test cases")
+	}
+	groups, err := repo.GetTestGroups(int64(build.AssignmentID), build.TestSetRevision)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read test groups")
+	}
+	limits, err := repo.GetAssignmentLimits(build.AssignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read assignment limits")
+	}
+	checker, err := repo.GetAssignmentChecker(build.AssignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read assignment checker")
+	}
+	assignmentIO, err := repo.GetAssignmentIO(build.AssignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read assignment I/O settings")
+	}
 	var task buildTask
 	task.language = build.Language
 	task.source = build.Source
+	task.sourceHash = build.SourceHash
 	task.key = build.Key
-	task.cases = cases
+	task.cases = selectTestCases(build.Mode, cases)
+	task.groups = groups
+	task.testSetRev = build.TestSetRevision
+	task.mode = build.Mode
 	task.reports = g.reports
-	return true, &task
+	task.runner = g.runner
+	task.languages = g.languages
+	task.compiler = g.compiler
+	task.data = g.data
+	task.limits = newProcessLimits(*limits)
+	task.checker = *checker
+	task.io = *assignmentIO
+	task.connector = g.connector
+	task.claimToken = build.ClaimToken
+	task.lease = g.lease
+	task.maxReportSize = g.maxReportSize
+	return &task, nil
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLimitReportSizeTruncatesException(t *testing.T) {
+	report := BuildReport{Exception: "cannot compile checker: " + strings.Repeat("error: expected ';'\n", 1000)}
+	limitReportSize(&report, 4096)
+	if len(report.Exception) != 1024 || !strings.HasPrefix(report.Exception, "cannot compile checker: ") {
+		t.Fatalf("got %d bytes of exception, want first 1024 bytes", len(report.Exception))
+	}
+}
+
+func TestLimitReportSizeSharesRestBetweenTests(t *testing.T) {
+	report := BuildReport{
+		BuildLog: strings.Repeat("b", 2000),
+		TestsLog: strings.Repeat("t", 100),
+		TestResults: []TestResult{
+			{Stdout: strings.Repeat("1", 1500), Stderr: "warning", Message: "wrong answer"},
+			{Stdout: strings.Repeat("2", 1500), Stderr: strings.Repeat("e", 1000)},
+			{Stdout: "3", Message: "wrong answer"},
+		},
+	}
+	limitReportSize(&report, 4096)
+
+	if len(report.BuildLog) != 1024 || len(report.TestsLog) != 100 {
+		t.Errorf("got build log %d bytes, tests log %d bytes", len(report.BuildLog), len(report.TestsLog))
+	}
+	size := len(report.BuildLog) + len(report.TestsLog)
+	for _, result := range report.TestResults {
+		size += len(result.Stdout) + len(result.Stderr) + len(result.Message)
+	}
+	if size > 4096 {
+		t.Errorf("report has %d bytes, want at most 4096", size)
+	}
+	first := report.TestResults[0]
+	if len(first.Stdout) != 1500 || first.Stderr != "warning" || first.Message != "wrong answer" {
+		t.Errorf("first test output which fits limit is truncated")
+	}
+	second := report.TestResults[1]
+	if len(second.Stdout) != 4096-1124-1500-len("warning")-len("wrong answer") || !strings.HasSuffix(second.Stdout, truncatedMarker) {
+		t.Errorf("second test output is not truncated to the rest of the limit: %d bytes", len(second.Stdout))
+	}
+	if second.Stderr != "" || report.TestResults[2].Stdout != "" || report.TestResults[2].Message != "" {
+		t.Errorf("outputs after the limit are not dropped")
+	}
+}
+
+func TestCompilationTimeoutStatus(t *testing.T) {
+	task := &buildTask{maxReportSize: 4096}
+	report := task.createBuildReport(BuildResult{buildError: errors.New("compilation failed: time limit exceeded"), compileTimeout: true})
+	if report.Status != StatusCompilationTimeout {
+		t.Errorf("got status %s", report.Status)
+	}
+	report = task.createBuildReport(BuildResult{buildError: errors.New("compilation failed: exit status 1")})
+	if report.Status != StatusFailed {
+		t.Errorf("got status %s", report.Status)
+	}
+}
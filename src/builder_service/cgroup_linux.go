@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultCgroupRoot = "/sys/fs/cgroup/psjudge"
+	// cgroupCPUPeriod - period for cpu.max, in microseconds
+	cgroupCPUPeriod     = 100000
+	cgroupDestroyTries  = 10
+	cgroupDestroyPause  = 10 * time.Millisecond
+	cgroupControllers   = "+cpu +memory +pids"
+	cgroupNameFormat    = "run-%d-%d"
+	cgroupStatUsageUsec = "usage_usec"
+	cgroupEventOOMKill  = "oom_kill"
+	// cgroup2SuperMagic - CGROUP2_SUPER_MAGIC from linux/magic.h
+	cgroup2SuperMagic = 0x63677270
+	// cgroupInitPids - pids.max while sandbox init prepares sandbox, Go runtime of the init starts several threads.
+	// Sandbox init lowers the limit to the process limit right before exec.
+	cgroupInitPids = 64
+)
+
+// cgroupManager - creates cgroup v2 groups for each sandboxed process.
+// Builder user must own the root cgroup directory (see cgroup v2 delegation).
+type cgroupManager struct {
+	root    string
+	counter uint64
+}
+
+// cgroup - cgroup v2 group which holds one sandboxed process tree
+type cgroup struct {
+	path string
+}
+
+// cgroupStats - resources used by all processes in the cgroup
+type cgroupStats struct {
+	CPUTime   time.Duration
+	MemoryKB  int64
+	OOMKilled bool
+}
+
+func newCgroupManager(root string) (*cgroupManager, error) {
+	if len(root) == 0 {
+		root = defaultCgroupRoot
+	}
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(filepath.Dir(root), &stat)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot stat cgroup root parent")
+	}
+	if stat.Type != cgroup2SuperMagic {
+		return nil, errors.New("cgroup v2 is not mounted at " + filepath.Dir(root))
+	}
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create cgroup root")
+	}
+	err = writeCgroupFile(root, "cgroup.subtree_control", cgroupControllers)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot enable cgroup controllers")
+	}
+
+	manager := new(cgroupManager)
+	manager.root = root
+	return manager, nil
+}
+
+// create - creates new cgroup with given limits
+func (m *cgroupManager) create(limits *processLimits) (*cgroup, error) {
+	name := fmt.Sprintf(cgroupNameFormat, os.Getpid(), atomic.AddUint64(&m.counter, 1))
+	path := filepath.Join(m.root, name)
+	err := os.Mkdir(path, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create cgroup")
+	}
+	group := &cgroup{path: path}
+
+	pids := limits.NumberOfProc
+	if pids < cgroupInitPids {
+		pids = cgroupInitPids
+	}
+	settings := []struct {
+		name  string
+		value string
+	}{
+		{"memory.max", strconv.Itoa(limits.AddessSpaceMB * 1024 * 1024)},
+		{"pids.max", strconv.Itoa(pids)},
+		{"cpu.max", fmt.Sprintf("%d %d", cgroupCPUPeriod, cgroupCPUPeriod)},
+	}
+	for _, setting := range settings {
+		err = writeCgroupFile(path, setting.name, setting.value)
+		if err != nil {
+			group.destroy()
+			return nil, err
+		}
+	}
+	// Swap accounting can be disabled on host, it's not an error.
+	writeCgroupFile(path, "memory.swap.max", "0")
+
+	return group, nil
+}
+
+// addProcess - moves process with given PID into the cgroup
+func (g *cgroup) addProcess(pid int) error {
+	return writeCgroupFile(g.path, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// openPidsLimit - opens pids.max for writing, so limit can be changed from inside the sandbox
+func (g *cgroup) openPidsLimit() (*os.File, error) {
+	file, err := os.OpenFile(filepath.Join(g.path, "pids.max"), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open cgroup file pids.max")
+	}
+	return file, nil
+}
+
+// stats - reads resources usage, should be called after process exit
+func (g *cgroup) stats() (*cgroupStats, error) {
+	var stats cgroupStats
+	usage, err := readCgroupKeyValue(g.path, "cpu.stat", cgroupStatUsageUsec)
+	if err != nil {
+		return nil, err
+	}
+	stats.CPUTime = time.Duration(usage) * time.Microsecond
+
+	oomKills, err := readCgroupKeyValue(g.path, "memory.events", cgroupEventOOMKill)
+	if err != nil {
+		return nil, err
+	}
+	stats.OOMKilled = oomKills > 0
+
+	// memory.peak appeared in Linux 5.19, use rusage on older kernels.
+	peak, err := ioutil.ReadFile(filepath.Join(g.path, "memory.peak"))
+	if err == nil {
+		bytes, err := strconv.ParseInt(strings.TrimSpace(string(peak)), 10, 64)
+		if err == nil {
+			stats.MemoryKB = bytes / 1024
+		}
+	}
+	return &stats, nil
+}
+
+// destroy - kills all processes in cgroup and removes it
+func (g *cgroup) destroy() error {
+	var err error
+	for i := 0; i < cgroupDestroyTries; i++ {
+		err = syscall.Rmdir(g.path)
+		if err != syscall.EBUSY {
+			break
+		}
+		// cgroup.kill appeared in Linux 5.14, processes usually die with sandbox init anyway.
+		writeCgroupFile(g.path, "cgroup.kill", "1")
+		time.Sleep(cgroupDestroyPause)
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot remove cgroup "+g.path)
+	}
+	return nil
+}
+
+func writeCgroupFile(dir string, name string, value string) error {
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+	if err != nil {
+		return errors.Wrap(err, "cannot write cgroup file "+name)
+	}
+	return nil
+}
+
+// readCgroupKeyValue - reads value from flat keyed file like cpu.stat or memory.events
+func readCgroupKeyValue(dir string, name string, key string) (int64, error) {
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot read cgroup file "+name)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CheckerKind - algorithm used to compare solution output with expected answer
+type CheckerKind string
+
+const (
+	CheckerExact           CheckerKind = "exact"
+	CheckerTrailingSpace   CheckerKind = "trailing_whitespace"
+	CheckerTokens          CheckerKind = "tokens"
+	CheckerCaseInsensitive CheckerKind = "case_insensitive"
+	CheckerFloat           CheckerKind = "float"
+	CheckerCustom          CheckerKind = "custom"
+	// CheckerInteractor - testlib-compatible interactor talks with solution, see interactor.go
+	CheckerInteractor CheckerKind = "interactor"
+)
+
+// Exit codes of testlib-compatible checker program
+const (
+	testlibExitOK                = 0
+	testlibExitWrongAnswer       = 1
+	testlibExitPresentationError = 2
+	testlibExitFail              = 3
+	testlibExitDirt              = 4
+)
+
+const (
+	checkerTimeLimitMs   = 10000
+	checkerMemoryLimitMB = 512
+	checkerMaxOpenFiles  = 16
+	// checkerFileSizeLimitKB - max size of the file written by checker, checkers usually write nothing
+	checkerFileSizeLimitKB = 1024
+	checkerInputFile       = "input.txt"
+	checkerOutputFile      = "output.txt"
+	checkerAnswerFile      = "answer.txt"
+	checkerName            = "checker"
+	checkerMessageLimit    = 1024
+)
+
+// Checker - compares solution output with expected answer.
+// Returned error means checker failure, while wrong output is reported with verdict.
+type Checker interface {
+	Check(input string, output string, expected string) (Verdict, string, error)
+}
+
+// exactChecker - requires byte-for-byte equal output
+type exactChecker struct {
+}
+
+func (c *exactChecker) Check(input string, output string, expected string) (Verdict, string, error) {
+	if output != expected {
+		return VerdictWrongAnswer, "output does not match expected", nil
+	}
+	return VerdictAccepted, "", nil
+}
+
+// trailingSpaceChecker - compares output line by line ignoring trailing whitespace
+// on each line and trailing empty lines
+type trailingSpaceChecker struct {
+}
+
+func (c *trailingSpaceChecker) Check(input string, output string, expected string) (Verdict, string, error) {
+	outputLines := splitTrimmedLines(output)
+	expectedLines := splitTrimmedLines(expected)
+	if len(outputLines) != len(expectedLines) {
+		return VerdictWrongAnswer, fmt.Sprintf("expected %d lines, found %d", len(expectedLines), len(outputLines)), nil
+	}
+	for i := range expectedLines {
+		if outputLines[i] != expectedLines[i] {
+			return VerdictWrongAnswer, fmt.Sprintf("line %d differs", i+1), nil
+		}
+	}
+	return VerdictAccepted, "", nil
+}
+
+func splitTrimmedLines(text string) []string {
+	lines := strings.Split(strings.TrimRight(text, " \t\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+	}
+	return lines
+}
+
+// tokensChecker - compares whitespace-separated tokens with given comparison function
+type tokensChecker struct {
+	equal func(outputToken string, expectedToken string) bool
+}
+
+func (c *tokensChecker) Check(input string, output string, expected string) (Verdict, string, error) {
+	outputTokens := strings.Fields(output)
+	expectedTokens := strings.Fields(expected)
+	for i, expectedToken := range expectedTokens {
+		if i >= len(outputTokens) {
+			return VerdictWrongAnswer, fmt.Sprintf("expected %d tokens, found %d", len(expectedTokens), len(outputTokens)), nil
+		}
+		if !c.equal(outputTokens[i], expectedToken) {
+			return VerdictWrongAnswer, fmt.Sprintf("token %d differs: expected '%s', found '%s'", i+1, expectedToken, outputTokens[i]), nil
+		}
+	}
+	if len(outputTokens) > len(expectedTokens) {
+		return VerdictWrongAnswer, fmt.Sprintf("expected %d tokens, found %d", len(expectedTokens), len(outputTokens)), nil
+	}
+	return VerdictAccepted, "", nil
+}
+
+// newFloatTokenComparator - compares tokens as floating-point numbers with absolute or relative error,
+// tokens which are not numbers should be equal
+func newFloatTokenComparator(absEpsilon float64, relEpsilon float64) func(string, string) bool {
+	return func(outputToken string, expectedToken string) bool {
+		expectedValue, err := strconv.ParseFloat(expectedToken, 64)
+		if err != nil {
+			return outputToken == expectedToken
+		}
+		outputValue, err := strconv.ParseFloat(outputToken, 64)
+		if err != nil || math.IsNaN(outputValue) {
+			return false
+		}
+		diff := math.Abs(outputValue - expectedValue)
+		return diff <= absEpsilon || diff <= relEpsilon*math.Abs(expectedValue)
+	}
+}
+
+// customChecker - runs testlib-compatible checker program in the sandbox: checker <input> <output> <answer>
+type customChecker struct {
+	runner  processRunner
+	command []string
+	workdir string
+}
+
+// newCheckerLimits - limits of the checker program, they don't depend on the assignment limits
+func newCheckerLimits() *processLimits {
+	limits := new(processLimits)
+	limits.NumberOfFiles = checkerMaxOpenFiles
+	limits.NumberOfProc = 1
+	limits.NumberOfLocks = 8
+	limits.TimeLimitMs = checkerTimeLimitMs
+	limits.AddessSpaceMB = checkerMemoryLimitMB
+	limits.OutputLimitKB = checkerFileSizeLimitKB
+	limits.StackSizeMB = defaultStackSizeMB
+	// Checker does not wait for input, so wall clock time is limited as well as CPU time.
+	limits.WallTimeRatio = 1
+	return limits
+}
+
+func (c *customChecker) Check(input string, output string, expected string) (Verdict, string, error) {
+	files := []struct {
+		name    string
+		content string
+	}{
+		{checkerInputFile, input},
+		{checkerOutputFile, output},
+		{checkerAnswerFile, expected},
+	}
+	// Files of the test are removed after check, so they are never left for the next solution run.
+	defer func() {
+		for _, file := range files {
+			os.Remove(filepath.Join(c.workdir, file.name))
+		}
+	}()
+	for _, file := range files {
+		err := ioutil.WriteFile(filepath.Join(c.workdir, file.name), []byte(file.content), 0644)
+		if err != nil {
+			return "", "", errors.Wrap(err, "cannot write checker file")
+		}
+	}
+
+	options := processRunOptions{
+		workdir:         c.workdir,
+		limits:          newCheckerLimits(),
+		writableWorkdir: true,
+		// Checker output is only used as message, so it is truncated without stopping checker.
+		logLimit: checkerMessageLimit,
+	}
+	args := append([]string{}, c.command[1:]...)
+	args = append(args, checkerInputFile, checkerOutputFile, checkerAnswerFile)
+	result, err := c.runner.Run(options, c.command[0], args...)
+	if err != nil {
+		return "", "", errors.Wrap(err, "cannot run checker")
+	}
+	message := truncateOutput(bytes.TrimSpace(result.Stderr), checkerMessageLimit)
+	if result.Signal != 0 || result.WallTimeExceeded || result.OOMKilled {
+		return "", "", errors.New("checker failed: " + result.Describe())
+	}
+	switch result.ExitCode {
+	case testlibExitOK:
+		return VerdictAccepted, message, nil
+	case testlibExitWrongAnswer, testlibExitDirt:
+		return VerdictWrongAnswer, message, nil
+	case testlibExitPresentationError:
+		return VerdictWrongAnswer, "presentation error: " + message, nil
+	case testlibExitFail:
+		return "", "", errors.New("checker failed: " + message)
+	}
+	return "", "", errors.Errorf("checker failed with unexpected exit status %d: %s", result.ExitCode, message)
+}
+
+// newChecker - creates checker selected for the assignment, compiles custom checker in workdir
+func newChecker(config AssignmentChecker, runner processRunner, languages *languageRegistry, compiler *solutionCompiler, workdir string) (Checker, error) {
+	switch config.Kind {
+	case "", CheckerExact:
+		return new(exactChecker), nil
+	case CheckerTrailingSpace:
+		return new(trailingSpaceChecker), nil
+	case CheckerTokens:
+		return &tokensChecker{func(a string, b string) bool { return a == b }}, nil
+	case CheckerCaseInsensitive:
+		return &tokensChecker{strings.EqualFold}, nil
+	case CheckerFloat:
+		return &tokensChecker{newFloatTokenComparator(config.AbsEpsilon, config.RelEpsilon)}, nil
+	case CheckerCustom:
+		return newCustomChecker(config, runner, languages, compiler, workdir)
+	}
+	return nil, errors.New("unknown checker '" + string(config.Kind) + "'")
+}
+
+func newCustomChecker(config AssignmentChecker, runner processRunner, languages *languageRegistry, compiler *solutionCompiler, workdir string) (Checker, error) {
+	command, checkerWorkdir, err := compileAuthorProgram(config, languages, compiler, workdir, checkerName)
+	if err != nil {
+		return nil, err
+	}
+	return &customChecker{
+		runner:  runner,
+		command: command,
+		workdir: checkerWorkdir,
+	}, nil
+}
+
+// compileAuthorProgram - compiles checker or interactor source in its own directory inside workdir,
+// returns run command and program directory
+func compileAuthorProgram(config AssignmentChecker, languages *languageRegistry, compiler *solutionCompiler, workdir string, name string) ([]string, string, error) {
+	language, ok := languages.get(config.Language)
+	if !ok {
+		return nil, "", errors.New(name + " language '" + string(config.Language) + "' is not enabled on builder")
+	}
+	programWorkdir := filepath.Join(workdir, name)
+	err := os.MkdirAll(programWorkdir, os.ModePerm)
+	if err != nil {
+		return nil, "", err
+	}
+	files, err := newLanguageFiles(language, programWorkdir, name)
+	if err != nil {
+		return nil, "", err
+	}
+	err = ioutil.WriteFile(files.source, []byte(config.Source), os.ModePerm)
+	if err != nil {
+		return nil, "", err
+	}
+	compiled, err := compiler.compile(language, files)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot compile "+name)
+	}
+	if compiled.failure != nil {
+		return nil, "", errors.Wrap(compiled.failure, "cannot compile "+name)
+	}
+	return language.runCommand(files), programWorkdir, nil
+}
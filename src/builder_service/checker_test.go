@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinCheckers(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   AssignmentChecker
+		output   string
+		expected string
+		verdict  Verdict
+	}{
+		{"exact equal", AssignmentChecker{Kind: CheckerExact}, "1 2\n", "1 2\n", VerdictAccepted},
+		{"exact trailing space", AssignmentChecker{Kind: CheckerExact}, "1 2 \n", "1 2\n", VerdictWrongAnswer},
+		{"default is exact", AssignmentChecker{}, "1 2", "1 2\n", VerdictWrongAnswer},
+		{"trailing whitespace", AssignmentChecker{Kind: CheckerTrailingSpace}, "1 2  \r\n\n\n", "1 2\n", VerdictAccepted},
+		{"trailing whitespace inner space", AssignmentChecker{Kind: CheckerTrailingSpace}, "1  2\n", "1 2\n", VerdictWrongAnswer},
+		{"trailing whitespace extra line", AssignmentChecker{Kind: CheckerTrailingSpace}, "1 2\n3\n", "1 2\n", VerdictWrongAnswer},
+		{"tokens", AssignmentChecker{Kind: CheckerTokens}, "1\n  2\t3", "1 2 3\n", VerdictAccepted},
+		{"tokens missing", AssignmentChecker{Kind: CheckerTokens}, "1 2", "1 2 3\n", VerdictWrongAnswer},
+		{"tokens extra", AssignmentChecker{Kind: CheckerTokens}, "1 2 3 4", "1 2 3\n", VerdictWrongAnswer},
+		{"tokens case", AssignmentChecker{Kind: CheckerTokens}, "YES", "yes\n", VerdictWrongAnswer},
+		{"case insensitive", AssignmentChecker{Kind: CheckerCaseInsensitive}, "YES\nNo", "yes no\n", VerdictAccepted},
+		{"case insensitive differs", AssignmentChecker{Kind: CheckerCaseInsensitive}, "yes", "no\n", VerdictWrongAnswer},
+		{"float absolute", AssignmentChecker{Kind: CheckerFloat, AbsEpsilon: 1e-3}, "0.3334", "0.3333\n", VerdictAccepted},
+		{"float absolute exceeded", AssignmentChecker{Kind: CheckerFloat, AbsEpsilon: 1e-6}, "0.3334", "0.3333\n", VerdictWrongAnswer},
+		{"float relative", AssignmentChecker{Kind: CheckerFloat, RelEpsilon: 1e-6}, "1000000.5", "1000000\n", VerdictAccepted},
+		{"float not a number", AssignmentChecker{Kind: CheckerFloat, AbsEpsilon: 1}, "nan", "0\n", VerdictWrongAnswer},
+		{"float words", AssignmentChecker{Kind: CheckerFloat, AbsEpsilon: 1e-3}, "answer 1.0001", "answer 1\n", VerdictAccepted},
+	}
+	for _, c := range cases {
+		checker, err := newChecker(c.config, nil, nil, nil, "")
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		verdict, message, err := checker.Check("", c.output, c.expected)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if verdict != c.verdict {
+			t.Errorf("%s: got verdict %s, want %s", c.name, verdict, c.verdict)
+		}
+		if (verdict == VerdictAccepted) != (message == "") {
+			t.Errorf("%s: got message %q with verdict %s", c.name, message, verdict)
+		}
+	}
+}
+
+func TestUnknownCheckerKind(t *testing.T) {
+	_, err := newChecker(AssignmentChecker{Kind: "unknown"}, nil, nil, nil, "")
+	if err == nil {
+		t.Fatal("unknown checker kind accepted")
+	}
+}
+
+func TestCustomCheckerExitCodes(t *testing.T) {
+	cases := []struct {
+		exitCode int
+		verdict  Verdict
+		message  string
+		fails    bool
+	}{
+		{testlibExitOK, VerdictAccepted, "ok 1 number", false},
+		{testlibExitWrongAnswer, VerdictWrongAnswer, "ok 1 number", false},
+		{testlibExitPresentationError, VerdictWrongAnswer, "presentation error: ok 1 number", false},
+		{testlibExitFail, "", "", true},
+		{testlibExitDirt, VerdictWrongAnswer, "ok 1 number", false},
+		{42, "", "", true},
+	}
+	for _, c := range cases {
+		workdir, err := ioutil.TempDir("", "checker")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(workdir)
+		runner := newFakeRunner(&processResult{ExitCode: c.exitCode, Stderr: []byte("ok 1 number\n")})
+		checker := &customChecker{runner: runner, command: []string{"/build/checker/checker", "--testset"}, workdir: workdir}
+
+		verdict, message, err := checker.Check("1 2\n", "3\n", "3\n")
+		if (err != nil) != c.fails {
+			t.Fatalf("exit code %d: got error %v", c.exitCode, err)
+		}
+		if verdict != c.verdict || message != c.message {
+			t.Errorf("exit code %d: got %s %q, want %s %q", c.exitCode, verdict, message, c.verdict, c.message)
+		}
+
+		run := runner.runs[0]
+		wantArgs := []string{"--testset", checkerInputFile, checkerOutputFile, checkerAnswerFile}
+		if run.cmd != "/build/checker/checker" || !reflect.DeepEqual(run.args, wantArgs) {
+			t.Errorf("exit code %d: got command %q %v", c.exitCode, run.cmd, run.args)
+		}
+		if run.options.workdir != workdir || !run.options.writableWorkdir {
+			t.Errorf("exit code %d: checker should run in writable %q, got %q", c.exitCode, workdir, run.options.workdir)
+		}
+		files, _ := filepath.Glob(filepath.Join(workdir, "*.txt"))
+		if len(files) != 0 {
+			t.Errorf("exit code %d: test files left in checker workdir: %v", c.exitCode, files)
+		}
+	}
+}
+
+func TestCustomCheckerKilled(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workdir)
+	runner := newFakeRunner(&processResult{Signal: signalCPULimit})
+	checker := &customChecker{runner: runner, command: []string{"checker"}, workdir: workdir}
+	_, _, err = checker.Check("", "", "")
+	if err == nil || !strings.Contains(err.Error(), "checker failed") {
+		t.Fatalf("killed checker is not reported as failure, got %v", err)
+	}
+}
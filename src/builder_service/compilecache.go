@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCompileCacheDir    = "compile_cache"
+	defaultCompileCacheSizeMB = 1024
+
+	compileCacheExecutable = "executable"
+	compileCacheLog        = "compile.log"
+)
+
+// compileCache - keeps executables compiled on the builder node, so rejudges and identical resubmissions skip compilation.
+// Entry key includes language, compiler version, compile command and source, so changed flags or upgraded compiler
+// never reuse old executables. Only languages which compile into "{executable}" are cached.
+// Cache is shared by all workers, least recently used entries are removed when cache exceeds its size.
+type compileCache struct {
+	dir      string
+	maxSize  int64
+	versions map[language]string
+
+	mutex   sync.Mutex
+	size    int64
+	lru     *list.List // *compileCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type compileCacheEntry struct {
+	key  string
+	size int64
+}
+
+// newCompileCache - creates cache and loads entries left by the previous builder run,
+// returns nil if cache is disabled
+func newCompileCache(config CompileCacheConfig, languages *languageRegistry) (*compileCache, error) {
+	if config.Disabled {
+		return nil, nil
+	}
+	dir := config.Dir
+	if len(dir) == 0 {
+		dir = defaultCompileCacheDir
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create compile cache directory")
+	}
+	maxSizeMB := config.MaxSizeMB
+	if maxSizeMB == 0 {
+		maxSizeMB = defaultCompileCacheSizeMB
+	}
+	cache := &compileCache{
+		dir:      dir,
+		maxSize:  int64(maxSizeMB) * 1024 * 1024,
+		versions: getCompilerVersions(languages),
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	err = cache.load()
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// getCompilerVersions - runs version command of each compiled language,
+// languages which compiler version is unknown are not cached
+func getCompilerVersions(languages *languageRegistry) map[language]string {
+	versions := make(map[language]string)
+	for _, config := range languages.list() {
+		command := config.versionCommand()
+		if command == nil || !config.compilesExecutable() {
+			continue
+		}
+		output, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			logrus.WithField("language", config.ID).WithField("error", err).Warn("compile cache disabled: cannot get compiler version")
+			continue
+		}
+		versions[config.ID] = string(bytes.TrimSpace(output))
+	}
+	return versions
+}
+
+// load - adds entries found in cache directory, removes unfinished entries
+func (c *compileCache) load() error {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return errors.Wrap(err, "cannot read compile cache directory")
+	}
+	// Entry modification time is updated on each use, so the oldest entries are evicted first.
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		path := filepath.Join(c.dir, info.Name())
+		if !info.IsDir() || checkBlobHash(info.Name()) != nil {
+			os.RemoveAll(path)
+			continue
+		}
+		size, err := getDirSize(path)
+		if err != nil {
+			return errors.Wrap(err, "cannot read compile cache entry")
+		}
+		entry := &compileCacheEntry{key: info.Name(), size: size}
+		c.entries[entry.key] = c.lru.PushBack(entry)
+		c.size += size
+	}
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+	return nil
+}
+
+// getKey - returns hash of everything that affects compiled executable, or empty string if executable cannot be cached
+func (c *compileCache) getKey(config *LanguageConfig, files languageFiles) string {
+	if c == nil || !config.compilesExecutable() {
+		return ""
+	}
+	version, ok := c.versions[config.ID]
+	if !ok {
+		return ""
+	}
+	source, err := ioutil.ReadFile(files.source)
+	if err != nil {
+		return ""
+	}
+	hasher := sha256.New()
+	for _, part := range []string{string(config.ID), version, config.SourceFile, strings.Join(config.CompileCommand, "\x00")} {
+		hasher.Write([]byte(part))
+		hasher.Write([]byte{0})
+	}
+	hasher.Write(source)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// restore - copies cached executable into build directory, ok is false if there is no entry with given key
+func (c *compileCache) restore(key string, files languageFiles) (compileLog string, ok bool, err error) {
+	entryDir := filepath.Join(c.dir, key)
+	c.mutex.Lock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.mutex.Unlock()
+		return "", false, nil
+	}
+	c.lru.MoveToFront(element)
+	// Opened files can be read even if entry is evicted by another worker during copying.
+	executable, openErr := os.Open(filepath.Join(entryDir, compileCacheExecutable))
+	content, readErr := ioutil.ReadFile(filepath.Join(entryDir, compileCacheLog))
+	now := time.Now()
+	os.Chtimes(entryDir, now, now)
+	c.mutex.Unlock()
+
+	if openErr != nil {
+		return "", true, openErr
+	}
+	defer executable.Close()
+	if readErr != nil {
+		return "", true, readErr
+	}
+	err = copyExecutable(executable, files.executable)
+	if err != nil {
+		return "", true, err
+	}
+	return string(content), true, nil
+}
+
+// store - saves compiled executable and compiler output
+func (c *compileCache) store(key string, files languageFiles, compileLog string) error {
+	tempDir, err := ioutil.TempDir(c.dir, "upload-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	executable, err := os.Open(files.executable)
+	if err != nil {
+		return err
+	}
+	defer executable.Close()
+	err = copyExecutable(executable, filepath.Join(tempDir, compileCacheExecutable))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(tempDir, compileCacheLog), []byte(compileLog), 0644)
+	if err != nil {
+		return err
+	}
+	size, err := getDirSize(tempDir)
+	if err != nil {
+		return err
+	}
+	if size > c.maxSize {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[key]; ok {
+		// Another worker compiled the same source at the same time.
+		return nil
+	}
+	err = os.Rename(tempDir, filepath.Join(c.dir, key))
+	if err != nil {
+		return err
+	}
+	c.entries[key] = c.lru.PushFront(&compileCacheEntry{key: key, size: size})
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// drop - removes broken entry, so the next build compiles source again
+func (c *compileCache) drop(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// evict - removes least recently used entries until cache fits its size, must be called with locked mutex
+func (c *compileCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove - removes entry from the cache, must be called with locked mutex
+func (c *compileCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*compileCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+	err := os.RemoveAll(filepath.Join(c.dir, entry.key))
+	if err != nil {
+		logrus.WithField("key", entry.key).WithField("error", err).Warn("cannot remove compile cache entry")
+	}
+}
+
+func copyExecutable(src io.Reader, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, src)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func getDirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
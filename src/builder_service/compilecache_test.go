@@ -0,0 +1,196 @@
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestCompileCache - creates empty cache in temporary directory with known compiler version
+func newTestCompileCache(t *testing.T, maxSize int64) *compileCache {
+	return &compileCache{
+		dir:      t.TempDir(),
+		maxSize:  maxSize,
+		versions: map[language]string{languageCpp: "g++ 9.4.0"},
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// newTestSolutionFiles - writes source into new build directory, executable is created if content is not empty
+func newTestSolutionFiles(t *testing.T, config *LanguageConfig, source string, executable string) languageFiles {
+	files, err := newLanguageFiles(config, t.TempDir(), solutionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(files.source, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executable) != 0 {
+		err = ioutil.WriteFile(files.executable, []byte(executable), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestCompileCacheKey(t *testing.T) {
+	cache := newTestCompileCache(t, 1024)
+	config, _ := newTestLanguageRegistry(t).get(languageCpp)
+	files := newTestSolutionFiles(t, config, "int main() {}", "")
+	key := cache.getKey(config, files)
+	if checkBlobHash(key) != nil {
+		t.Fatalf("got key %q", key)
+	}
+	if other := cache.getKey(config, newTestSolutionFiles(t, config, "int main() {}", "")); other != key {
+		t.Error("the same source in another build directory got another key")
+	}
+	if other := cache.getKey(config, newTestSolutionFiles(t, config, "int main() { return 0; }", "")); other == key {
+		t.Error("changed source got the same key")
+	}
+
+	changedFlags := *config
+	changedFlags.CompileCommand = append([]string{"-O2"}, config.CompileCommand...)
+	if cache.getKey(&changedFlags, files) == key {
+		t.Error("changed compile command got the same key")
+	}
+	cache.versions[languageCpp] = "g++ 10.1.0"
+	if cache.getKey(config, files) == key {
+		t.Error("upgraded compiler got the same key")
+	}
+
+	delete(cache.versions, languageCpp)
+	if cache.getKey(config, files) != "" {
+		t.Error("executable of compiler with unknown version is cached")
+	}
+	var disabled *compileCache
+	if disabled.getKey(config, files) != "" {
+		t.Error("disabled cache returned key")
+	}
+}
+
+func TestCompiledLanguages(t *testing.T) {
+	config := &LanguageConfig{CompileCommand: []string{"javac", "-d", placeholderDir, placeholderSource}}
+	if config.compilesExecutable() {
+		t.Error("javac does not write executable")
+	}
+	if got, want := config.versionCommand(), []string{"javac", "--version"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got version command %v, want %v", got, want)
+	}
+	config.VersionCommand = []string{"javac", "-version"}
+	if got := config.versionCommand(); !reflect.DeepEqual(got, config.VersionCommand) {
+		t.Errorf("configured version command is not used, got %v", got)
+	}
+
+	config = &LanguageConfig{CompileCommand: []string{"g++", placeholderSource, "-o", placeholderExecutable}}
+	if !config.compilesExecutable() {
+		t.Error("g++ writes executable")
+	}
+	if (&LanguageConfig{}).versionCommand() != nil {
+		t.Error("interpreted language has compiler version")
+	}
+}
+
+func TestSolutionCompilerReusesCachedExecutable(t *testing.T) {
+	cache := newTestCompileCache(t, 1024*1024)
+	config, _ := newTestLanguageRegistry(t).get(languageCpp)
+	runner := newFakeRunner(&processResult{Stderr: []byte("warning: unused variable\n")})
+	compiler := newSolutionCompiler(runner, CompileLimitsConfig{}, cache)
+
+	files := newTestSolutionFiles(t, config, "int main() {}", "binary")
+	result, err := compiler.compile(config, files)
+	if err != nil || result.failure != nil {
+		t.Fatalf("got %v, %v", result.failure, err)
+	}
+	if len(cache.entries) != 1 {
+		t.Fatalf("got %d cache entries", len(cache.entries))
+	}
+
+	// Fake runner has no more results, so the second compilation fails if compiler is started.
+	files = newTestSolutionFiles(t, config, "int main() {}", "")
+	result, err = compiler.compile(config, files)
+	if err != nil || result.failure != nil {
+		t.Fatalf("got %v, %v", result.failure, err)
+	}
+	if result.log != "warning: unused variable\n" {
+		t.Errorf("cached compile log is not restored, got %q", result.log)
+	}
+	executable, err := ioutil.ReadFile(files.executable)
+	if err != nil || string(executable) != "binary" {
+		t.Errorf("got executable %q, error %v", executable, err)
+	}
+	if info, err := os.Stat(files.executable); err != nil || info.Mode()&0100 == 0 {
+		t.Error("restored executable cannot be run")
+	}
+}
+
+func TestSolutionCompilerDoesNotCacheFailure(t *testing.T) {
+	cache := newTestCompileCache(t, 1024*1024)
+	config, _ := newTestLanguageRegistry(t).get(languageCpp)
+	runner := newFakeRunner(&processResult{ExitCode: 1, Stderr: []byte("error\n")})
+	compiler := newSolutionCompiler(runner, CompileLimitsConfig{}, cache)
+
+	result, err := compiler.compile(config, newTestSolutionFiles(t, config, "int main() {", ""))
+	if err != nil || result.failure == nil {
+		t.Fatalf("got %v, %v", result.failure, err)
+	}
+	if len(cache.entries) != 0 {
+		t.Error("failed compilation is cached")
+	}
+}
+
+func TestCompileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// Each entry keeps 400 bytes executable and empty log, so cache fits two entries.
+	cache := newTestCompileCache(t, 1000)
+	config, _ := newTestLanguageRegistry(t).get(languageCpp)
+	var keys []string
+	for _, source := range []string{"first", "second"} {
+		files := newTestSolutionFiles(t, config, source, string(make([]byte, 400)))
+		key := cache.getKey(config, files)
+		if err := cache.store(key, files, ""); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	if _, ok, err := cache.restore(keys[0], newTestSolutionFiles(t, config, "first", "")); !ok || err != nil {
+		t.Fatalf("first entry is not restored: %v", err)
+	}
+	files := newTestSolutionFiles(t, config, "third", string(make([]byte, 400)))
+	if err := cache.store(cache.getKey(config, files), files, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.entries[keys[1]]; ok {
+		t.Error("least recently used entry is not evicted")
+	}
+	if _, err := os.Stat(filepath.Join(cache.dir, keys[1])); !os.IsNotExist(err) {
+		t.Error("evicted entry is not removed from disk")
+	}
+	if _, ok := cache.entries[keys[0]]; !ok || cache.size != 800 {
+		t.Errorf("recently used entry is evicted, cache size %d", cache.size)
+	}
+}
+
+func TestCompileCacheLoadsEntries(t *testing.T) {
+	cache := newTestCompileCache(t, 1024)
+	key := hashOf("entry")
+	os.MkdirAll(filepath.Join(cache.dir, key), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(cache.dir, key, compileCacheExecutable), []byte("binary"), 0755)
+	os.MkdirAll(filepath.Join(cache.dir, "upload-123"), os.ModePerm)
+
+	err := cache.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.entries[key]; !ok || cache.size != 6 {
+		t.Errorf("entry left by previous run is not loaded, cache size %d", cache.size)
+	}
+	if _, err := os.Stat(filepath.Join(cache.dir, "upload-123")); !os.IsNotExist(err) {
+		t.Error("unfinished entry is not removed")
+	}
+}
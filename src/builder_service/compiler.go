@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCompileTimeLimitMs   = 30000
+	defaultCompileMemoryLimitMB = 1024
+	defaultCompileLogLimitKB    = 64
+	// compileFileSizeLimitMB - max size of the file written by compiler, limits size of the executable
+	compileFileSizeLimitMB = 256
+	// compileMaxProcesses - compiler drivers like g++ run preprocessor, compiler, assembler and linker as child processes
+	compileMaxProcesses = 64
+	compileMaxOpenFiles = 64
+)
+
+// solutionCompiler - compiles solutions and checkers in the sandbox with compile limits,
+// reuses executables from compile cache if cache is enabled
+type solutionCompiler struct {
+	runner   processRunner
+	limits   *processLimits
+	logLimit int
+	cache    *compileCache
+}
+
+// compileResult - result of the compilation
+// log - compiler output, can contain warnings even if compilation succeed
+// failure - reason of the failed compilation, nil if compilation succeed
+// timeout - compilation was stopped on time limit
+type compileResult struct {
+	log     string
+	failure error
+	timeout bool
+}
+
+func newSolutionCompiler(runner processRunner, config CompileLimitsConfig, cache *compileCache) *solutionCompiler {
+	if config.TimeLimitMs == 0 {
+		config.TimeLimitMs = defaultCompileTimeLimitMs
+	}
+	if config.MemoryLimitMB == 0 {
+		config.MemoryLimitMB = defaultCompileMemoryLimitMB
+	}
+	if config.LogLimitKB == 0 {
+		config.LogLimitKB = defaultCompileLogLimitKB
+	}
+	limits := new(processLimits)
+	limits.NumberOfFiles = compileMaxOpenFiles
+	limits.NumberOfProc = compileMaxProcesses
+	limits.NumberOfLocks = 8
+	limits.TimeLimitMs = config.TimeLimitMs
+	limits.AddessSpaceMB = config.MemoryLimitMB
+	limits.OutputLimitKB = compileFileSizeLimitMB * 1024
+	limits.StackSizeMB = defaultStackSizeMB
+	// Compiler does not wait for input, so wall clock time is limited as well as CPU time.
+	limits.WallTimeRatio = 1
+
+	return &solutionCompiler{
+		runner:   runner,
+		limits:   limits,
+		logLimit: config.LogLimitKB * 1024,
+		cache:    cache,
+	}
+}
+
+// compile - compiles source file, or copies executable from cache if the same source was compiled before.
+// Returned error means internal failure, compilation errors are reported with compileResult.
+func (c *solutionCompiler) compile(config *LanguageConfig, files languageFiles) (compileResult, error) {
+	key := c.cache.getKey(config, files)
+	if len(key) == 0 {
+		return compileSolution(c.runner, config, files, c.limits, c.logLimit)
+	}
+	compileLog, ok, err := c.cache.restore(key, files)
+	if err != nil {
+		logrus.WithField("key", key).WithField("error", err).Warn("cannot restore executable from compile cache")
+		c.cache.drop(key)
+	} else if ok {
+		return compileResult{log: compileLog}, nil
+	}
+	result, err := compileSolution(c.runner, config, files, c.limits, c.logLimit)
+	if err != nil || result.failure != nil {
+		return result, err
+	}
+	err = c.cache.store(key, files, result.log)
+	if err != nil {
+		logrus.WithField("key", key).WithField("error", err).Warn("cannot save executable to compile cache")
+	}
+	return result, nil
+}
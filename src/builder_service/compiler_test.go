@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewSolutionCompilerLimits(t *testing.T) {
+	compiler := newSolutionCompiler(nil, CompileLimitsConfig{}, nil)
+	limits := compiler.limits
+	if limits.TimeLimitMs != defaultCompileTimeLimitMs || limits.AddessSpaceMB != defaultCompileMemoryLimitMB || compiler.logLimit != defaultCompileLogLimitKB*1024 {
+		t.Errorf("got default limits %+v, log limit %d", limits, compiler.logLimit)
+	}
+	// Compiler does not wait for input, so it gets no more wall clock time than CPU time.
+	if limits.WallTime() != limits.CPUTime() || limits.NumberOfProc != compileMaxProcesses {
+		t.Errorf("got wall time %v, %d processes", limits.WallTime(), limits.NumberOfProc)
+	}
+
+	compiler = newSolutionCompiler(nil, CompileLimitsConfig{TimeLimitMs: 5000, MemoryLimitMB: 512, LogLimitKB: 4}, nil)
+	if compiler.limits.TimeLimitMs != 5000 || compiler.limits.AddessSpaceMB != 512 || compiler.logLimit != 4096 {
+		t.Errorf("got configured limits %+v, log limit %d", compiler.limits, compiler.logLimit)
+	}
+}
+
+func TestCompileSolutionInSandbox(t *testing.T) {
+	config, _ := newTestLanguageRegistry(t).get(languageCpp)
+	files := newTestSolutionFiles(t, config, "int main() {}", "")
+	runner := newFakeRunner(&processResult{Stderr: []byte(strings.Repeat("warning\n", 100)), Stdout: []byte("done\n")})
+	compiler := newSolutionCompiler(runner, CompileLimitsConfig{LogLimitKB: 1}, nil)
+
+	result, err := compileSolution(runner, config, files, compiler.limits, 64)
+	if err != nil || result.failure != nil {
+		t.Fatalf("got %v, %v", result.failure, err)
+	}
+	if len(result.log) != 64+len(truncatedMarker) || !strings.HasPrefix(result.log, "warning\n") {
+		t.Errorf("compile log is not truncated: %q", result.log)
+	}
+	run := runner.runs[0]
+	if run.cmd != "g++" || run.options.workdir != files.dir || !run.options.writableWorkdir || run.options.logLimit != 64 || run.options.limits != compiler.limits {
+		t.Errorf("compiler run with %+v", run.options)
+	}
+}
+
+func TestCompileSolutionLimitExceeded(t *testing.T) {
+	config, _ := newTestLanguageRegistry(t).get(languageCpp)
+	cases := []struct {
+		name    string
+		result  *processResult
+		reason  string
+		timeout bool
+	}{
+		{"cpu", &processResult{Signal: signalCPULimit, CPUTime: 2 * time.Second}, "compilation failed: time limit exceeded", true},
+		{"wall", &processResult{Signal: syscall.SIGKILL, WallTimeExceeded: true}, "compilation failed: time limit exceeded", true},
+		{"memory", &processResult{Signal: syscall.SIGKILL, OOMKilled: true}, "compilation failed: memory limit exceeded", false},
+		{"error", &processResult{ExitCode: 1, Stderr: []byte("error: expected ';'")}, "compilation failed: exit status 1\nerror: expected ';'", false},
+	}
+	for _, c := range cases {
+		files := newTestSolutionFiles(t, config, "int main() {}", "")
+		compiler := newSolutionCompiler(newFakeRunner(c.result), CompileLimitsConfig{TimeLimitMs: 1000}, nil)
+		result, err := compiler.compile(config, files)
+		if err != nil || result.failure == nil {
+			t.Fatalf("%s: got %v, %v", c.name, result.failure, err)
+		}
+		if result.failure.Error() != c.reason || result.timeout != c.timeout {
+			t.Errorf("%s: got %q, timeout %v", c.name, result.failure, result.timeout)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 
@@ -19,13 +20,97 @@ const (
 
 // Config - video server instance configuration
 type Config struct {
-	MySQLUser     string `json:"mysql_user"`
-	MySQLPassword string `json:"mysql_password"`
-	MySQLHost     string `json:"mysql_host"`
-	MySQLDB       string `json:"mysql_db"`
-	AmqpSocket    string `json:"amqp_socket"`
-	ServerURL     string `json:"builder_url"`
-	LogFileName   string `json:"log_file_name"`
+	MySQLUser     string        `json:"mysql_user"`
+	MySQLPassword string        `json:"mysql_password"`
+	MySQLHost     string        `json:"mysql_host"`
+	MySQLDB       string        `json:"mysql_db"`
+	AmqpSocket    string        `json:"amqp_socket"`
+	ServerURL     string        `json:"builder_url"`
+	LogFileName   string        `json:"log_file_name"`
+	Sandbox       SandboxConfig `json:"sandbox"`
+	// Languages - enabled languages, C++ and Pascal used by default
+	Languages []LanguageConfig `json:"languages"`
+	Workers   WorkersConfig    `json:"workers"`
+	// NodeID - name of the builder instance saved with claimed builds, host name by default
+	NodeID        string              `json:"node_id"`
+	BlobStore     BlobStoreConfig     `json:"blob_store"`
+	CompileCache  CompileCacheConfig  `json:"compile_cache"`
+	CompileLimits CompileLimitsConfig `json:"compile_limits"`
+	// MaxReportSizeKB - build and tests logs and test outputs saved with build report are truncated to this total size,
+	// 1024 by default
+	MaxReportSizeKB int `json:"max_report_size_kb"`
+}
+
+// CompileLimitsConfig - limits of the compiler, which runs in the same sandbox as solutions
+// TimeLimitMs - compilation is stopped with "compilation_timeout" status after this time, 30000 by default
+// MemoryLimitMB - 1024 by default
+// LogLimitKB - compiler output is truncated to this size, 64 by default
+type CompileLimitsConfig struct {
+	TimeLimitMs   int `json:"time_limit_ms"`
+	MemoryLimitMB int `json:"memory_limit_mb"`
+	LogLimitKB    int `json:"log_limit_kb"`
+}
+
+// CompileCacheConfig - settings of the cache of compiled solutions and checkers
+// Dir - cache directory, "compile_cache" by default
+// MaxSizeMB - least recently used executables are removed when cache exceeds this size, 1024 by default
+// Disabled - each build compiles solution from scratch
+type CompileCacheConfig struct {
+	Dir       string `json:"dir"`
+	MaxSizeMB int    `json:"max_size_mb"`
+	Disabled  bool   `json:"disabled"`
+}
+
+// BlobStoreConfig - settings of the store for tests and sources which are too large for database rows
+// Kind - either "local" (default) or "s3"
+// Dir - directory of the local store, or blobs cache of the builder node for "s3" store, "blobs" by default.
+// Builder nodes must share directory of the local store.
+// InlineLimitKB - tests and sources up to this size are kept in database, 64 by default
+type BlobStoreConfig struct {
+	Kind          string   `json:"kind"`
+	Dir           string   `json:"dir"`
+	InlineLimitKB int      `json:"inline_limit_kb"`
+	S3            S3Config `json:"s3"`
+}
+
+// S3Config - settings of the S3-compatible object storage
+// Endpoint - storage URL, like "http://localhost:9000" for local MinIO
+// Region - "us-east-1" by default
+type S3Config struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// WorkersConfig - settings of the workers which run builds in parallel
+// Count - number of workers, 1 by default
+// PollIntervalMs - interval between database polls when there are no pending builds, 30000 by default
+// CPUs - CPU pinned to the worker with the same index, workers without CPU are not pinned
+// WorkDir - directory which contains work directories of all workers, current directory by default
+// LeaseSeconds - claimed build returns to queue if worker didn't prolong lease in this time, 60 by default
+// MaxAttempts - build fails with exception after this number of expired leases, 3 by default
+type WorkersConfig struct {
+	Count          int    `json:"count"`
+	PollIntervalMs int    `json:"poll_interval_ms"`
+	CPUs           []int  `json:"cpus"`
+	WorkDir        string `json:"work_dir"`
+	LeaseSeconds   int    `json:"lease_seconds"`
+	MaxAttempts    int    `json:"max_attempts"`
+}
+
+// SandboxConfig - settings of the sandbox which runs solutions
+// Runner - either "namespaces" (default) or "prlimit"
+// SystemDirs - host directories visible read-only in "namespaces" sandbox, standard program and library directories by default
+// HiddenDirs - builder directories hidden from sandboxed processes, filled from other settings
+type SandboxConfig struct {
+	Runner      string   `json:"runner"`
+	CgroupRoot  string   `json:"cgroup_root"`
+	TmpfsSizeMB int      `json:"tmpfs_size_mb"`
+	MountProc   bool     `json:"mount_proc"`
+	SystemDirs  []string `json:"system_dirs"`
+	HiddenDirs  []string `json:"-"`
 }
 
 // ParseConfig loads instance configuration from pre-defined path (relative to executable)
@@ -50,6 +135,38 @@ func ParseConfig() (*Config, error) {
 	return &config, nil
 }
 
+// GetPrivateDirs - returns directories with builder config, work directories, blob store and compile cache
+func (c *Config) GetPrivateDirs() ([]string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{path.Dir(executable), c.Workers.WorkDir, c.BlobStore.Dir, c.CompileCache.Dir}
+	defaults := []string{"", ".", defaultBlobStoreDir, defaultCompileCacheDir}
+	for i, dir := range dirs {
+		if len(dir) == 0 {
+			dir = defaults[i]
+		}
+		dirs[i], err = filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// GetNodeID - returns name of the builder instance
+func (c *Config) GetNodeID() (string, error) {
+	if len(c.NodeID) != 0 {
+		return c.NodeID, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get host name")
+	}
+	return hostname, nil
+}
+
 // DatabaseConnector - creates SQL database connection
 type DatabaseConnector interface {
 	Connect() (*sql.DB, error)
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DiagnosticSeverity - severity of the compiler message
+type DiagnosticSeverity string
+
+const (
+	SeverityError   DiagnosticSeverity = "error"
+	SeverityWarning DiagnosticSeverity = "warning"
+	SeverityNote    DiagnosticSeverity = "note"
+)
+
+// Diagnostic - compiler message about the source line
+// File - base name of the source file, Column is 0 if compiler did not report it
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity DiagnosticSeverity
+	Message  string
+}
+
+var (
+	// gccDiagnosticPattern - gcc, g++ and clang format: "file:line:column: severity: message", column is optional
+	gccDiagnosticPattern = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note): (.*)$`)
+	// fpcDiagnosticPattern - Free Pascal format: "file(line,column) Severity: message", column is optional
+	fpcDiagnosticPattern = regexp.MustCompile(`^(.+?)\((\d+)(?:,(\d+))?\) (Fatal|Error|Warning|Note|Hint): (.*)$`)
+)
+
+// diagnosticSeverities - maps compiler severity names to DiagnosticSeverity
+var diagnosticSeverities = map[string]DiagnosticSeverity{
+	"fatal error": SeverityError,
+	"error":       SeverityError,
+	"warning":     SeverityWarning,
+	"note":        SeverityNote,
+	"Fatal":       SeverityError,
+	"Error":       SeverityError,
+	"Warning":     SeverityWarning,
+	"Note":        SeverityNote,
+	"Hint":        SeverityNote,
+}
+
+// parseDiagnostics - extracts messages about source lines from gcc, g++, clang and fpc output,
+// other lines like "In function 'main':" or code snippets are skipped
+func parseDiagnostics(output string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		match := gccDiagnosticPattern.FindStringSubmatch(line)
+		if match == nil {
+			match = fpcDiagnosticPattern.FindStringSubmatch(line)
+		}
+		if match == nil {
+			continue
+		}
+		diagnostic := Diagnostic{
+			File:     filepath.Base(match[1]),
+			Severity: diagnosticSeverities[match[4]],
+			Message:  match[5],
+		}
+		diagnostic.Line, _ = strconv.Atoi(match[2])
+		if len(match[3]) != 0 {
+			diagnostic.Column, _ = strconv.Atoi(match[3])
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	output := "/build/solution/solution.cpp: In function 'int main()':\n" +
+		"/build/solution/solution.cpp:5:5: error: 'undefined_name' was not declared in this scope\n" +
+		"    5 |     undefined_name = 1;\n" +
+		"      |     ^~~~~~~~~~~~~~\n" +
+		"solution.cpp:3:10: fatal error: missing.h: No such file or directory\r\n" +
+		"solution.c:7: warning: implicit declaration\n" +
+		"/build/solution/solution.cpp:2:1: note: declared here\n" +
+		"solution.pas(4,12) Error: Identifier not found \"x\"\n" +
+		"solution.pas(9) Hint: Local variable \"y\" not used\n" +
+		"Fatal: Compilation aborted\n"
+	want := []Diagnostic{
+		{File: "solution.cpp", Line: 5, Column: 5, Severity: SeverityError, Message: "'undefined_name' was not declared in this scope"},
+		{File: "solution.cpp", Line: 3, Column: 10, Severity: SeverityError, Message: "missing.h: No such file or directory"},
+		{File: "solution.c", Line: 7, Column: 0, Severity: SeverityWarning, Message: "implicit declaration"},
+		{File: "solution.cpp", Line: 2, Column: 1, Severity: SeverityNote, Message: "declared here"},
+		{File: "solution.pas", Line: 4, Column: 12, Severity: SeverityError, Message: "Identifier not found \"x\""},
+		{File: "solution.pas", Line: 9, Column: 0, Severity: SeverityNote, Message: "Local variable \"y\" not used"},
+	}
+	got := parseDiagnostics(output)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := parseDiagnostics(""); len(got) != 0 {
+		t.Errorf("empty output: got %+v", got)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// fakeQueryResult - rows returned by SELECT query, or number of rows changed
+// and ID of the inserted row for other query
+type fakeQueryResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+	lastInsertID int64
+}
+
+// fakeQuery - query executed by repository with its arguments
+type fakeQuery struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeDatabase - database/sql driver which returns prepared results for queries with given prefixes,
+// records executed queries and counts rows which were not closed
+type fakeDatabase struct {
+	mutex    sync.Mutex
+	prefixes []string
+	results  []fakeQueryResult
+	queries  []fakeQuery
+	openRows int
+}
+
+var (
+	fakeDatabasesMutex sync.Mutex
+	fakeDatabases      = make(map[string]*fakeDatabase)
+)
+
+func init() {
+	sql.Register("fakedb", new(fakeDriver))
+}
+
+// newFakeDatabase - creates fake database, which is closed with the test
+func newFakeDatabase(t *testing.T) (*fakeDatabase, *sql.DB) {
+	database := new(fakeDatabase)
+	fakeDatabasesMutex.Lock()
+	fakeDatabases[t.Name()] = database
+	fakeDatabasesMutex.Unlock()
+	db, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDatabasesMutex.Lock()
+		delete(fakeDatabases, t.Name())
+		fakeDatabasesMutex.Unlock()
+	})
+	return database, db
+}
+
+// expect - adds result returned for queries which start with given prefix
+func (d *fakeDatabase) expect(prefix string, result fakeQueryResult) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.prefixes = append(d.prefixes, prefix)
+	d.results = append(d.results, result)
+}
+
+// executed - returns executed queries which start with given prefix
+func (d *fakeDatabase) executed(prefix string) []fakeQuery {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var queries []fakeQuery
+	for _, query := range d.queries {
+		if strings.HasPrefix(query.query, prefix) {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+// checkRowsClosed - fails test if repository left rows open
+func (d *fakeDatabase) checkRowsClosed(t *testing.T) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.openRows != 0 {
+		t.Errorf("%d query results are not closed", d.openRows)
+	}
+}
+
+func (d *fakeDatabase) run(query string, args []driver.Value) (fakeQueryResult, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.queries = append(d.queries, fakeQuery{query, args})
+	for i, prefix := range d.prefixes {
+		if strings.HasPrefix(query, prefix) {
+			return d.results[i], nil
+		}
+	}
+	return fakeQueryResult{}, errors.New("unexpected query '" + query + "'")
+}
+
+type fakeDriver struct {
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDatabasesMutex.Lock()
+	defer fakeDatabasesMutex.Unlock()
+	database, ok := fakeDatabases[name]
+	if !ok {
+		return nil, errors.New("fake database '" + name + "' not found")
+	}
+	return &fakeConn{database}, nil
+}
+
+type fakeConn struct {
+	database *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.database, query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	database *fakeDatabase
+	query    string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	result, err := s.database.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeExecResult{result}, nil
+}
+
+type fakeExecResult struct {
+	result fakeQueryResult
+}
+
+func (r *fakeExecResult) LastInsertId() (int64, error) {
+	return r.result.lastInsertID, nil
+}
+
+func (r *fakeExecResult) RowsAffected() (int64, error) {
+	return r.result.rowsAffected, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	result, err := s.database.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	s.database.mutex.Lock()
+	s.database.openRows++
+	s.database.mutex.Unlock()
+	return &fakeRows{database: s.database, result: result}, nil
+}
+
+type fakeRows struct {
+	database *fakeDatabase
+	result   fakeQueryResult
+	next     int
+	closed   bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.result.columns
+}
+
+func (r *fakeRows) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.database.mutex.Lock()
+		r.database.openRows--
+		r.database.mutex.Unlock()
+	}
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// fakeRun - command and options of the process started by fakeRunner
+type fakeRun struct {
+	options processRunOptions
+	cmd     string
+	args    []string
+}
+
+// fakeRunner - processRunner which returns prepared results instead of running processes
+// and records each run, so tests can check what would be started in the sandbox
+type fakeRunner struct {
+	results []*processResult
+	runs    []fakeRun
+}
+
+func newFakeRunner(results ...*processResult) *fakeRunner {
+	return &fakeRunner{results: results}
+}
+
+func (r *fakeRunner) Run(options processRunOptions, cmd string, arg ...string) (*processResult, error) {
+	r.runs = append(r.runs, fakeRun{options: options, cmd: cmd, args: arg})
+	if len(r.results) == 0 {
+		return nil, errors.New("fake runner has no result for '" + cmd + "'")
+	}
+	result := r.results[0]
+	r.results = r.results[1:]
+	return result, nil
+}
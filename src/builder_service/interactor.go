@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	interactorName = "interactor"
+	// interactorMaxOpenFiles - interactor opens input, output and answer files besides standard streams
+	interactorMaxOpenFiles = 16
+)
+
+// interactor - runs testlib-compatible interactor program: interactor <input> <output> <answer>.
+// Interactor reads test from input file and talks with solution: interactor stdout is connected to solution stdin
+// and solution stdout is connected to interactor stdin. Verdict is defined by interactor exit code.
+type interactor struct {
+	command []string
+	workdir string
+}
+
+// newInteractor - compiles interactor in workdir
+func newInteractor(config AssignmentChecker, languages *languageRegistry, compiler *solutionCompiler, workdir string) (*interactor, error) {
+	command, interactorWorkdir, err := compileAuthorProgram(config, languages, compiler, workdir, interactorName)
+	if err != nil {
+		return nil, err
+	}
+	return &interactor{
+		command: command,
+		workdir: interactorWorkdir,
+	}, nil
+}
+
+// newInteractorLimits - interactor has the same limits as solution, but waits for solution output longer,
+// so solution which stopped answering is stopped first
+func newInteractorLimits(solutionLimits *processLimits) *processLimits {
+	limits := *solutionLimits
+	if limits.NumberOfFiles < interactorMaxOpenFiles {
+		limits.NumberOfFiles = interactorMaxOpenFiles
+	}
+	limits.WallTimeRatio++
+	return &limits
+}
+
+// runInteractiveProcess - runs solution and interactor concurrently with cross-wired stdin and stdout.
+// Returned error means internal failure, including interactor failure; solution failures are reported with verdict.
+func runInteractiveProcess(runner processRunner, interactor *interactor, options processRunOptions, cmd string, arg ...string) (TestResult, error) {
+	files := []struct {
+		name    string
+		content string
+	}{
+		{checkerInputFile, options.input},
+		{checkerAnswerFile, options.expected},
+	}
+	// Interactor directory is not visible for solution in the sandbox,
+	// files of the test are removed anyway, so they are never left for the next run.
+	defer func() {
+		for _, name := range []string{checkerInputFile, checkerOutputFile, checkerAnswerFile} {
+			os.Remove(filepath.Join(interactor.workdir, name))
+		}
+	}()
+	for _, file := range files {
+		err := ioutil.WriteFile(filepath.Join(interactor.workdir, file.name), []byte(file.content), 0644)
+		if err != nil {
+			return TestResult{}, errors.Wrap(err, "cannot write interactor file")
+		}
+	}
+
+	solutionInput, interactorOutput, err := os.Pipe()
+	if err != nil {
+		return TestResult{}, err
+	}
+	interactorInput, solutionOutput, err := os.Pipe()
+	if err != nil {
+		solutionInput.Close()
+		interactorOutput.Close()
+		return TestResult{}, err
+	}
+
+	interactorOptions := processRunOptions{
+		workdir:         interactor.workdir,
+		limits:          newInteractorLimits(options.limits),
+		writableWorkdir: true,
+		logLimit:        checkerMessageLimit,
+		stdin:           interactorInput,
+		stdout:          interactorOutput,
+	}
+	args := append([]string{}, interactor.command[1:]...)
+	args = append(args, checkerInputFile, checkerOutputFile, checkerAnswerFile)
+	var interactorResult *processResult
+	var interactorErr error
+	interactorDone := make(chan struct{})
+	// Processes inherit CPU affinity of the thread which started them, so interactor is started
+	// from the thread pinned to the same CPUs as the worker thread which runs solution.
+	cpus, cpusErr := getThreadCPUSet()
+	go func() {
+		defer close(interactorDone)
+		if cpusErr == nil {
+			// Thread is not unlocked, so it exits with goroutine and pinned thread is never reused.
+			runtime.LockOSThread()
+			err := setThreadCPUSet(cpus)
+			if err != nil {
+				logrus.WithField("error", err).Warn("cannot pin interactor to worker CPUs")
+			}
+		}
+		interactorResult, interactorErr = runner.Run(interactorOptions, interactor.command[0], args...)
+		// Solution gets end of input when interactor finished, its further output is discarded.
+		interactorInput.Close()
+		interactorOutput.Close()
+	}()
+
+	options.stdin = solutionInput
+	options.stdout = solutionOutput
+	result, err := runner.Run(options, cmd, arg...)
+	solutionInput.Close()
+	solutionOutput.Close()
+	<-interactorDone
+	if err != nil {
+		return TestResult{}, errors.Wrap(err, "cannot run solution")
+	}
+	if interactorErr != nil {
+		return TestResult{}, errors.Wrap(interactorErr, "cannot run interactor")
+	}
+
+	// Solution limits are checked first: interactor usually fails when solution was stopped.
+	verdict, limit := getProcessVerdict(result, options.limits)
+	if limit != "" {
+		testResult := newTestResult(verdict, result)
+		testResult.LimitExceeded = limit
+		testResult.Message = fmt.Sprintf("run failed: %s limit exceeded", limit)
+		return testResult, nil
+	}
+	message := truncateOutput(bytes.TrimSpace(interactorResult.Stderr), checkerMessageLimit)
+	if interactorResult.Signal != 0 || interactorResult.WallTimeExceeded || interactorResult.OOMKilled {
+		return TestResult{}, errors.New("interactor failed: " + interactorResult.Describe())
+	}
+	switch interactorResult.ExitCode {
+	case testlibExitOK:
+		if verdict != "" {
+			// Interactor accepted the dialog, but solution crashed or exited with non-zero code.
+			testResult := newTestResult(verdict, result)
+			testResult.Message = fmt.Sprintf("run failed: %s", result.Describe())
+			if len(testResult.Stderr) > 0 {
+				testResult.Message += "\n"
+				testResult.Message += testResult.Stderr
+			}
+			return testResult, nil
+		}
+		return newTestResult(VerdictAccepted, result), nil
+	case testlibExitWrongAnswer, testlibExitDirt:
+		testResult := newTestResult(VerdictWrongAnswer, result)
+		testResult.Message = message
+		return testResult, nil
+	case testlibExitPresentationError:
+		testResult := newTestResult(VerdictWrongAnswer, result)
+		testResult.Message = "presentation error: " + message
+		return testResult, nil
+	case testlibExitFail:
+		return TestResult{}, errors.New("interactor failed: " + message)
+	}
+	return TestResult{}, errors.Errorf("interactor failed with unexpected exit status %d: %s", interactorResult.ExitCode, message)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// interactiveRunner - fake runner which runs solution and interactor as functions talking through given pipes
+type interactiveRunner struct {
+	t          *testing.T
+	solution   func(stdin io.Reader, stdout io.Writer) *processResult
+	interactor func(workdir string, stdin io.Reader, stdout io.Writer) *processResult
+}
+
+func (r *interactiveRunner) Run(options processRunOptions, cmd string, arg ...string) (*processResult, error) {
+	if options.stdin == nil || options.stdout == nil {
+		r.t.Errorf("%s is not connected with pipes", cmd)
+		return nil, fmt.Errorf("%s has no pipes", cmd)
+	}
+	if cmd != "/build/interactor/interactor" {
+		return r.solution(options.stdin, options.stdout), nil
+	}
+	if want := []string{checkerInputFile, checkerOutputFile, checkerAnswerFile}; !reflect.DeepEqual(arg, want) {
+		r.t.Errorf("got interactor arguments %v, want %v", arg, want)
+	}
+	if !options.writableWorkdir || options.logLimit != checkerMessageLimit {
+		r.t.Errorf("interactor run with %+v", options)
+	}
+	return r.interactor(options.workdir, options.stdin, options.stdout), nil
+}
+
+// sumSolution - reads two numbers and prints their sum plus delta
+func sumSolution(delta int) func(stdin io.Reader, stdout io.Writer) *processResult {
+	return func(stdin io.Reader, stdout io.Writer) *processResult {
+		var a, b int
+		fmt.Fscan(stdin, &a, &b)
+		fmt.Fprintln(stdout, a+b+delta)
+		return &processResult{}
+	}
+}
+
+// sumInteractor - sends numbers from input file to solution and accepts their sum
+func sumInteractor(workdir string, stdin io.Reader, stdout io.Writer) *processResult {
+	input, err := ioutil.ReadFile(filepath.Join(workdir, checkerInputFile))
+	if err != nil {
+		return &processResult{ExitCode: testlibExitFail, Stderr: []byte(err.Error())}
+	}
+	var a, b int
+	fmt.Sscan(string(input), &a, &b)
+	fmt.Fprintln(stdout, a, b)
+	line, _ := bufio.NewReader(stdin).ReadString('\n')
+	if strings.TrimSpace(line) != fmt.Sprint(a+b) {
+		return &processResult{ExitCode: testlibExitWrongAnswer, Stderr: []byte("wrong sum " + line)}
+	}
+	return &processResult{ExitCode: testlibExitOK}
+}
+
+func TestRunInteractiveProcess(t *testing.T) {
+	cases := []struct {
+		name       string
+		solution   func(stdin io.Reader, stdout io.Writer) *processResult
+		interactor func(workdir string, stdin io.Reader, stdout io.Writer) *processResult
+		verdict    Verdict
+		fails      bool
+	}{
+		{"accepted", sumSolution(0), sumInteractor, VerdictAccepted, false},
+		{"wrong answer", sumSolution(1), sumInteractor, VerdictWrongAnswer, false},
+		{"solution crashed after dialog", func(stdin io.Reader, stdout io.Writer) *processResult {
+			sumSolution(0)(stdin, stdout)
+			return &processResult{Signal: syscall.SIGSEGV}
+		}, sumInteractor, VerdictRuntimeError, false},
+		{"solution time limit", func(stdin io.Reader, stdout io.Writer) *processResult {
+			return &processResult{Signal: signalCPULimit}
+		}, sumInteractor, VerdictTimeLimitExceeded, false},
+		{"interactor failed", sumSolution(0), func(workdir string, stdin io.Reader, stdout io.Writer) *processResult {
+			return &processResult{ExitCode: testlibExitFail, Stderr: []byte("bad test")}
+		}, "", true},
+		{"interactor killed", sumSolution(0), func(workdir string, stdin io.Reader, stdout io.Writer) *processResult {
+			return &processResult{Signal: syscall.SIGKILL, WallTimeExceeded: true}
+		}, "", true},
+	}
+	for _, c := range cases {
+		workdir := t.TempDir()
+		runner := &interactiveRunner{t: t, solution: c.solution, interactor: c.interactor}
+		testInteractor := &interactor{command: []string{"/build/interactor/interactor"}, workdir: workdir}
+		options := processRunOptions{input: "1 2\n", expected: "3\n", limits: newTestLimits()}
+
+		result, err := runInteractiveProcess(runner, testInteractor, options, "/build/solution/solution")
+		if (err != nil) != c.fails {
+			t.Fatalf("%s: got error %v", c.name, err)
+		}
+		if result.Verdict != c.verdict {
+			t.Errorf("%s: got verdict %s (%s), want %s", c.name, result.Verdict, result.Message, c.verdict)
+		}
+		if files, _ := filepath.Glob(filepath.Join(workdir, "*.txt")); len(files) != 0 {
+			t.Errorf("%s: test files left in interactor workdir: %v", c.name, files)
+		}
+	}
+}
+
+func TestNewInteractorLimits(t *testing.T) {
+	solutionLimits := newTestLimits()
+	limits := newInteractorLimits(solutionLimits)
+	if limits.WallTime() <= solutionLimits.WallTime() || limits.CPUTime() != solutionLimits.CPUTime() {
+		t.Errorf("interactor got wall time %v, solution %v", limits.WallTime(), solutionLimits.WallTime())
+	}
+	if limits.NumberOfFiles != interactorMaxOpenFiles || solutionLimits.NumberOfFiles != 8 {
+		t.Errorf("got %d open files for interactor, %d for solution", limits.NumberOfFiles, solutionLimits.NumberOfFiles)
+	}
+}
+
+func TestRunInteractiveProcessClosesPipes(t *testing.T) {
+	var solutionInput, solutionOutput *os.File
+	runner := &interactiveRunner{
+		t: t,
+		solution: func(stdin io.Reader, stdout io.Writer) *processResult {
+			solutionInput, solutionOutput = stdin.(*os.File), stdout.(*os.File)
+			return sumSolution(0)(stdin, stdout)
+		},
+		interactor: sumInteractor,
+	}
+	testInteractor := &interactor{command: []string{"/build/interactor/interactor"}, workdir: t.TempDir()}
+	options := processRunOptions{input: "1 2\n", expected: "3\n", limits: newTestLimits()}
+	_, err := runInteractiveProcess(runner, testInteractor, options, "/build/solution/solution")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []*os.File{solutionInput, solutionOutput} {
+		if _, err := file.Stat(); err == nil {
+			t.Errorf("pipe %s is not closed", file.Name())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// IOMode - defines how solution reads input and writes output
+type IOMode string
+
+const (
+	// IOStdio - solution reads stdin and writes stdout
+	IOStdio IOMode = "stdio"
+	// IOFile - solution reads input file and writes output file in its work directory, like "input.txt" and "output.txt"
+	IOFile IOMode = "file"
+
+	defaultInputFile  = "input.txt"
+	defaultOutputFile = "output.txt"
+)
+
+// AssignmentIO - input and output settings of the assignment solutions
+// InputFile, OutputFile - names of the files used in "file" mode
+type AssignmentIO struct {
+	Mode       IOMode
+	InputFile  string
+	OutputFile string
+}
+
+// newDefaultAssignmentIO - creates settings used when author didn't set them
+func newDefaultAssignmentIO() AssignmentIO {
+	return AssignmentIO{
+		Mode:       IOStdio,
+		InputFile:  defaultInputFile,
+		OutputFile: defaultOutputFile,
+	}
+}
+
+// validateIOFileName - file name should not contain path, so solution cannot read or write outside work directory
+func validateIOFileName(name string) error {
+	if filepath.Base(name) != name || name == "." || name == ".." {
+		return errors.New("invalid I/O file name '" + name + "'")
+	}
+	return nil
+}
+
+// runFileProcess - writes test input into file in the empty work directory, runs solution
+// and checks output file written by solution. Returned error means internal failure.
+func runFileProcess(runner processRunner, checker Checker, assignmentIO AssignmentIO, options processRunOptions, cmd string, arg ...string) (TestResult, error) {
+	// Work directory is cleaned, so output file left by the previous test is never checked.
+	err := os.RemoveAll(options.workdir)
+	if err != nil {
+		return TestResult{}, err
+	}
+	err = os.MkdirAll(options.workdir, os.ModePerm)
+	if err != nil {
+		return TestResult{}, err
+	}
+	err = ioutil.WriteFile(filepath.Join(options.workdir, assignmentIO.InputFile), []byte(options.input), 0644)
+	if err != nil {
+		return TestResult{}, errors.Wrap(err, "cannot write input file")
+	}
+
+	runOptions := options
+	runOptions.input = ""
+	runOptions.writableWorkdir = true
+	result, err := runner.Run(runOptions, cmd, arg...)
+	if err != nil {
+		return TestResult{}, errors.Wrap(err, "cannot run solution")
+	}
+	if testResult, failed := newFailedTestResult(result, options.limits); failed {
+		return testResult, nil
+	}
+	// Output file size is limited by RLIMIT_FSIZE, so it can be read into memory.
+	output, err := ioutil.ReadFile(filepath.Join(options.workdir, assignmentIO.OutputFile))
+	if os.IsNotExist(err) {
+		testResult := newTestResult(VerdictNoOutputFile, result)
+		testResult.Message = "output file '" + assignmentIO.OutputFile + "' not found"
+		return testResult, nil
+	}
+	if err != nil {
+		return TestResult{}, errors.Wrap(err, "cannot read output file")
+	}
+	return checkTestOutput(checker, options, result, output)
+}
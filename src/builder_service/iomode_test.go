@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fileWritingRunner - fake runner which checks input file and writes output file like solution in "file" mode
+type fileWritingRunner struct {
+	t      *testing.T
+	io     AssignmentIO
+	output string
+}
+
+func (r *fileWritingRunner) Run(options processRunOptions, cmd string, arg ...string) (*processResult, error) {
+	if options.input != "" || !options.writableWorkdir {
+		r.t.Errorf("solution got stdin %q, writable work directory %v", options.input, options.writableWorkdir)
+	}
+	input, err := ioutil.ReadFile(filepath.Join(options.workdir, r.io.InputFile))
+	if err != nil || string(input) != "1 2\n" {
+		r.t.Errorf("got input file %q, error %v", input, err)
+	}
+	if r.output != "" {
+		err = ioutil.WriteFile(filepath.Join(options.workdir, r.io.OutputFile), []byte(r.output), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &processResult{}, nil
+}
+
+func TestValidateIOFileName(t *testing.T) {
+	for _, name := range []string{"input.txt", "aplusb.in", "OUTPUT"} {
+		if err := validateIOFileName(name); err != nil {
+			t.Errorf("valid name %q rejected: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../input.txt", "dir/input.txt", "/etc/passwd"} {
+		if err := validateIOFileName(name); err == nil {
+			t.Errorf("invalid name %q accepted", name)
+		}
+	}
+}
+
+func TestNewAssignmentIO(t *testing.T) {
+	assignmentIO, err := newAssignmentIO(RegisterAssignmentRequest{IOMode: IOFile, InputFile: "aplusb.in"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AssignmentIO{Mode: IOFile, InputFile: "aplusb.in", OutputFile: defaultOutputFile}
+	if assignmentIO != want {
+		t.Errorf("got %+v, want %+v", assignmentIO, want)
+	}
+	invalid := []RegisterAssignmentRequest{
+		{IOMode: "socket"},
+		{IOMode: IOFile, InputFile: "../input.txt"},
+		{IOMode: IOFile, InputFile: "data.txt", OutputFile: "data.txt"},
+	}
+	for _, params := range invalid {
+		if _, err := newAssignmentIO(params); err == nil {
+			t.Errorf("invalid settings %+v accepted", params)
+		}
+	}
+}
+
+func TestRunFileProcess(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "iomode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workdir)
+	assignmentIO := AssignmentIO{Mode: IOFile, InputFile: "aplusb.in", OutputFile: "aplusb.out"}
+	checker, err := newChecker(AssignmentChecker{Kind: CheckerTokens}, nil, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := processRunOptions{workdir: workdir, input: "1 2\n", expected: "3\n", limits: newTestLimits()}
+
+	cases := []struct {
+		output  string
+		verdict Verdict
+	}{
+		{"3\n", VerdictAccepted},
+		{"4\n", VerdictWrongAnswer},
+		// Output file written by the previous test is removed, so solution which writes nothing gets NOF.
+		{"", VerdictNoOutputFile},
+	}
+	for _, c := range cases {
+		runner := &fileWritingRunner{t: t, io: assignmentIO, output: c.output}
+		result, err := runFileProcess(runner, checker, assignmentIO, options, "solution")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != c.verdict {
+			t.Errorf("output %q: got verdict %s, want %s", c.output, result.Verdict, c.verdict)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "github.com/pkg/errors"
+
+// JudgingMode - defines which tests are run for the build
+type JudgingMode string
+
+const (
+	// ModeFull - runs all tests of the assignment
+	ModeFull JudgingMode = "full"
+	// ModeStopOnFirstFailure - stops testing on the first failed test, like ACM contests
+	ModeStopOnFirstFailure JudgingMode = "stop_on_first_failure"
+	// ModeSamplesOnly - runs only sample tests, which are shown to students as examples.
+	// Such builds give quick feedback and are not counted as scored submissions.
+	ModeSamplesOnly JudgingMode = "samples_only"
+)
+
+// validateJudgingMode - returns given mode or error if mode is unknown, empty mode means full
+func validateJudgingMode(mode JudgingMode) (JudgingMode, error) {
+	switch mode {
+	case "":
+		return ModeFull, nil
+	case ModeFull, ModeStopOnFirstFailure, ModeSamplesOnly:
+		return mode, nil
+	}
+	return "", errors.New("unknown judging mode '" + string(mode) + "'")
+}
+
+// selectTestCases - returns test cases which should be run in given mode
+func selectTestCases(mode JudgingMode, cases []TestCase) []TestCase {
+	if mode != ModeSamplesOnly {
+		return cases
+	}
+	var samples []TestCase
+	for _, testCase := range cases {
+		if testCase.Sample {
+			samples = append(samples, testCase)
+		}
+	}
+	return samples
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateJudgingMode(t *testing.T) {
+	for _, mode := range []JudgingMode{ModeFull, ModeStopOnFirstFailure, ModeSamplesOnly} {
+		got, err := validateJudgingMode(mode)
+		if err != nil || got != mode {
+			t.Errorf("mode %q: got %q, %v", mode, got, err)
+		}
+	}
+	if got, err := validateJudgingMode(""); err != nil || got != ModeFull {
+		t.Errorf("empty mode: got %q, %v, want %q", got, err, ModeFull)
+	}
+	if _, err := validateJudgingMode("fast"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+func TestSelectTestCases(t *testing.T) {
+	cases := []TestCase{
+		{Input: "1", Sample: true},
+		{Input: "2"},
+		{Input: "3", Sample: true},
+	}
+	for _, mode := range []JudgingMode{ModeFull, ModeStopOnFirstFailure} {
+		if got := selectTestCases(mode, cases); !reflect.DeepEqual(got, cases) {
+			t.Errorf("mode %q: got %v, want all tests", mode, got)
+		}
+	}
+	want := []TestCase{cases[0], cases[2]}
+	if got := selectTestCases(ModeSamplesOnly, cases); !reflect.DeepEqual(got, want) {
+		t.Errorf("samples only: got %v, want %v", got, want)
+	}
+	if got := selectTestCases(ModeSamplesOnly, cases[1:2]); len(got) != 0 {
+		t.Errorf("samples only without samples: got %v", got)
+	}
+}
@@ -1,8 +1,252 @@
 package main
 
+import (
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
 type language string
 
 const (
-	languageCpp    = "c++"
-	languagePascal = "pascal"
+	languageCpp        = "c++"
+	languagePascal     = "pascal"
+	languagePython     = "python3"
+	languageJavaScript = "javascript"
+)
+
+// Placeholders which can be used in compile and run command templates
+const (
+	placeholderSource     = "{source}"
+	placeholderExecutable = "{executable}"
+	placeholderDir        = "{dir}"
 )
+
+// LanguageConfig - settings of the programming language supported by builder
+// SourceFile - name of the source file in build directory, e.g. "solution.cpp" or "Main.java"
+// CompileCommand - compile command template, for interpreted languages it only checks syntax
+// and can be empty
+// RunCommand - run command template, for interpreted languages it runs interpreter with source file
+// Templates can contain "{source}", "{executable}" and "{dir}" placeholders, replaced with absolute paths.
+// VersionCommand - prints compiler version, which is part of the compile cache key,
+// compile command program with "--version" argument by default
+// TimeMultiplier, MemoryMultiplier - multipliers applied to assignment limits, 1 by default
+// MaxProcesses, MaxOpenFiles - override default process limits, runtimes like Node.js need more
+type LanguageConfig struct {
+	ID               language `json:"id"`
+	Title            string   `json:"title"`
+	SourceFile       string   `json:"source_file"`
+	CompileCommand   []string `json:"compile_command"`
+	RunCommand       []string `json:"run_command"`
+	VersionCommand   []string `json:"version_command"`
+	TimeMultiplier   float64  `json:"time_multiplier"`
+	MemoryMultiplier float64  `json:"memory_multiplier"`
+	MaxProcesses     int      `json:"max_processes"`
+	MaxOpenFiles     int      `json:"max_open_files"`
+}
+
+// languageRegistry - keeps languages enabled in builder configuration
+type languageRegistry struct {
+	languages []*LanguageConfig
+	byID      map[language]*LanguageConfig
+}
+
+// newDefaultLanguageConfigs - returns languages enabled when configuration does not list them
+func newDefaultLanguageConfigs() []LanguageConfig {
+	return []LanguageConfig{
+		{
+			ID:             languageCpp,
+			Title:          "C++17",
+			SourceFile:     "solution.cpp",
+			CompileCommand: []string{"g++", placeholderSource, "-o", placeholderExecutable, "--std=c++17"},
+			RunCommand:     []string{placeholderExecutable},
+		},
+		{
+			ID:         languagePascal,
+			Title:      "Free Pascal",
+			SourceFile: "solution.pas",
+			// GNU Pascal is outdated - we don't use it anymore.
+			CompileCommand: []string{"fpc", "-Mtp", "-So", "-o" + placeholderExecutable, placeholderSource},
+			RunCommand:     []string{placeholderExecutable},
+			VersionCommand: []string{"fpc", "-iW"},
+		},
+		{
+			ID:             languagePython,
+			Title:          "Python 3",
+			SourceFile:     "solution.py",
+			CompileCommand: []string{"python3", "-m", "py_compile", placeholderSource},
+			RunCommand:     []string{"python3", "-B", placeholderSource},
+			TimeMultiplier: 3,
+		},
+		{
+			ID:             languageJavaScript,
+			Title:          "JavaScript (Node.js)",
+			SourceFile:     "solution.js",
+			CompileCommand: []string{"node", "--check", placeholderSource},
+			RunCommand:     []string{"node", placeholderSource},
+			TimeMultiplier: 2,
+			MaxProcesses:   16,
+			MaxOpenFiles:   32,
+		},
+	}
+}
+
+// newLanguageRegistry - validates languages from configuration and creates registry.
+// Default languages are enabled only if their compiler or interpreter is installed.
+func newLanguageRegistry(configs []LanguageConfig) (*languageRegistry, error) {
+	if len(configs) == 0 {
+		configs = filterInstalledLanguages(newDefaultLanguageConfigs())
+	}
+	registry := new(languageRegistry)
+	registry.byID = make(map[language]*LanguageConfig)
+	for i := range configs {
+		config := configs[i]
+		if len(config.ID) == 0 {
+			return nil, errors.Errorf("language #%d has no id", i)
+		}
+		if _, ok := registry.byID[config.ID]; ok {
+			return nil, errors.New("language '" + string(config.ID) + "' listed twice")
+		}
+		if len(config.SourceFile) == 0 || filepath.Base(config.SourceFile) != config.SourceFile {
+			return nil, errors.New("language '" + string(config.ID) + "' has invalid source file name")
+		}
+		if len(config.RunCommand) == 0 {
+			return nil, errors.New("language '" + string(config.ID) + "' has no run command")
+		}
+		if config.TimeMultiplier == 0 {
+			config.TimeMultiplier = 1
+		}
+		if config.MemoryMultiplier == 0 {
+			config.MemoryMultiplier = 1
+		}
+		if config.TimeMultiplier < 0 || config.MemoryMultiplier < 0 || config.MaxProcesses < 0 || config.MaxOpenFiles < 0 {
+			return nil, errors.New("language '" + string(config.ID) + "' has negative limit")
+		}
+		registry.languages = append(registry.languages, &config)
+		registry.byID[config.ID] = &config
+	}
+	return registry, nil
+}
+
+// filterInstalledLanguages - returns languages which have all required programs in PATH
+func filterInstalledLanguages(configs []LanguageConfig) []LanguageConfig {
+	var installed []LanguageConfig
+	for _, config := range configs {
+		programs := []string{config.RunCommand[0]}
+		if len(config.CompileCommand) != 0 {
+			programs = append(programs, config.CompileCommand[0])
+		}
+		missed := false
+		for _, program := range programs {
+			if strings.HasPrefix(program, "{") {
+				continue
+			}
+			_, err := exec.LookPath(program)
+			if err != nil {
+				logrus.WithField("language", config.ID).WithField("program", program).Warn("language disabled: program not found")
+				missed = true
+				break
+			}
+		}
+		if !missed {
+			installed = append(installed, config)
+		}
+	}
+	return installed
+}
+
+// get - returns enabled language with given ID
+func (r *languageRegistry) get(id language) (*LanguageConfig, bool) {
+	config, ok := r.byID[id]
+	return config, ok
+}
+
+// list - returns enabled languages in configuration order
+func (r *languageRegistry) list() []*LanguageConfig {
+	return r.languages
+}
+
+// languageFiles - absolute paths used to expand command templates
+type languageFiles struct {
+	dir        string
+	source     string
+	executable string
+}
+
+// newLanguageFiles - returns paths of the source and executable for given build directory
+func newLanguageFiles(config *LanguageConfig, dir string, executableName string) (languageFiles, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return languageFiles{}, err
+	}
+	return languageFiles{
+		dir:        dir,
+		source:     filepath.Join(dir, config.SourceFile),
+		executable: filepath.Join(dir, executableName),
+	}, nil
+}
+
+func (f languageFiles) expand(template []string) []string {
+	replacer := strings.NewReplacer(
+		placeholderSource, f.source,
+		placeholderExecutable, f.executable,
+		placeholderDir, f.dir)
+	command := make([]string, 0, len(template))
+	for _, arg := range template {
+		command = append(command, replacer.Replace(arg))
+	}
+	return command
+}
+
+// compileCommand - returns compile command, or nil if language does not need compilation
+func (c *LanguageConfig) compileCommand(files languageFiles) []string {
+	if len(c.CompileCommand) == 0 {
+		return nil
+	}
+	return files.expand(c.CompileCommand)
+}
+
+// compilesExecutable - returns true if compile command writes program to "{executable}" path,
+// other languages, like Java, can write any files into build directory
+func (c *LanguageConfig) compilesExecutable() bool {
+	for _, arg := range c.CompileCommand {
+		if strings.Contains(arg, placeholderExecutable) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionCommand - returns command which prints compiler version, or nil if language does not need compilation
+func (c *LanguageConfig) versionCommand() []string {
+	if len(c.VersionCommand) != 0 {
+		return c.VersionCommand
+	}
+	if len(c.CompileCommand) == 0 {
+		return nil
+	}
+	return []string{c.CompileCommand[0], "--version"}
+}
+
+// runCommand - returns command which runs compiled program
+func (c *LanguageConfig) runCommand(files languageFiles) []string {
+	return files.expand(c.RunCommand)
+}
+
+// scaleLimits - applies language multipliers and process limit to the process limits
+func (c *LanguageConfig) scaleLimits(limits *processLimits) *processLimits {
+	scaled := *limits
+	if c.MaxProcesses != 0 {
+		scaled.NumberOfProc = c.MaxProcesses
+	}
+	if c.MaxOpenFiles != 0 {
+		scaled.NumberOfFiles = c.MaxOpenFiles
+	}
+	scaled.TimeLimitMs = int(math.Ceil(float64(limits.TimeLimitMs) * c.TimeMultiplier))
+	scaled.AddessSpaceMB = int(math.Ceil(float64(limits.AddessSpaceMB) * c.MemoryMultiplier))
+	return &scaled
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewLanguageRegistryValidatesConfigs(t *testing.T) {
+	valid := LanguageConfig{ID: languageCpp, SourceFile: "solution.cpp", RunCommand: []string{placeholderExecutable}}
+	invalid := map[string][]LanguageConfig{
+		"no id":               {{SourceFile: "solution.cpp", RunCommand: valid.RunCommand}},
+		"listed twice":        {valid, valid},
+		"no source file":      {{ID: languageCpp, RunCommand: valid.RunCommand}},
+		"source file path":    {{ID: languageCpp, SourceFile: "../solution.cpp", RunCommand: valid.RunCommand}},
+		"no run command":      {{ID: languageCpp, SourceFile: "solution.cpp"}},
+		"negative multiplier": {{ID: languageCpp, SourceFile: "solution.cpp", RunCommand: valid.RunCommand, TimeMultiplier: -1}},
+	}
+	for name, configs := range invalid {
+		if _, err := newLanguageRegistry(configs); err == nil {
+			t.Errorf("%s: invalid configuration accepted", name)
+		}
+	}
+
+	registry, err := newLanguageRegistry([]LanguageConfig{valid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, ok := registry.get(languageCpp)
+	if !ok || len(registry.list()) != 1 {
+		t.Fatal("configured language is not enabled")
+	}
+	if config.TimeMultiplier != 1 || config.MemoryMultiplier != 1 {
+		t.Errorf("got multipliers %v and %v, want 1 by default", config.TimeMultiplier, config.MemoryMultiplier)
+	}
+	if _, ok := registry.get(languagePascal); ok {
+		t.Error("language missed in configuration is enabled")
+	}
+}
+
+func TestLanguageCommands(t *testing.T) {
+	config := &LanguageConfig{
+		ID:             "java",
+		SourceFile:     "Main.java",
+		CompileCommand: []string{"javac", "-d", placeholderDir, placeholderSource},
+		RunCommand:     []string{"java", "-cp", placeholderDir, "Main"},
+	}
+	files, err := newLanguageFiles(config, "/build/solution", "solution")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := config.compileCommand(files), []string{"javac", "-d", "/build/solution", "/build/solution/Main.java"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got compile command %v, want %v", got, want)
+	}
+	if got, want := config.runCommand(files), []string{"java", "-cp", "/build/solution", "Main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got run command %v, want %v", got, want)
+	}
+}
+
+func TestLanguageScaleLimits(t *testing.T) {
+	config := &LanguageConfig{TimeMultiplier: 1.5, MemoryMultiplier: 2}
+	limits := newTestLimits()
+	scaled := config.scaleLimits(limits)
+	if scaled.TimeLimitMs != 1500 || scaled.AddessSpaceMB != 128 {
+		t.Errorf("got %d ms and %d MB", scaled.TimeLimitMs, scaled.AddessSpaceMB)
+	}
+	if limits.TimeLimitMs != 1000 || limits.AddessSpaceMB != 64 {
+		t.Error("assignment limits changed")
+	}
+}
+
+func TestFilterInstalledLanguages(t *testing.T) {
+	configs := []LanguageConfig{
+		{ID: languageCpp, CompileCommand: []string{"sh"}, RunCommand: []string{placeholderExecutable}},
+		{ID: languagePython, RunCommand: []string{"sh", placeholderSource}},
+		{ID: languageJavaScript, CompileCommand: []string{"missed-compiler-for-test"}, RunCommand: []string{"sh"}},
+	}
+	var ids []language
+	for _, config := range filterInstalledLanguages(configs) {
+		ids = append(ids, config.ID)
+	}
+	if want := []language{languageCpp, languagePython}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got languages %v, want %v", ids, want)
+	}
+}
+
+func TestInterpretedLanguageWithoutCompileCommand(t *testing.T) {
+	config := &LanguageConfig{ID: languagePython, SourceFile: "solution.py", RunCommand: []string{"python3", placeholderSource}}
+	files, err := newLanguageFiles(config, "/build/solution", "solution")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fake runner without results fails if compiler is started.
+	result, err := compileSolution(newFakeRunner(), config, files, newTestLimits(), 1024)
+	if err != nil || result.failure != nil {
+		t.Errorf("got %v, %v", result.failure, err)
+	}
+	if got, want := config.runCommand(files), []string{"python3", "/build/solution/solution.py"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got run command %v, want %v", got, want)
+	}
+}
+
+func TestLanguageProcessLimits(t *testing.T) {
+	limits := newTestLimits()
+	scaled := (&LanguageConfig{MaxProcesses: 16, MaxOpenFiles: 32, TimeMultiplier: 1, MemoryMultiplier: 1}).scaleLimits(limits)
+	if scaled.NumberOfProc != 16 || scaled.NumberOfFiles != 32 {
+		t.Errorf("got %d processes and %d files", scaled.NumberOfProc, scaled.NumberOfFiles)
+	}
+	scaled = (&LanguageConfig{TimeMultiplier: 1, MemoryMultiplier: 1}).scaleLimits(limits)
+	if scaled.NumberOfProc != limits.NumberOfProc || scaled.NumberOfFiles != limits.NumberOfFiles {
+		t.Error("default process limits changed")
+	}
+}
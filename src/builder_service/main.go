@@ -12,16 +12,51 @@ import (
 )
 
 func main() {
+	// Builder re-executes itself to prepare sandbox for the solution
+	if isSandboxInit() {
+		runSandboxInit()
+	}
+
 	config, err := ParseConfig()
 	if err != nil {
 		panic(err)
 	}
 
+	config.Sandbox.HiddenDirs, err = config.GetPrivateDirs()
+	if err != nil {
+		panic(err)
+	}
+	runner, err := newProcessRunner(config.Sandbox)
+	if err != nil {
+		panic(err)
+	}
+
+	languages, err := newLanguageRegistry(config.Languages)
+	if err != nil {
+		panic(err)
+	}
+
+	cache, err := newCompileCache(config.CompileCache, languages)
+	if err != nil {
+		panic(err)
+	}
+	compiler := newSolutionCompiler(runner, config.CompileLimits, cache)
+
+	blobs, err := newBlobStore(config.BlobStore)
+	if err != nil {
+		panic(err)
+	}
+	data := newDataStore(blobs, config.BlobStore)
+
 	databaseConnector := NewMySQLConnector(config)
 	events := judgeevents.NewBuilderEvents(config.AmqpSocket)
-	context := &apiContext{databaseConnector}
+	context := &apiContext{databaseConnector, languages, events, data}
 
-	master := NewBuildMaster(databaseConnector, events)
+	nodeID, err := config.GetNodeID()
+	if err != nil {
+		panic(err)
+	}
+	master := NewBuildMaster(databaseConnector, events, runner, languages, compiler, data, nodeID, config.Workers, config.MaxReportSizeKB)
 	killChan := getKillSignalChan()
 	service := restapi.NewService(restapi.ServiceConfig{
 		RouterConfig: g_routes,
@@ -0,0 +1,35 @@
+package main
+
+import "github.com/pkg/errors"
+
+// BuildPriority - defines order in which pending builds are dispatched to workers
+type BuildPriority string
+
+const (
+	// PriorityContest - solution submitted during contest
+	PriorityContest BuildPriority = "contest"
+	// PriorityPractice - solution submitted out of contest, used when priority is not set
+	PriorityPractice BuildPriority = "practice"
+	// PriorityRejudge - rejudged build
+	PriorityRejudge BuildPriority = "rejudge"
+)
+
+// buildPriorityLevels - priority values stored in database, builds with greater value are dispatched first.
+// Rejudges have the lowest priority, so mass rejudge cannot delay live contest submissions.
+var buildPriorityLevels = map[BuildPriority]int{
+	PriorityRejudge:  0,
+	PriorityPractice: 1,
+	PriorityContest:  2,
+}
+
+// getBuildPriorityLevel - returns database value for the priority, empty priority means practice
+func getBuildPriorityLevel(priority BuildPriority) (int, error) {
+	if len(priority) == 0 {
+		priority = PriorityPractice
+	}
+	level, ok := buildPriorityLevels[priority]
+	if !ok {
+		return 0, errors.New("unknown priority '" + string(priority) + "'")
+	}
+	return level, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPriorityLevels(t *testing.T) {
+	levels := make(map[BuildPriority]int)
+	for _, priority := range []BuildPriority{PriorityContest, PriorityPractice, PriorityRejudge, ""} {
+		level, err := getBuildPriorityLevel(priority)
+		if err != nil {
+			t.Fatal(err)
+		}
+		levels[priority] = level
+	}
+	if !(levels[PriorityContest] > levels[PriorityPractice] && levels[PriorityPractice] > levels[PriorityRejudge]) {
+		t.Errorf("got priority levels %v, want contest > practice > rejudge", levels)
+	}
+	if levels[""] != levels[PriorityPractice] {
+		t.Errorf("empty priority got level %d, want practice level", levels[""])
+	}
+
+	_, err := getBuildPriorityLevel("urgent")
+	if err == nil {
+		t.Error("unknown priority accepted")
+	}
+}
+
+func TestPullPendingBuildOrder(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE build SET `status`='building'", fakeQueryResult{rowsAffected: 0})
+	_, err := NewBuilderRepository(db).PullPendingBuild("node-1", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := database.executed("UPDATE build SET `status`='building'")
+	if len(claims) != 1 || !strings.Contains(claims[0].query, "ORDER BY `priority` DESC, `submitted_at`") {
+		t.Errorf("pending builds are not claimed by priority and submit time: %+v", claims)
+	}
+}
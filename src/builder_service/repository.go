@@ -1,7 +1,11 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -9,37 +13,124 @@ import (
 // BuildRepository - represents builder database model
 type BuildRepository interface {
 	RegisterBuild(params RegisterBuildParams) error
-	PullPendingBuild() (*PendingBuildResult, error)
+	PullPendingBuild(nodeID string, workerID int, lease time.Duration) (*PendingBuildResult, error)
 	AddBuildReport(params BuildReport) error
 	GetBuildReport(key string) (*BuildReport, error)
 	GetAssignmentID(key string) (int, error)
 }
 
 // RegisterBuildParams - parameters for DB request
+// Priority - priority level, see buildPriorityLevels
 type RegisterBuildParams struct {
 	AssignmentID int64
 	Key          string
 	Language     language
 	Source       string
+	SourceHash   string
+	Priority     int
+	Mode         JudgingMode
 }
 
 // RegisterTestCaseParams - parameters for DB request
+// Group - name of the test group, Weight - weight of the test inside "sum" scoring group
+// Sample - test is shown to students as an example
+// InputHash, ExpectedHash - hashes of input and answer kept in blob store instead of Input and Expected
 type RegisterTestCaseParams struct {
 	AssignmentID int64
 	Key          string
 	Input        string
 	Expected     string
+	InputHash    string
+	ExpectedHash string
+	Group        string
+	Weight       int
+	Sample       bool
 }
 
+// UpdateTestCaseParams - parameters for DB request
+type UpdateTestCaseParams struct {
+	Key          string
+	Input        string
+	Expected     string
+	InputHash    string
+	ExpectedHash string
+	Group        string
+	Weight       int
+	Sample       bool
+}
+
+// ImportTestSetParams - parameters for DB request, imported test cases replace all assignment test cases
+// Groups - replace assignment test groups if not nil
+// Limits, Checker - replace assignment limits and checker if not nil
+type ImportTestSetParams struct {
+	AssignmentID int64
+	Cases        []RegisterTestCaseParams
+	Groups       []TestGroup
+	Limits       *AssignmentLimits
+	Checker      *AssignmentChecker
+}
+
+// sqlExecutor - either database connection or transaction
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// errTestCaseNotFound - test case does not exist or was deleted
+var errTestCaseNotFound = errors.New("test case not found")
+
+// errAssignmentNotFound - assignment was never registered
+var errAssignmentNotFound = errors.New("assignment not found")
+
+// errBuildNotFound - build was never registered
+var errBuildNotFound = errors.New("build not found")
+
+// AssignmentLimits - resource limits for the assignment solutions
+type AssignmentLimits struct {
+	TimeLimitMs   int
+	MemoryLimitMB int
+	OutputLimitKB int
+	StackSizeMB   int
+}
+
+// AssignmentChecker - settings of the checker which compares solution output with expected answer
+// Revision - incremented each time checker settings change
+type AssignmentChecker struct {
+	Kind       CheckerKind
+	AbsEpsilon float64
+	RelEpsilon float64
+	Source     string
+	Language   language
+	Revision   int
+}
+
+// errBuildClaimLost - build was re-queued or finished by someone else, report should be dropped
+var errBuildClaimLost = errors.New("build claim lost")
+
 // BuildReport - parameters for DB request
+// ClaimToken - token of the claim which produced report, report saved only if build is still claimed with it
+// Status - status of the build run which produced report, build itself can be already rejudged
+// Version - number of the report in build history, starting from 1, set when report saved
+// CreatedAt, BuilderNode - unix time when report saved and node which claimed the build
+// TestSetRevision, CheckerRevision - revisions of the assignment test set and checker used for the build
 type BuildReport struct {
-	Key         string
-	Exception   string
-	BuildLog    string
-	TestsLog    string
-	TestsPassed int64
-	TestsTotal  int64
-	Status      Status
+	Key             string
+	ClaimToken      string
+	Attempts        int
+	Version         int
+	CreatedAt       int64
+	BuilderNode     string
+	TestSetRevision int
+	CheckerRevision int
+	Mode            JudgingMode
+	Exception       string
+	BuildLog        string
+	TestsLog        string
+	TestsPassed     int64
+	TestsTotal      int64
+	Status          Status
+	TestResults     []TestResult
+	GroupResults    []GroupResult
+	Diagnostics     []Diagnostic
 }
 
 // PendingBuildResult - parameters for DB request
@@ -47,7 +138,20 @@ type PendingBuildResult struct {
 	AssignmentID int
 	Key          string
 	Source       string
+	SourceHash   string
 	Language     language
+	ClaimToken   string
+	Attempts     int
+	// TestSetRevision - revision of the assignment test set at claim time, build is judged against it
+	TestSetRevision int
+	Mode            JudgingMode
+}
+
+// ExpiredBuild - build which worker didn't prolong lease in time
+type ExpiredBuild struct {
+	Key        string
+	ClaimToken string
+	Attempts   int
 }
 
 // BuilderRepository - models builder service database
@@ -83,69 +187,715 @@ func (r *BuilderRepository) prepare(query string) (*sql.Stmt, error) {
 
 // RegisterBuild - registers new build task
 func (r *BuilderRepository) RegisterBuild(params RegisterBuildParams) error {
-	q := "INSERT INTO build (`assignment_id`, `key`, `status`, `language`, `source`) VALUES (?, ?, ?, ?, ?)"
-	_, err := r.query(q, params.AssignmentID, params.Key, "pending", params.Language, params.Source)
-	return err
+	q := "INSERT INTO build (`assignment_id`, `key`, `status`, `language`, `source`, `source_hash`, `priority`, `mode`, `submitted_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())"
+	_, err := r.db.Exec(q, params.AssignmentID, params.Key, "pending", params.Language, params.Source, params.SourceHash, params.Priority, params.Mode)
+	if err != nil {
+		return errors.Wrap(err, "SQL INSERT query failed")
+	}
+	return nil
+}
+
+// RegisterTestCase - appends new test case to the assignment test set, creates new test set revision
+func (r *BuilderRepository) RegisterTestCase(params RegisterTestCaseParams) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	revision, err := newTestSetRevision(tx, params.AssignmentID)
+	if err != nil {
+		return 0, err
+	}
+	var index int
+	err = tx.QueryRow("SELECT COALESCE(MAX(`test_index`), -1) + 1 FROM testcase WHERE `assignment_id`=? AND `revision_removed` IS NULL", params.AssignmentID).Scan(&index)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	q := "INSERT INTO testcase (`assignment_id`, `key`, `test_index`, `input`, `expected`, `input_hash`, `expected_hash`, `group_name`, `weight`, `sample`, `revision_added`) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(q, params.AssignmentID, params.Key, index, params.Input, params.Expected, params.InputHash, params.ExpectedHash, params.Group, params.Weight, params.Sample, revision)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL INSERT query failed")
+	}
+
+	return revision, commitTestSetRevision(tx)
+}
+
+// UpdateTestCase - replaces input and expected answer of the test case, creates new test set revision.
+// Previous revisions keep old test case. Returns errTestCaseNotFound if test case was deleted.
+func (r *BuilderRepository) UpdateTestCase(params UpdateTestCaseParams) (int, error) {
+	return r.changeTestCase(params.Key, func(tx *sql.Tx, assignmentID int64, index int, revision int) error {
+		q := "INSERT INTO testcase (`assignment_id`, `key`, `test_index`, `input`, `expected`, `input_hash`, `expected_hash`, `group_name`, `weight`, `sample`, `revision_added`) " +
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err := tx.Exec(q, assignmentID, params.Key, index, params.Input, params.Expected, params.InputHash, params.ExpectedHash, params.Group, params.Weight, params.Sample, revision)
+		if err != nil {
+			return errors.Wrap(err, "SQL INSERT query failed")
+		}
+		return nil
+	})
+}
+
+// DeleteTestCase - removes test case from the assignment test set, creates new test set revision.
+// Previous revisions keep deleted test case. Returns errTestCaseNotFound if test case was already deleted.
+func (r *BuilderRepository) DeleteTestCase(key string) (int, error) {
+	return r.changeTestCase(key, func(tx *sql.Tx, assignmentID int64, index int, revision int) error {
+		return nil
+	})
+}
+
+// changeTestCase - removes current version of the test case in new test set revision,
+// then calls replace to add new version if needed
+func (r *BuilderRepository) changeTestCase(key string, replace func(tx *sql.Tx, assignmentID int64, index int, revision int) error) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	var assignmentID int64
+	err = tx.QueryRow("SELECT `assignment_id` FROM testcase WHERE `key`=? AND `revision_removed` IS NULL", key).Scan(&assignmentID)
+	if err == sql.ErrNoRows {
+		return 0, errTestCaseNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	revision, err := newTestSetRevision(tx, assignmentID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Assignment row is locked now, so test case cannot be changed concurrently.
+	var id int64
+	var index int
+	err = tx.QueryRow("SELECT `id`, `test_index` FROM testcase WHERE `key`=? AND `revision_removed` IS NULL FOR UPDATE", key).Scan(&id, &index)
+	if err == sql.ErrNoRows {
+		return 0, errTestCaseNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	_, err = tx.Exec("UPDATE testcase SET `revision_removed`=? WHERE `id`=?", revision, id)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	err = replace(tx, assignmentID, index, revision)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, commitTestSetRevision(tx)
+}
+
+// newTestSetRevision - locks assignment and increments its test set revision, returns new revision
+func newTestSetRevision(tx *sql.Tx, assignmentID int64) (int, error) {
+	var revision int
+	err := tx.QueryRow("SELECT `testset_revision` FROM assignment WHERE `id`=? FOR UPDATE", assignmentID).Scan(&revision)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot read test set revision of assignment %d", assignmentID)
+	}
+	revision++
+	_, err = tx.Exec("UPDATE assignment SET `testset_revision`=? WHERE `id`=?", revision, assignmentID)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	return revision, nil
+}
+
+func commitTestSetRevision(tx *sql.Tx) error {
+	err := tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "cannot commit transaction")
+	}
+	return nil
+}
+
+// SetTestGroups - replaces test groups of the assignment, creates new test set revision.
+// Previous revisions keep old test groups.
+func (r *BuilderRepository) SetTestGroups(assignmentID int64, groups []TestGroup) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	revision, err := newTestSetRevision(tx, assignmentID)
+	if err != nil {
+		return 0, err
+	}
+	err = replaceTestGroups(tx, assignmentID, groups, revision)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, commitTestSetRevision(tx)
+}
+
+// replaceTestGroups - removes current test groups of the assignment and adds new ones in given test set revision
+func replaceTestGroups(tx *sql.Tx, assignmentID int64, groups []TestGroup, revision int) error {
+	_, err := tx.Exec("UPDATE test_group SET `revision_removed`=? WHERE `assignment_id`=? AND `revision_removed` IS NULL", revision, assignmentID)
+	if err != nil {
+		return errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	stmt, err := tx.Prepare("INSERT INTO test_group (`assignment_id`, `group_index`, `name`, `points`, `scoring`, `dependencies`, `revision_added`) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return errors.Wrap(err, "sql prepare failed")
+	}
+	defer stmt.Close()
+	for i, group := range groups {
+		_, err = stmt.Exec(assignmentID, i, group.Name, group.Points, group.Scoring, strings.Join(group.Dependencies, ","), revision)
+		if err != nil {
+			return errors.Wrap(err, "SQL INSERT query failed")
+		}
+	}
+	return nil
+}
+
+// ImportTestSet - replaces all test cases of the assignment and optionally its test groups, limits and checker
+// in one new test set revision. Previous revisions keep old test cases.
+func (r *BuilderRepository) ImportTestSet(params ImportTestSetParams) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	revision, err := newTestSetRevision(tx, params.AssignmentID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("UPDATE testcase SET `revision_removed`=? WHERE `assignment_id`=? AND `revision_removed` IS NULL", revision, params.AssignmentID)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	stmt, err := tx.Prepare("INSERT INTO testcase (`assignment_id`, `key`, `test_index`, `input`, `expected`, `input_hash`, `expected_hash`, `group_name`, `weight`, `sample`, `revision_added`) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, errors.Wrap(err, "sql prepare failed")
+	}
+	defer stmt.Close()
+	for i, testCase := range params.Cases {
+		_, err = stmt.Exec(params.AssignmentID, testCase.Key, i, testCase.Input, testCase.Expected, testCase.InputHash, testCase.ExpectedHash, testCase.Group, testCase.Weight, testCase.Sample, revision)
+		if err != nil {
+			return 0, errors.Wrap(err, "SQL INSERT query failed")
+		}
+	}
+	if params.Groups != nil {
+		err = replaceTestGroups(tx, params.AssignmentID, params.Groups, revision)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if params.Limits != nil {
+		err = setAssignmentLimits(tx, params.AssignmentID, *params.Limits)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if params.Checker != nil {
+		err = setAssignmentChecker(tx, params.AssignmentID, *params.Checker)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return revision, commitTestSetRevision(tx)
+}
+
+// GetTestGroups - returns ordered test groups of the assignment test set with given revision
+func (r *BuilderRepository) GetTestGroups(assignmentID int64, revision int) ([]TestGroup, error) {
+	var groups []TestGroup
+	q := "SELECT `name`, `points`, `scoring`, `dependencies` FROM test_group WHERE `assignment_id`=? AND `revision_added`<=? " +
+		"AND (`revision_removed` IS NULL OR `revision_removed`>?) ORDER BY `group_index`"
+	rows, err := r.query(q, assignmentID, revision, revision)
+	if err != nil {
+		return groups, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var group TestGroup
+		var dependencies string
+		err = rows.Scan(&group.Name, &group.Points, &group.Scoring, &dependencies)
+		if err != nil {
+			return groups, errors.Wrap(err, "scan SQL result failed")
+		}
+		if len(dependencies) != 0 {
+			group.Dependencies = strings.Split(dependencies, ",")
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// GetTestSetRevision - returns current revision of the assignment test set
+func (r *BuilderRepository) GetTestSetRevision(assignmentID int64) (int, error) {
+	rows, err := r.query("SELECT `testset_revision` FROM assignment WHERE `id`=?", assignmentID)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, errors.Errorf("assignment with id %d not found", assignmentID)
+	}
+	var revision int
+	err = rows.Scan(&revision)
+	if err != nil {
+		return 0, errors.Wrap(err, "scan SQL result failed")
+	}
+	return revision, nil
+}
+
+// SetAssignmentSettings - updates resource limits, checker and I/O settings of the assignment in one transaction
+func (r *BuilderRepository) SetAssignmentSettings(assignmentID int64, limits AssignmentLimits, checker AssignmentChecker, assignmentIO AssignmentIO) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	err = setAssignmentLimits(tx, assignmentID, limits)
+	if err != nil {
+		return err
+	}
+	err = setAssignmentChecker(tx, assignmentID, checker)
+	if err != nil {
+		return err
+	}
+	err = setAssignmentIO(tx, assignmentID, assignmentIO)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "cannot commit transaction")
+	}
+	return nil
+}
+
+func setAssignmentLimits(db sqlExecutor, assignmentID int64, limits AssignmentLimits) error {
+	q := "UPDATE assignment SET `time_limit_ms`=?, `memory_limit_mb`=?, `output_limit_kb`=?, `stack_size_mb`=? WHERE `id`=?"
+	_, err := db.Exec(q, limits.TimeLimitMs, limits.MemoryLimitMB, limits.OutputLimitKB, limits.StackSizeMB, assignmentID)
+	if err != nil {
+		return errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	return nil
+}
+
+// GetAssignmentLimits - returns resource limits for the assignment solutions
+func (r *BuilderRepository) GetAssignmentLimits(assignmentID int) (*AssignmentLimits, error) {
+	rows, err := r.query("SELECT `time_limit_ms`, `memory_limit_mb`, `output_limit_kb`, `stack_size_mb` FROM assignment WHERE `id`=?", assignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, errors.Errorf("assignment with id %d not found", assignmentID)
+	}
+	var limits AssignmentLimits
+	err = rows.Scan(&limits.TimeLimitMs, &limits.MemoryLimitMB, &limits.OutputLimitKB, &limits.StackSizeMB)
+	if err != nil {
+		return nil, errors.Wrap(err, "scan SQL result failed")
+	}
+	return &limits, nil
+}
+
+func setAssignmentIO(db sqlExecutor, assignmentID int64, assignmentIO AssignmentIO) error {
+	q := "UPDATE assignment SET `io_mode`=?, `input_file`=?, `output_file`=? WHERE `id`=?"
+	_, err := db.Exec(q, assignmentIO.Mode, assignmentIO.InputFile, assignmentIO.OutputFile, assignmentID)
+	if err != nil {
+		return errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	return nil
+}
+
+// GetAssignmentIO - returns input and output settings for the assignment solutions
+func (r *BuilderRepository) GetAssignmentIO(assignmentID int) (*AssignmentIO, error) {
+	rows, err := r.query("SELECT `io_mode`, `input_file`, `output_file` FROM assignment WHERE `id`=?", assignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, errors.Errorf("assignment with id %d not found", assignmentID)
+	}
+	var assignmentIO AssignmentIO
+	err = rows.Scan(&assignmentIO.Mode, &assignmentIO.InputFile, &assignmentIO.OutputFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "scan SQL result failed")
+	}
+	return &assignmentIO, nil
+}
+
+// setAssignmentChecker - updates checker settings for the assignment solutions,
+// increments checker revision only if checker changed
+func setAssignmentChecker(db sqlExecutor, assignmentID int64, checker AssignmentChecker) error {
+	// MySQL assigns columns from left to right, so revision is compared with the previous checker.
+	q := "UPDATE assignment SET `checker_revision`=IF(`checker`=? AND `checker_abs_epsilon`=? AND `checker_rel_epsilon`=? " +
+		"AND `checker_source`<=>? AND `checker_language`=?, `checker_revision`, `checker_revision`+1), " +
+		"`checker`=?, `checker_abs_epsilon`=?, `checker_rel_epsilon`=?, `checker_source`=?, `checker_language`=? WHERE `id`=?"
+	values := []interface{}{checker.Kind, checker.AbsEpsilon, checker.RelEpsilon, checker.Source, checker.Language}
+	args := append(append(values, values...), assignmentID)
+	_, err := db.Exec(q, args...)
+	if err != nil {
+		return errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	return nil
 }
 
-// RegisterTestCase - registers new test case for the assignment solutions
-func (r *BuilderRepository) RegisterTestCase(params RegisterTestCaseParams) error {
-	q := "INSERT INTO testcase (`assignment_id`, `key`, `input`, `expected`) VALUES (?, ?, ?, ?)"
-	_, err := r.query(q, params.AssignmentID, params.Key, params.Input, params.Expected)
-	return err
+// GetAssignmentChecker - returns checker settings for the assignment solutions
+func (r *BuilderRepository) GetAssignmentChecker(assignmentID int) (*AssignmentChecker, error) {
+	rows, err := r.query("SELECT `checker`, `checker_abs_epsilon`, `checker_rel_epsilon`, `checker_source`, `checker_language`, `checker_revision` FROM assignment WHERE `id`=?", assignmentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, errors.Errorf("assignment with id %d not found", assignmentID)
+	}
+	var checker AssignmentChecker
+	var source sql.NullString
+	err = rows.Scan(&checker.Kind, &checker.AbsEpsilon, &checker.RelEpsilon, &source, &checker.Language, &checker.Revision)
+	if err != nil {
+		return nil, errors.Wrap(err, "scan SQL result failed")
+	}
+	checker.Source = source.String
+	return &checker, nil
 }
 
-// PullPendingBuild - pulls one pending build from database and turns it into 'building' status
-func (r *BuilderRepository) PullPendingBuild() (*PendingBuildResult, error) {
-	rows, err := r.query("SELECT `assignment_id`, `key`, `language`, `source` FROM build WHERE `status` = 'pending' LIMIT 1")
+// PullPendingBuild - atomically claims one pending build for given builder node and worker,
+// and turns it into 'building' status with given lease. Returns nil if there are no pending builds.
+// Builds with higher priority are claimed first, builds with the same priority - in submit order.
+func (r *BuilderRepository) PullPendingBuild(nodeID string, workerID int, lease time.Duration) (*PendingBuildResult, error) {
+	token, err := newClaimToken()
+	if err != nil {
+		return nil, err
+	}
+	// Conditional UPDATE locks the row, so concurrent builders cannot claim the same build.
+	stmt, err := r.prepare("UPDATE build SET `status`='building', `claim_token`=?, `builder_node`=?, `builder_worker`=?, `claimed_at`=NOW(), " +
+		"`lease_expires_at`=NOW() + INTERVAL ? SECOND, `attempts`=`attempts`+1, " +
+		"`testset_revision`=(SELECT `testset_revision` FROM assignment WHERE `assignment`.`id`=`build`.`assignment_id`) " +
+		"WHERE `status`='pending' ORDER BY `priority` DESC, `submitted_at`, `id` LIMIT 1")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(token, nodeID, workerID, int(lease/time.Second))
+	if err != nil {
+		return nil, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	claimed, err := res.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
 	// If no pending build, return nil.
-	if !rows.Next() {
+	if claimed == 0 {
 		return nil, nil
 	}
-	var build PendingBuildResult
-	err = rows.Scan(&build.AssignmentID, &build.Key, &build.Language, &build.Source)
+
+	rows, err := r.query("SELECT `assignment_id`, `key`, `language`, `source`, `source_hash`, `attempts`, `testset_revision`, `mode` FROM build WHERE `claim_token`=?", token)
 	if err != nil {
 		return nil, err
 	}
-	_, err = r.query("UPDATE build SET status='building' WHERE `key`=?", build.Key)
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, errors.New("claimed build not found")
+	}
+	var build PendingBuildResult
+	err = rows.Scan(&build.AssignmentID, &build.Key, &build.Language, &build.Source, &build.SourceHash, &build.Attempts, &build.TestSetRevision, &build.Mode)
 	if err != nil {
 		return nil, err
 	}
+	build.ClaimToken = token
 
 	return &build, nil
 }
 
-// AddBuildReport - adds finished build report
+// ProlongBuildLease - prolongs lease of the build claimed with given token
+func (r *BuilderRepository) ProlongBuildLease(claimToken string, lease time.Duration) error {
+	q := "UPDATE build SET `lease_expires_at`=NOW() + INTERVAL ? SECOND WHERE `claim_token`=? AND `status`='building'"
+	_, err := r.db.Exec(q, int(lease/time.Second), claimToken)
+	if err != nil {
+		return errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	return nil
+}
+
+// GetExpiredBuilds - returns builds in 'building' status with expired lease
+func (r *BuilderRepository) GetExpiredBuilds() ([]ExpiredBuild, error) {
+	var builds []ExpiredBuild
+	rows, err := r.query("SELECT `key`, `claim_token`, `attempts` FROM build WHERE `status`='building' AND `lease_expires_at` < NOW()")
+	if err != nil {
+		return builds, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var build ExpiredBuild
+		err = rows.Scan(&build.Key, &build.ClaimToken, &build.Attempts)
+		if err != nil {
+			return builds, errors.Wrap(err, "scan SQL result failed")
+		}
+		builds = append(builds, build)
+	}
+	return builds, nil
+}
+
+// RequeueBuild - returns claimed build to 'pending' status, when its lease expired or worker cannot start it.
+// Returns false if build was already re-queued or finished.
+func (r *BuilderRepository) RequeueBuild(build ExpiredBuild) (bool, error) {
+	q := "UPDATE build SET `status`='pending', `claim_token`=NULL, `lease_expires_at`=NULL WHERE `key`=? AND `claim_token`=? AND `status`='building'"
+	res, err := r.db.Exec(q, build.Key, build.ClaimToken)
+	if err != nil {
+		return false, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return requeued != 0, nil
+}
+
+// finishedStatuses - SQL list of statuses of builds which can be rejudged
+const finishedStatuses = "('failed', 'succeed', 'exception', 'compilation_timeout')"
+
+// rejudgeBuildsSet - SQL SET clause which returns build to queue as never claimed
+const rejudgeBuildsSet = "SET `status`='pending', `claim_token`=NULL, `builder_node`=NULL, `builder_worker`=NULL, `claimed_at`=NULL, " +
+	"`lease_expires_at`=NULL, `attempts`=0, `priority`=?, `submitted_at`=NOW()"
+
+// RejudgeBuild - returns finished build to queue with given priority, previous reports are kept.
+// Returns false if build is not finished yet, or errBuildNotFound if there is no such build.
+func (r *BuilderRepository) RejudgeBuild(key string, priority int) (bool, error) {
+	q := "UPDATE build " + rejudgeBuildsSet + " WHERE `key`=? AND `status` IN " + finishedStatuses
+	res, err := r.db.Exec(q, priority, key)
+	if err != nil {
+		return false, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	rejudged, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rejudged != 0 {
+		return true, nil
+	}
+	var id int64
+	err = r.db.QueryRow("SELECT id FROM build WHERE `key`=?", key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, errBuildNotFound
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	return false, nil
+}
+
+// RejudgeAssignmentBuilds - returns all finished builds of the assignment to queue with given priority,
+// returns number of builds returned to queue
+func (r *BuilderRepository) RejudgeAssignmentBuilds(assignmentID int64, priority int) (int64, error) {
+	q := "UPDATE build " + rejudgeBuildsSet + " WHERE `assignment_id`=? AND `status` IN " + finishedStatuses
+	res, err := r.db.Exec(q, priority, assignmentID)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL UPDATE query failed")
+	}
+	return res.RowsAffected()
+}
+
+// newClaimToken - creates random token which identifies single build claim
+func newClaimToken() (string, error) {
+	token, err := newRandomKey()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot generate claim token")
+	}
+	return token, nil
+}
+
+// newRandomKey - returns random 32 hex digits key, like keys of objects created by backend
+func newRandomKey() (string, error) {
+	var key [16]byte
+	_, err := rand.Read(key[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key[:]), nil
+}
+
+// AddBuildReport - adds finished build report.
+// Returns errBuildClaimLost if build is not claimed with report claim token anymore.
 func (r *BuilderRepository) AddBuildReport(params BuildReport) error {
 	buildID, err := r.GetBuildID(params.Key)
+	if err != nil {
+		return err
+	}
 
-	_, err = r.query(
-		"INSERT INTO report (`build_id`, `tests_passed`, `tests_total`, `exception`, `build_log`, `tests_log`) VALUES (?, ?, ?, ?, ?, ?)",
-		buildID, params.TestsPassed, params.TestsTotal, params.Exception, params.BuildLog, params.TestsLog)
+	tx, err := r.db.Begin()
 	if err != nil {
-		return errors.Wrap(err, "SQL INSERT query failed")
+		return errors.Wrap(err, "cannot begin transaction")
 	}
-	_, err = r.query("UPDATE build SET status=? WHERE `id`=?", params.Status, buildID)
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE build SET `status`=?, `lease_expires_at`=NULL WHERE `id`=? AND `claim_token`=? AND `status`='building'", params.Status, buildID, params.ClaimToken)
 	if err != nil {
 		return errors.Wrap(err, "SQL UPDATE query failed")
 	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errBuildClaimLost
+	}
+
+	// Build row is locked by UPDATE above, so concurrent reports cannot get the same version.
+	// Attempts are saved with report, because rejudge resets them in build row.
+	var builderNode sql.NullString
+	var attempts int
+	var version int
+	err = tx.QueryRow("SELECT `builder_node`, `attempts`, (SELECT COALESCE(MAX(`version`), 0) + 1 FROM report WHERE `build_id`=`build`.`id`) FROM build WHERE `id`=?", buildID).Scan(&builderNode, &attempts, &version)
+	if err != nil {
+		return errors.Wrap(err, "SQL SELECT query failed")
+	}
+
+	res, err = tx.Exec("INSERT INTO report (`build_id`, `version`, `status`, `created_at`, `builder_node`, `attempts`, `testset_revision`, `checker_revision`, `tests_passed`, `tests_total`, `exception`, `build_log`, `tests_log`) "+
+		"VALUES (?, ?, ?, NOW(), ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		buildID, version, params.Status, builderNode.String, attempts, params.TestSetRevision, params.CheckerRevision, params.TestsPassed, params.TestsTotal, params.Exception, params.BuildLog, params.TestsLog)
+	if err != nil {
+		return errors.Wrap(err, "SQL INSERT query failed")
+	}
+	reportID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = addTestResults(tx, reportID, params.TestResults)
+	if err != nil {
+		return err
+	}
+	err = addGroupResults(tx, reportID, params.GroupResults)
+	if err != nil {
+		return err
+	}
+	err = addDiagnostics(tx, reportID, params.Diagnostics)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "cannot commit transaction")
+	}
+	return nil
+}
+
+func addTestResults(tx *sql.Tx, reportID int64, results []TestResult) error {
+	stmt, err := tx.Prepare("INSERT INTO test_result (`report_id`, `test_index`, `verdict`, `limit_exceeded`, `wall_time_ms`, `cpu_time_ms`, `memory_kb`, `exit_code`, `signal`, `stdout`, `stderr`, `message`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return errors.Wrap(err, "sql prepare failed")
+	}
+	defer stmt.Close()
+	for i, result := range results {
+		_, err = stmt.Exec(reportID, i, result.Verdict, result.LimitExceeded, result.WallTimeMs, result.CPUTimeMs, result.MemoryKB, result.ExitCode, result.Signal, result.Stdout, result.Stderr, result.Message)
+		if err != nil {
+			return errors.Wrap(err, "SQL INSERT query failed")
+		}
+	}
+	return nil
+}
+
+func addGroupResults(tx *sql.Tx, reportID int64, results []GroupResult) error {
+	stmt, err := tx.Prepare("INSERT INTO group_result (`report_id`, `group_index`, `name`, `points`, `score`, `tests_passed`, `tests_total`, `passed`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return errors.Wrap(err, "sql prepare failed")
+	}
+	defer stmt.Close()
+	for i, result := range results {
+		_, err = stmt.Exec(reportID, i, result.Name, result.Points, result.Score, result.TestsPassed, result.TestsTotal, result.Passed)
+		if err != nil {
+			return errors.Wrap(err, "SQL INSERT query failed")
+		}
+	}
+	return nil
+}
+
+func addDiagnostics(tx *sql.Tx, reportID int64, diagnostics []Diagnostic) error {
+	stmt, err := tx.Prepare("INSERT INTO diagnostic (`report_id`, `diagnostic_index`, `file`, `line`, `column`, `severity`, `message`) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return errors.Wrap(err, "sql prepare failed")
+	}
+	defer stmt.Close()
+	for i, diagnostic := range diagnostics {
+		_, err = stmt.Exec(reportID, i, diagnostic.File, diagnostic.Line, diagnostic.Column, diagnostic.Severity, diagnostic.Message)
+		if err != nil {
+			return errors.Wrap(err, "SQL INSERT query failed")
+		}
+	}
+	return nil
+}
+
+func (r *BuilderRepository) getTestResults(reportID int64) ([]TestResult, error) {
+	var results []TestResult
+	rows, err := r.query("SELECT `verdict`, `limit_exceeded`, `wall_time_ms`, `cpu_time_ms`, `memory_kb`, `exit_code`, `signal`, `stdout`, `stderr`, `message` FROM test_result WHERE `report_id`=? ORDER BY `test_index`", reportID)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result TestResult
+		err = rows.Scan(&result.Verdict, &result.LimitExceeded, &result.WallTimeMs, &result.CPUTimeMs, &result.MemoryKB, &result.ExitCode, &result.Signal, &result.Stdout, &result.Stderr, &result.Message)
+		if err != nil {
+			return results, errors.Wrap(err, "scan SQL result failed")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (r *BuilderRepository) getGroupResults(reportID int64) ([]GroupResult, error) {
+	var results []GroupResult
+	rows, err := r.query("SELECT `name`, `points`, `score`, `tests_passed`, `tests_total`, `passed` FROM group_result WHERE `report_id`=? ORDER BY `group_index`", reportID)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result GroupResult
+		err = rows.Scan(&result.Name, &result.Points, &result.Score, &result.TestsPassed, &result.TestsTotal, &result.Passed)
+		if err != nil {
+			return results, errors.Wrap(err, "scan SQL result failed")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
 
-	return err
+func (r *BuilderRepository) getDiagnostics(reportID int64) ([]Diagnostic, error) {
+	var diagnostics []Diagnostic
+	rows, err := r.query("SELECT `file`, `line`, `column`, `severity`, `message` FROM diagnostic WHERE `report_id`=? ORDER BY `diagnostic_index`", reportID)
+	if err != nil {
+		return diagnostics, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var diagnostic Diagnostic
+		err = rows.Scan(&diagnostic.File, &diagnostic.Line, &diagnostic.Column, &diagnostic.Severity, &diagnostic.Message)
+		if err != nil {
+			return diagnostics, errors.Wrap(err, "scan SQL result failed")
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics, nil
 }
 
-// GetTestCases - returns list of test cases for the assignment solutions
-func (r *BuilderRepository) GetTestCases(assignmentID int) ([]TestCase, error) {
+// GetTestCases - returns ordered test cases of the assignment test set with given revision
+func (r *BuilderRepository) GetTestCases(assignmentID int64, revision int) ([]TestCase, error) {
 	var cases []TestCase
-	rows, err := r.query("SELECT input, expected FROM testcase WHERE `assignment_id`=?", assignmentID)
+	q := "SELECT `key`, `test_index`, `input`, `expected`, `input_hash`, `expected_hash`, `group_name`, `weight`, `sample` FROM testcase WHERE `assignment_id`=? AND `revision_added`<=? " +
+		"AND (`revision_removed` IS NULL OR `revision_removed`>?) ORDER BY `test_index`, `id`"
+	rows, err := r.query(q, assignmentID, revision, revision)
 	if err != nil {
 		return cases, errors.Wrap(err, "SQL SELECT query failed")
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var result TestCase
-		err = rows.Scan(&result.Input, &result.Expected)
+		err = rows.Scan(&result.Key, &result.Index, &result.Input, &result.Expected, &result.InputHash, &result.ExpectedHash, &result.Group, &result.Weight, &result.Sample)
 		if err != nil {
 			return cases, errors.Wrap(err, "scan SQL result failed")
 		}
@@ -160,6 +910,7 @@ func (r *BuilderRepository) GetBuildStatus(key string) (Status, error) {
 	if err != nil {
 		return "", errors.Wrap(err, "SQL SELECT query failed")
 	}
+	defer rows.Close()
 	if !rows.Next() {
 		return "", errors.New("build with key '" + key + "' not found")
 	}
@@ -171,67 +922,111 @@ func (r *BuilderRepository) GetBuildStatus(key string) (Status, error) {
 	return status, nil
 }
 
-// GetBuildReport - returns detailed report for finished build
+// reportColumns - columns of the report table scanned by scanBuildReport
+const reportColumns = "`id`, `version`, `status`, UNIX_TIMESTAMP(`created_at`), `builder_node`, `attempts`, `testset_revision`, `checker_revision`, " +
+	"`tests_passed`, `tests_total`, `exception`, `build_log`, `tests_log`"
+
+// GetBuildReport - returns the latest report for finished or rejudged build
 func (r *BuilderRepository) GetBuildReport(key string) (*BuildReport, error) {
-	rows, err := r.query("SELECT id, status FROM build WHERE `key`=?", key)
+	reports, err := r.getBuildReports(key, "SELECT "+reportColumns+" FROM report WHERE `build_id`=? ORDER BY `version` DESC LIMIT 1")
 	if err != nil {
-		return nil, errors.Wrap(err, "SQL SELECT query failed")
+		return nil, err
 	}
-	if !rows.Next() {
-		return nil, errors.New("build with key '" + key + "' not found")
+	if len(reports) == 0 {
+		return nil, errors.New("report for build with key '" + key + "' not found")
 	}
+	return &reports[0], nil
+}
+
+// GetBuildReports - returns all reports of the build ordered by version
+func (r *BuilderRepository) GetBuildReports(key string) ([]BuildReport, error) {
+	return r.getBuildReports(key, "SELECT "+reportColumns+" FROM report WHERE `build_id`=? ORDER BY `version`")
+}
+
+// getBuildReports - returns build reports selected with given query which has build ID parameter
+func (r *BuilderRepository) getBuildReports(key string, q string) ([]BuildReport, error) {
 	var buildID int64
-	var status Status
-	err = rows.Scan(&buildID, &status)
-	if err != nil {
-		return nil, errors.Wrap(err, "scan SQL result failed")
+	var mode JudgingMode
+	err := r.db.QueryRow("SELECT id, `mode` FROM build WHERE `key`=?", key).Scan(&buildID, &mode)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("build with key '" + key + "' not found")
 	}
-
-	rows, err = r.query("SELECT tests_passed, tests_total, exception, build_log, tests_log FROM report WHERE `build_id`=?", buildID)
 	if err != nil {
 		return nil, errors.Wrap(err, "SQL SELECT query failed")
 	}
-	if !rows.Next() {
-		return nil, errors.New("report for build with key '" + key + "' not found")
-	}
 
-	var report BuildReport
-	report.Key = key
-	report.Status = status
-	err = rows.Scan(&report.TestsPassed, &report.TestsTotal, &report.Exception, &report.BuildLog, &report.TestsLog)
+	rows, err := r.query(q, buildID)
 	if err != nil {
-		return nil, errors.Wrap(err, "scan SQL result failed")
+		return nil, errors.Wrap(err, "SQL SELECT query failed")
+	}
+	defer rows.Close()
+	var reports []BuildReport
+	var reportIDs []int64
+	for rows.Next() {
+		var reportID int64
+		var report BuildReport
+		report.Key = key
+		report.Mode = mode
+		err = rows.Scan(&reportID, &report.Version, &report.Status, &report.CreatedAt, &report.BuilderNode, &report.Attempts, &report.TestSetRevision, &report.CheckerRevision,
+			&report.TestsPassed, &report.TestsTotal, &report.Exception, &report.BuildLog, &report.TestsLog)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan SQL result failed")
+		}
+		reports = append(reports, report)
+		reportIDs = append(reportIDs, reportID)
 	}
 
-	return &report, nil
-}
-
-// GetAssignmentID - returns assignment ID for given cross-service unique key
-func (r *BuilderRepository) GetAssignmentID(key string) (int64, error) {
-	rows, err := r.query("SELECT id FROM assignment WHERE `key`=?", key)
-
-	if !rows.Next() {
-		stmt, err := r.prepare("INSERT INTO assignment (`key`) VALUES (?)")
+	for i, reportID := range reportIDs {
+		reports[i].TestResults, err = r.getTestResults(reportID)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		res, err := stmt.Exec(key)
+		reports[i].GroupResults, err = r.getGroupResults(reportID)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		id, err := res.LastInsertId()
+		reports[i].Diagnostics, err = r.getDiagnostics(reportID)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		return id, nil
 	}
+	return reports, nil
+}
 
+// GetAssignmentID - returns assignment ID for given cross-service unique key
+func (r *BuilderRepository) GetAssignmentID(key string) (int64, error) {
 	var id int64
-	err = rows.Scan(&id)
+	err := r.db.QueryRow("SELECT id FROM assignment WHERE `key`=?", key).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, errors.Wrap(err, "SQL SELECT query failed")
+	}
+
+	stmt, err := r.prepare("INSERT INTO assignment (`key`) VALUES (?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(key)
 	if err != nil {
 		return 0, err
 	}
+	return res.LastInsertId()
+}
 
+// FindAssignmentID - returns ID of the existing assignment or errAssignmentNotFound,
+// unlike GetAssignmentID it never creates assignment
+func (r *BuilderRepository) FindAssignmentID(key string) (int64, error) {
+	var id int64
+	err := r.db.QueryRow("SELECT id FROM assignment WHERE `key`=?", key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errAssignmentNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "SQL SELECT query failed")
+	}
 	return id, nil
 }
 
@@ -241,6 +1036,7 @@ func (r *BuilderRepository) GetBuildID(key string) (int64, error) {
 	if err != nil {
 		return 0, errors.Wrap(err, "SQL SELECT query failed")
 	}
+	defer rows.Close()
 	if !rows.Next() {
 		return 0, errors.New("build with key '" + key + "' not found")
 	}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPullPendingBuildClaimsBuild(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE build SET `status`='building'", fakeQueryResult{rowsAffected: 1})
+	database.expect("SELECT `assignment_id`, `key`", fakeQueryResult{
+		columns: []string{"assignment_id", "key", "language", "source", "source_hash", "attempts", "testset_revision", "mode"},
+		rows:    [][]driver.Value{{int64(7), "build-key", "c++", "int main() {}", "hash", int64(1), int64(3), "full"}},
+	})
+
+	build, err := NewBuilderRepository(db).PullPendingBuild("node-1", 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build == nil || build.Key != "build-key" || build.AssignmentID != 7 || build.TestSetRevision != 3 || build.Mode != ModeFull {
+		t.Fatalf("got build %+v", build)
+	}
+	claims := database.executed("UPDATE build SET `status`='building'")
+	if len(claims) != 1 || !strings.Contains(claims[0].query, "WHERE `status`='pending'") {
+		t.Fatalf("build is not claimed with conditional UPDATE: %+v", claims)
+	}
+	// Claimed build is selected by the token set in the same UPDATE, so concurrent builders never get the same build.
+	selects := database.executed("SELECT `assignment_id`, `key`")
+	if len(selects) != 1 || selects[0].args[0] != claims[0].args[0] || build.ClaimToken != claims[0].args[0] {
+		t.Errorf("claimed build is not selected by claim token")
+	}
+	if claims[0].args[1] != "node-1" || claims[0].args[2] != int64(2) || claims[0].args[3] != int64(60) {
+		t.Errorf("got claim arguments %v", claims[0].args)
+	}
+	database.checkRowsClosed(t)
+}
+
+func TestPullPendingBuildWithoutPendingBuilds(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE build SET `status`='building'", fakeQueryResult{rowsAffected: 0})
+
+	build, err := NewBuilderRepository(db).PullPendingBuild("node-1", 0, time.Minute)
+	if err != nil || build != nil {
+		t.Fatalf("got build %+v, error %v", build, err)
+	}
+	if len(database.executed("SELECT")) != 0 {
+		t.Error("build selected when nothing was claimed")
+	}
+}
+
+func TestRepositoryReadersCloseRows(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT `testset_revision`", fakeQueryResult{columns: []string{"testset_revision"}, rows: [][]driver.Value{{int64(4)}}})
+	database.expect("SELECT `time_limit_ms`", fakeQueryResult{
+		columns: []string{"time_limit_ms", "memory_limit_mb", "output_limit_kb", "stack_size_mb"},
+		rows:    [][]driver.Value{{int64(1000), int64(256), int64(64), int64(8)}},
+	})
+	database.expect("SELECT `name`, `points`", fakeQueryResult{
+		columns: []string{"name", "points", "scoring", "dependencies"},
+		rows:    [][]driver.Value{{"easy", int64(40), "all", ""}, {"hard", int64(60), "sum", "easy"}},
+	})
+	database.expect("SELECT id FROM build", fakeQueryResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(9)}}})
+	repo := NewBuilderRepository(db)
+
+	revision, err := repo.GetTestSetRevision(1)
+	if err != nil || revision != 4 {
+		t.Errorf("got revision %d, error %v", revision, err)
+	}
+	limits, err := repo.GetAssignmentLimits(1)
+	if err != nil || limits.TimeLimitMs != 1000 || limits.StackSizeMB != 8 {
+		t.Errorf("got limits %+v, error %v", limits, err)
+	}
+	groups, err := repo.GetTestGroups(1, 4)
+	if err != nil || len(groups) != 2 || groups[1].Dependencies[0] != "easy" {
+		t.Errorf("got groups %+v, error %v", groups, err)
+	}
+	buildID, err := repo.GetBuildID("build-key")
+	if err != nil || buildID != 9 {
+		t.Errorf("got build ID %d, error %v", buildID, err)
+	}
+	database.checkRowsClosed(t)
+}
+
+func TestRejudgeBuild(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE build SET `status`='pending'", fakeQueryResult{rowsAffected: 1})
+	rejudged, err := NewBuilderRepository(db).RejudgeBuild("finished", 0)
+	if err != nil || !rejudged {
+		t.Errorf("finished build: got %v, %v", rejudged, err)
+	}
+	if len(database.executed("SELECT")) != 0 {
+		t.Error("rejudged build is checked for existence")
+	}
+}
+
+func TestRejudgeBuildNotFinished(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE build SET `status`='pending'", fakeQueryResult{rowsAffected: 0})
+	database.expect("SELECT id FROM build", fakeQueryResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}})
+	rejudged, err := NewBuilderRepository(db).RejudgeBuild("building", 0)
+	if err != nil || rejudged {
+		t.Errorf("build which is not finished: got %v, %v", rejudged, err)
+	}
+}
+
+func TestRejudgeBuildNotFound(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE build SET `status`='pending'", fakeQueryResult{rowsAffected: 0})
+	database.expect("SELECT id FROM build", fakeQueryResult{columns: []string{"id"}})
+	_, err := NewBuilderRepository(db).RejudgeBuild("unknown", 0)
+	if err != errBuildNotFound {
+		t.Errorf("unknown build: got %v, want errBuildNotFound", err)
+	}
+}
+
+func TestSetAssignmentSettings(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE assignment SET", fakeQueryResult{rowsAffected: 1})
+	limits := AssignmentLimits{TimeLimitMs: 2000, MemoryLimitMB: 128, OutputLimitKB: 512, StackSizeMB: 32}
+	checker := AssignmentChecker{Kind: CheckerFloat, AbsEpsilon: 1e-6}
+	assignmentIO := AssignmentIO{Mode: IOFile, InputFile: "input.txt", OutputFile: "output.txt"}
+
+	err := NewBuilderRepository(db).SetAssignmentSettings(5, limits, checker, assignmentIO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := database.executed("UPDATE assignment SET")
+	if len(updates) != 3 {
+		t.Fatalf("got %d updates, want limits, checker and I/O updates", len(updates))
+	}
+	if !strings.Contains(updates[0].query, "`time_limit_ms`=?") || updates[0].args[0] != int64(2000) {
+		t.Errorf("got limits update %+v", updates[0])
+	}
+	if !strings.Contains(updates[2].query, "`io_mode`=?") || updates[2].args[0] != "file" {
+		t.Errorf("got I/O update %+v", updates[2])
+	}
+	for _, update := range updates {
+		if update.args[len(update.args)-1] != int64(5) {
+			t.Errorf("assignment ID is not passed to %q", update.query)
+		}
+	}
+}
+
+func TestSetAssignmentSettingsKeepsCheckerRevision(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("UPDATE assignment SET", fakeQueryResult{rowsAffected: 1})
+	checker := AssignmentChecker{Kind: CheckerCustom, Source: "int main() {}", Language: "c++"}
+
+	err := NewBuilderRepository(db).SetAssignmentSettings(5, newDefaultAssignmentLimits(), checker, newDefaultAssignmentIO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := database.executed("UPDATE assignment SET `checker_revision`=IF(")
+	if len(updates) != 1 {
+		t.Fatal("checker revision is not incremented conditionally")
+	}
+	// Previous checker is compared with the new one, which is then assigned.
+	want := []driver.Value{"custom", 0.0, 0.0, "int main() {}", "c++"}
+	args := updates[0].args
+	if len(args) != 2*len(want)+1 {
+		t.Fatalf("got checker update arguments %v", args)
+	}
+	for i, value := range want {
+		if args[i] != value || args[len(want)+i] != value {
+			t.Errorf("got checker update arguments %v", args)
+			break
+		}
+	}
+}
+
+func TestAddBuildReportAddsNextVersion(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT id FROM build", fakeQueryResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(9)}}})
+	database.expect("UPDATE build SET `status`=?", fakeQueryResult{rowsAffected: 1})
+	database.expect("SELECT `builder_node`, `attempts`", fakeQueryResult{
+		columns: []string{"builder_node", "attempts", "version"},
+		rows:    [][]driver.Value{{"node-1", int64(2), int64(3)}},
+	})
+	database.expect("INSERT INTO report", fakeQueryResult{rowsAffected: 1, lastInsertID: 15})
+	database.expect("INSERT INTO test_result", fakeQueryResult{rowsAffected: 1})
+
+	err := NewBuilderRepository(db).AddBuildReport(BuildReport{
+		Key:         "build-key",
+		ClaimToken:  "claim-token",
+		Status:      StatusSucceed,
+		TestResults: []TestResult{{Verdict: VerdictAccepted}, {Verdict: VerdictWrongAnswer}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := database.executed("UPDATE build SET `status`=?")
+	if len(claims) != 1 || claims[0].args[2] != "claim-token" {
+		t.Errorf("report is not saved for claimed build: %+v", claims)
+	}
+	reports := database.executed("INSERT INTO report")
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports", len(reports))
+	}
+	// Report keeps version, builder node and attempts of the build.
+	if args := reports[0].args; args[0] != int64(9) || args[1] != int64(3) || args[3] != "node-1" || args[4] != int64(2) {
+		t.Errorf("got report arguments %v", args)
+	}
+	results := database.executed("INSERT INTO test_result")
+	if len(results) != 2 || results[1].args[0] != int64(15) || results[1].args[1] != int64(1) || results[1].args[2] != "WA" {
+		t.Errorf("got test results %+v", results)
+	}
+}
+
+func TestAddBuildReportWithLostClaim(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT id FROM build", fakeQueryResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(9)}}})
+	database.expect("UPDATE build SET `status`=?", fakeQueryResult{rowsAffected: 0})
+
+	err := NewBuilderRepository(db).AddBuildReport(BuildReport{Key: "build-key", ClaimToken: "stale-token", Status: StatusSucceed})
+	if err != errBuildClaimLost {
+		t.Errorf("got %v, want errBuildClaimLost", err)
+	}
+	if len(database.executed("INSERT")) != 0 {
+		t.Error("report saved for build claimed by another worker")
+	}
+}
+
+func TestGetBuildReportsReturnsHistory(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT id, `mode` FROM build", fakeQueryResult{columns: []string{"id", "mode"}, rows: [][]driver.Value{{int64(9), "full"}}})
+	database.expect("SELECT `id`, `version`", fakeQueryResult{
+		columns: []string{"id", "version", "status", "created_at", "builder_node", "attempts", "testset_revision", "checker_revision",
+			"tests_passed", "tests_total", "exception", "build_log", "tests_log"},
+		rows: [][]driver.Value{
+			{int64(14), int64(1), "failed", int64(1000), "node-1", int64(1), int64(2), int64(0), int64(0), int64(1), "", "", ""},
+			{int64(15), int64(2), "succeed", int64(2000), "node-2", int64(1), int64(3), int64(0), int64(1), int64(1), "", "", ""},
+		},
+	})
+	database.expect("SELECT `verdict`", fakeQueryResult{
+		columns: []string{"verdict", "limit_exceeded", "wall_time_ms", "cpu_time_ms", "memory_kb", "exit_code", "signal", "stdout", "stderr", "message"},
+		rows:    [][]driver.Value{{"AC", "", int64(10), int64(5), int64(1024), int64(0), int64(0), "3\n", "", ""}},
+	})
+	database.expect("SELECT `name`, `points`, `score`", fakeQueryResult{columns: []string{"name"}})
+	database.expect("SELECT `file`", fakeQueryResult{columns: []string{"file"}})
+
+	reports, err := NewBuilderRepository(db).GetBuildReports("build-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].Version != 1 || reports[1].Version != 2 || reports[1].BuilderNode != "node-2" || reports[1].TestSetRevision != 3 {
+		t.Fatalf("got reports %+v", reports)
+	}
+	for _, report := range reports {
+		if report.Key != "build-key" || report.Mode != ModeFull || len(report.TestResults) != 1 {
+			t.Errorf("got report %+v", report)
+		}
+	}
+	// Results are selected for each report after report rows are closed.
+	if selects := database.executed("SELECT `verdict`"); len(selects) != 2 || selects[0].args[0] != int64(14) || selects[1].args[0] != int64(15) {
+		t.Errorf("got test result queries %+v", selects)
+	}
+	database.checkRowsClosed(t)
+}
+
+// expectTestSetRevision - sets current test set revision of the assignment, which is locked and incremented
+func expectTestSetRevision(database *fakeDatabase, revision int64) {
+	database.expect("SELECT `testset_revision` FROM assignment", fakeQueryResult{columns: []string{"testset_revision"}, rows: [][]driver.Value{{revision}}})
+	database.expect("UPDATE assignment SET `testset_revision`=?", fakeQueryResult{rowsAffected: 1})
+}
+
+func TestRegisterTestCaseCreatesRevision(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	expectTestSetRevision(database, 4)
+	database.expect("SELECT COALESCE(MAX(`test_index`)", fakeQueryResult{columns: []string{"index"}, rows: [][]driver.Value{{int64(2)}}})
+	database.expect("INSERT INTO testcase", fakeQueryResult{rowsAffected: 1})
+
+	revision, err := NewBuilderRepository(db).RegisterTestCase(RegisterTestCaseParams{AssignmentID: 7, Key: "test-key", Input: "1 2\n", Expected: "3\n"})
+	if err != nil || revision != 5 {
+		t.Fatalf("got revision %d, error %v", revision, err)
+	}
+	if !strings.HasSuffix(database.executed("SELECT `testset_revision` FROM assignment")[0].query, "FOR UPDATE") {
+		t.Error("assignment is not locked while test set revision changes")
+	}
+	inserts := database.executed("INSERT INTO testcase")
+	if len(inserts) != 1 || inserts[0].args[2] != int64(2) || inserts[0].args[10] != int64(5) {
+		t.Errorf("test case is not appended in new revision: %+v", inserts)
+	}
+}
+
+func TestUpdateTestCaseKeepsPreviousVersion(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT `assignment_id` FROM testcase", fakeQueryResult{columns: []string{"assignment_id"}, rows: [][]driver.Value{{int64(7)}}})
+	expectTestSetRevision(database, 4)
+	database.expect("SELECT `id`, `test_index` FROM testcase", fakeQueryResult{columns: []string{"id", "test_index"}, rows: [][]driver.Value{{int64(30), int64(1)}}})
+	database.expect("UPDATE testcase SET `revision_removed`=?", fakeQueryResult{rowsAffected: 1})
+	database.expect("INSERT INTO testcase", fakeQueryResult{rowsAffected: 1})
+
+	revision, err := NewBuilderRepository(db).UpdateTestCase(UpdateTestCaseParams{Key: "test-key", Input: "2 2\n", Expected: "4\n"})
+	if err != nil || revision != 5 {
+		t.Fatalf("got revision %d, error %v", revision, err)
+	}
+	// Previous version stays visible in revisions before 5, new version replaces it at the same index.
+	removes := database.executed("UPDATE testcase SET `revision_removed`=?")
+	if len(removes) != 1 || removes[0].args[0] != int64(5) || removes[0].args[1] != int64(30) {
+		t.Errorf("got removed versions %+v", removes)
+	}
+	inserts := database.executed("INSERT INTO testcase")
+	if len(inserts) != 1 || inserts[0].args[0] != int64(7) || inserts[0].args[2] != int64(1) || inserts[0].args[10] != int64(5) {
+		t.Errorf("got new versions %+v", inserts)
+	}
+}
+
+func TestDeleteRemovedTestCase(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT `assignment_id` FROM testcase", fakeQueryResult{columns: []string{"assignment_id"}})
+
+	_, err := NewBuilderRepository(db).DeleteTestCase("test-key")
+	if err != errTestCaseNotFound {
+		t.Errorf("got %v, want errTestCaseNotFound", err)
+	}
+	if len(database.executed("UPDATE")) != 0 {
+		t.Error("test set revision changed for deleted test case")
+	}
+}
+
+func TestGetTestCasesOfRevision(t *testing.T) {
+	database, db := newFakeDatabase(t)
+	database.expect("SELECT `key`, `test_index`", fakeQueryResult{
+		columns: []string{"key", "test_index", "input", "expected", "input_hash", "expected_hash", "group_name", "weight", "sample"},
+		rows:    [][]driver.Value{{"test-key", int64(0), "1 2\n", "3\n", "", "", "", int64(1), false}},
+	})
+
+	cases, err := NewBuilderRepository(db).GetTestCases(7, 3)
+	if err != nil || len(cases) != 1 || cases[0].Key != "test-key" {
+		t.Fatalf("got test cases %+v, error %v", cases, err)
+	}
+	selects := database.executed("SELECT `key`, `test_index`")
+	if args := selects[0].args; args[0] != int64(7) || args[1] != int64(3) || args[2] != int64(3) {
+		t.Errorf("test cases are not selected by revision: %v", args)
+	}
+	database.checkRowsClosed(t)
+}
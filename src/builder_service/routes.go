@@ -16,21 +16,76 @@ var g_routes = restapi.RouterConfig{
 			"/build/report/{uuid}",
 			getBuildReport,
 		},
+		restapi.Route{
+			"GET",
+			"/build/{uuid}/reports",
+			getBuildReports,
+		},
 		restapi.Route{
 			"GET",
 			"/build/status/{uuid}",
 			getBuildStatus,
 		},
+		restapi.Route{
+			"GET",
+			"/languages",
+			getLanguages,
+		},
 		restapi.Route{
 			"POST",
 			"/build/new",
 			createBuild,
 		},
+		restapi.Route{
+			"POST",
+			"/build/{uuid}/rejudge",
+			rejudgeBuild,
+		},
+		restapi.Route{
+			"POST",
+			"/assignment/new",
+			createAssignment,
+		},
+		restapi.Route{
+			"POST",
+			"/assignment/{uuid}/rejudge",
+			rejudgeAssignment,
+		},
 		restapi.Route{
 			"POST",
 			"/testcase/new",
 			createTestCase,
 		},
+		restapi.Route{
+			"POST",
+			"/testcase/{uuid}/update",
+			updateTestCase,
+		},
+		restapi.Route{
+			"POST",
+			"/testcase/{uuid}/delete",
+			deleteTestCase,
+		},
+		restapi.Route{
+			"GET",
+			"/assignment/{uuid}/testset",
+			getTestSet,
+		},
+		restapi.Route{
+			"POST",
+			"/assignment/{uuid}/groups",
+			setTestGroups,
+		},
+		restapi.Route{
+			"GET",
+			"/assignment/{uuid}/testset/{revision}",
+			getTestSet,
+		},
+		restapi.Route{
+			"POST",
+			"/assignment/{uuid}/testset/import",
+			importTestSet,
+		},
 	},
 	BuilderAPIPrefix,
 }
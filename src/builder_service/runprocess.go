@@ -1,12 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -14,184 +13,325 @@ import (
 // ProcessLimits - process limits
 type processLimits struct {
 	NumberOfFiles int // max number of open files
-	NumberOfProc  int // max number of processors
+	NumberOfProc  int // max number of processes and threads
 	NumberOfLocks int // max number of file locks
-	TimeInSeconds int // max CPU time, in seconds
+	TimeLimitMs   int // max CPU time, in milliseconds
 	AddessSpaceMB int // max address space size, in mebabytes
+	OutputLimitKB int // max size of the output, in kilobytes
+	StackSizeMB   int // max stack size, in megabytes
+	WallTimeRatio int // max wall clock time, in CPU time limits
 }
 
+const (
+	defaultTimeLimitMs   = 2000
+	defaultMemoryLimitMB = 256
+	defaultOutputLimitKB = 16 * 1024
+	defaultStackSizeMB   = 64
+	// solutionName - name of the solution directory and executable in the build directory
+	solutionName = "solution"
+)
+
+// TestCase - test case of the assignment, Index defines order of tests
+// Group - name of the test group, Weight - weight of the test inside "sum" scoring group
+// Sample - test is shown to students as an example and runs in "samples_only" mode
+// InputHash, ExpectedHash - hashes of large input and answer kept in blob store, they are loaded only when test runs
 type TestCase struct {
-	Input    string
-	Expected string
+	Key          string
+	Index        int
+	Input        string
+	Expected     string
+	InputHash    string
+	ExpectedHash string
+	Group        string
+	Weight       int
+	Sample       bool
 }
 
+// writableWorkdir - process can write files into workdir, otherwise sandbox mounts empty tmpfs over it
+// readonlyDirs - directories visible read-only in the sandbox, like directory with the solution executable
+// logLimit - if set, stdout and stderr are truncated to this size, otherwise process is stopped when it exceeds output limit
+// stdin, stdout - if set, replace input and captured output, used to connect solution with interactor
 type processRunOptions struct {
-	workdir  string
-	input    string
-	expected string
-	limits   *processLimits
+	workdir         string
+	input           string
+	expected        string
+	limits          *processLimits
+	writableWorkdir bool
+	readonlyDirs    []string
+	logLimit        int
+	stdin           *os.File
+	stdout          *os.File
 }
 
-// newProcessLimits - creates new ProcessLimits with default values
-func newProcessLimits() *processLimits {
+// newProcessLimits - creates new ProcessLimits with assignment limits and default values
+func newProcessLimits(assignment AssignmentLimits) *processLimits {
 	limits := new(processLimits)
 	limits.NumberOfFiles = 8
 	limits.NumberOfProc = 1
 	limits.NumberOfLocks = 8
-	limits.TimeInSeconds = 2
-	limits.AddessSpaceMB = 256
+	limits.TimeLimitMs = assignment.TimeLimitMs
+	limits.AddessSpaceMB = assignment.MemoryLimitMB
+	limits.OutputLimitKB = assignment.OutputLimitKB
+	limits.StackSizeMB = assignment.StackSizeMB
+	limits.WallTimeRatio = 3
 	return limits
 }
 
-// runLimitedProcess - calls command wrapped with prlimit to limit resources
-// TODO: make type runResult which holds two errors: internal and runtime
-func runLimitedProcess(options processRunOptions, cmd string, arg ...string) error {
-	argNofile := fmt.Sprintf("--nofile=%d", options.limits.NumberOfFiles)
-	argCPUTime := fmt.Sprintf("--cpu=%d", options.limits.TimeInSeconds)
-	argCPUCount := fmt.Sprintf("--nproc=%d", options.limits.NumberOfProc)
-	argFileLocks := fmt.Sprintf("--locks=%d", options.limits.NumberOfLocks)
-	argFile := fmt.Sprintf("--nofile=%d", options.limits.NumberOfFiles)
-	argMemory := fmt.Sprintf("--as=%d", options.limits.AddessSpaceMB*1024*1024)
-
-	prlimitArgs := []string{argNofile, argCPUTime, argCPUCount, argFileLocks, argFile, argMemory}
-	prlimitArgs = append(prlimitArgs, cmd)
-	prlimitArgs = append(prlimitArgs, arg...)
-
-	// process := exec.Command("prlimit", prlimitArgs...)
-	process := exec.Command(cmd)
-	var stdin, stdout, stderr bytes.Buffer
-	_, err := stdin.WriteString(options.input)
-	if err != nil {
-		return errors.Wrap(err, "cannot write into stdin pipe")
+// newDefaultAssignmentLimits - creates assignment limits used when author didn't set them
+func newDefaultAssignmentLimits() AssignmentLimits {
+	return AssignmentLimits{
+		TimeLimitMs:   defaultTimeLimitMs,
+		MemoryLimitMB: defaultMemoryLimitMB,
+		OutputLimitKB: defaultOutputLimitKB,
+		StackSizeMB:   defaultStackSizeMB,
 	}
+}
 
-	process.Dir = options.workdir
-	process.Stdin = &stdin
-	process.Stdout = &stdout
-	process.Stderr = &stderr
+// CPUTime - returns CPU time limit
+func (l *processLimits) CPUTime() time.Duration {
+	return time.Duration(l.TimeLimitMs) * time.Millisecond
+}
 
-	err = process.Run()
-	if err != nil {
-		reason := fmt.Sprintf("run failed: %s", err.Error())
-		errText := string(stderr.Bytes())
-		if len(errText) > 0 {
-			reason += "\n"
-			reason += errText
-		}
-		outText := string(stdout.Bytes())
-		if len(outText) > 0 {
-			reason += "\n"
-			reason += outText
-		}
-		return errors.New(reason)
-	}
+// CPUTimeSeconds - returns CPU time limit rounded up to seconds, as required by RLIMIT_CPU
+func (l *processLimits) CPUTimeSeconds() int {
+	return (l.TimeLimitMs + 999) / 1000
+}
 
-	output := string(stdout.Bytes())
+// WallTime - returns wall clock time limit, which stops processes sleeping or waiting for input
+func (l *processLimits) WallTime() time.Duration {
+	return l.CPUTime() * time.Duration(l.WallTimeRatio)
+}
 
-	// TODO: allow fuzzy comparison (ignore extra whitespace at end)
+// OutputLimit - returns max size of the output, in bytes
+func (l *processLimits) OutputLimit() int64 {
+	return int64(l.OutputLimitKB) * 1024
+}
 
-	if output != options.expected {
-		return errors.New(fmt.Sprintf(
-			"output does not match expected:\n--OUTPUT--\n%s\n--EXPECTED--\n%s",
-			output,
-			options.expected))
+// runLimitedProcess - runs command in the sandbox and checks its output
+// Returned error means internal failure, solution failures are reported with verdict.
+func runLimitedProcess(runner processRunner, checker Checker, options processRunOptions, cmd string, arg ...string) (TestResult, error) {
+	result, err := runner.Run(options, cmd, arg...)
+	if err != nil {
+		return TestResult{}, errors.Wrap(err, "cannot run solution")
+	}
+	if testResult, failed := newFailedTestResult(result, options.limits); failed {
+		return testResult, nil
 	}
+	return checkTestOutput(checker, options, result, result.Stdout)
+}
 
-	return nil
+// newFailedTestResult - returns test result if process failed or exceeded limits, failed is false if output should be checked
+func newFailedTestResult(result *processResult, limits *processLimits) (testResult TestResult, failed bool) {
+	verdict, limit := getProcessVerdict(result, limits)
+	if verdict == "" {
+		return TestResult{}, false
+	}
+	testResult = newTestResult(verdict, result)
+	testResult.LimitExceeded = limit
+	reason := result.Describe()
+	if result.Succeed() {
+		// Process finished itself, but exceeded limit which is checked after run.
+		reason = string(limit) + " limit exceeded"
+	}
+	testResult.Message = fmt.Sprintf("run failed: %s", reason)
+	if len(testResult.Stderr) > 0 {
+		testResult.Message += "\n"
+		testResult.Message += testResult.Stderr
+	}
+	if len(testResult.Stdout) > 0 {
+		testResult.Message += "\n"
+		testResult.Message += testResult.Stdout
+	}
+	return testResult, true
 }
 
-// compileSolution - compiles given source code file
-func compileSolution(filepath string, language language, outputPath string) error {
-	var cmd *exec.Cmd
-	if language == languagePascal {
-		// GNU Pascal is outdated - we don't use it anymore.
-		// cmd = exec.Command("gpc", filepath, outputPath, "-w", "--extended-syntax", "--implicit-result")
-		cmd = exec.Command("fpc", "-Mtp", "-So", "-o"+outputPath, filepath)
-	} else if language == languageCpp {
-		cmd = exec.Command("gcc", filepath, "-o", outputPath, "--std=c++17")
-	} else {
-		return errors.New("unknown language value passed")
+// checkTestOutput - compares solution output with expected answer using checker
+func checkTestOutput(checker Checker, options processRunOptions, result *processResult, output []byte) (TestResult, error) {
+	verdict, message, err := checker.Check(options.input, string(output), options.expected)
+	if err != nil {
+		return TestResult{}, err
+	}
+	testResult := newTestResult(verdict, result)
+	if !testResult.Accepted() {
+		testResult.Message = fmt.Sprintf(
+			"%s:\n--OUTPUT--\n%s\n--EXPECTED--\n%s",
+			message,
+			truncateOutput(output, maxTestOutputLength),
+			truncateOutput([]byte(options.expected), maxTestOutputLength))
 	}
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	return testResult, nil
+}
+
+// compileSolution - compiles source file with language compile command in the sandbox,
+// compiler can write files only into build directory, its output is truncated to logLimit bytes
+func compileSolution(runner processRunner, config *LanguageConfig, files languageFiles, limits *processLimits, logLimit int) (compileResult, error) {
+	command := config.compileCommand(files)
+	if command == nil {
+		return compileResult{}, nil
+	}
+	options := processRunOptions{
+		workdir:         files.dir,
+		limits:          limits,
+		writableWorkdir: true,
+		logLimit:        logLimit,
+	}
+	result, err := runner.Run(options, command[0], command[1:]...)
 	if err != nil {
-		reason := fmt.Sprintf("compilation failed: %s", err.Error())
-		errText := string(stderr.Bytes())
-		if len(errText) > 0 {
-			reason += "\n"
-			reason += errText
-		}
-		outText := string(stdout.Bytes())
-		if len(outText) > 0 {
-			reason += "\n"
-			reason += outText
+		return compileResult{}, errors.Wrap(err, "cannot run compiler")
+	}
+	output := string(result.Stderr)
+	if len(result.Stdout) > 0 {
+		if len(output) > 0 {
+			output += "\n"
 		}
-		return errors.New(reason)
+		output += string(result.Stdout)
+	}
+	output = truncateOutput([]byte(output), logLimit)
+	if result.Succeed() {
+		return compileResult{log: output}, nil
 	}
-	return nil
-}
 
-func checkSolution(executablePath string, cases []TestCase, workdir string) []error {
-	executablePath, _ = filepath.Abs(executablePath)
+	reason := result.Describe()
+	_, limit := getProcessVerdict(result, limits)
+	timeout := limit == LimitCPU || limit == LimitWall
+	if timeout {
+		reason = "time limit exceeded"
+	} else if limit != "" {
+		reason = string(limit) + " limit exceeded"
+	}
+	reason = fmt.Sprintf("compilation failed: %s", reason)
+	if len(output) > 0 {
+		reason += "\n"
+		reason += output
+	}
+	return compileResult{
+		log:     output,
+		failure: errors.New(reason),
+		timeout: timeout,
+	}, nil
+}
 
-	var errors []error
+// checkSolution - runs solution on test cases, if stopOnFailure is set, remaining tests are skipped after first failed test.
+// Solution talks with interactor if it is not nil, otherwise its output is compared by checker.
+// Input and output files are used instead of stdin and stdout in "file" I/O mode.
+// Solution sees only programDir with its executable and its own workdir, not checker or interactor files.
+// Test data is loaded right before the test, so only one test is kept in memory.
+func checkSolution(runner processRunner, checker Checker, interactor *interactor, assignmentIO AssignmentIO, command []string, programDir string, cases []TestCase, data *dataStore, limits *processLimits, stopOnFailure bool, workdir string) ([]TestResult, error) {
+	var results []TestResult
 	for _, c := range cases {
-		limits := newProcessLimits()
+		input, err := data.load(c.Input, c.InputHash)
+		if err != nil {
+			return nil, err
+		}
+		expected, err := data.load(c.Expected, c.ExpectedHash)
+		if err != nil {
+			return nil, err
+		}
 		options := processRunOptions{
-			limits:   limits,
-			workdir:  workdir,
-			input:    c.Input,
-			expected: c.Expected,
+			limits:       limits,
+			workdir:      workdir,
+			readonlyDirs: []string{programDir},
+			input:        input,
+			expected:     expected,
+		}
+		var result TestResult
+		if interactor != nil {
+			result, err = runInteractiveProcess(runner, interactor, options, command[0], command[1:]...)
+		} else if assignmentIO.Mode == IOFile {
+			result, err = runFileProcess(runner, checker, assignmentIO, options, command[0], command[1:]...)
+		} else {
+			result, err = runLimitedProcess(runner, checker, options, command[0], command[1:]...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		if stopOnFailure && !result.Accepted() {
+			break
 		}
-		err := runLimitedProcess(options, executablePath)
-		errors = append(errors, err)
 	}
-	return errors
+	return results, nil
 }
 
+// BuildResult - result of the solution build
+// compileLog, diagnostics - compiler output and messages parsed from it, both for failed and succeed compilation
+// compileTimeout - build failed because compiler exceeded time limit
 type BuildResult struct {
 	internalError  error
 	buildError     error
-	testCaseErrors []error
+	compileTimeout bool
+	compileLog     string
+	diagnostics    []Diagnostic
+	testResults    []TestResult
 }
 
-func getLanguageExt(language language) string {
-	switch language {
-	case languageCpp:
-		return ".cpp"
-	case languagePascal:
-		return ".pas"
+func buildSolution(runner processRunner, languages *languageRegistry, compiler *solutionCompiler, sourceCode string, language language, cases []TestCase, data *dataStore, limits *processLimits, checkerConfig AssignmentChecker, assignmentIO AssignmentIO, mode JudgingMode, workdir string) BuildResult {
+	config, ok := languages.get(language)
+	if !ok {
+		return BuildResult{
+			internalError: errors.New("language '" + string(language) + "' is not enabled on builder"),
+		}
 	}
-	return ".unknown"
-}
-
-func buildSolution(sourceCode string, language language, cases []TestCase, workdir string) BuildResult {
-	srcPath := filepath.Join(workdir, "solution"+getLanguageExt(language))
-	exePath := filepath.Join(workdir, "solution")
-	runWorkdir := filepath.Join(workdir, "run")
-	err := os.MkdirAll(runWorkdir, os.ModePerm)
+	// Solution is built in its own directory, which is visible for solution in the sandbox,
+	// while checker and interactor directories stay hidden.
+	files, err := newLanguageFiles(config, filepath.Join(workdir, solutionName), solutionName)
 	if err != nil {
 		return BuildResult{
 			internalError: err,
 		}
 	}
+	runWorkdir := filepath.Join(workdir, "run")
+	for _, dir := range []string{files.dir, runWorkdir} {
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return BuildResult{
+				internalError: err,
+			}
+		}
+	}
 
-	err = ioutil.WriteFile(srcPath, []byte(sourceCode), os.ModePerm)
+	err = ioutil.WriteFile(files.source, []byte(sourceCode), os.ModePerm)
 	if err != nil {
 		return BuildResult{
 			internalError: err,
 		}
 	}
-	err = compileSolution(srcPath, language, exePath)
+	compiled, err := compiler.compile(config, files)
 	if err != nil {
 		return BuildResult{
-			buildError: err,
+			internalError: err,
+		}
+	}
+	diagnostics := parseDiagnostics(compiled.log)
+	if compiled.failure != nil {
+		return BuildResult{
+			buildError:     compiled.failure,
+			compileTimeout: compiled.timeout,
+			compileLog:     compiled.log,
+			diagnostics:    diagnostics,
+		}
+	}
+	var checker Checker
+	var testInteractor *interactor
+	if checkerConfig.Kind == CheckerInteractor {
+		testInteractor, err = newInteractor(checkerConfig, languages, compiler, workdir)
+	} else {
+		checker, err = newChecker(checkerConfig, runner, languages, compiler, workdir)
+	}
+	if err != nil {
+		return BuildResult{
+			internalError: err,
+		}
+	}
+	results, err := checkSolution(runner, checker, testInteractor, assignmentIO, config.runCommand(files), files.dir, cases, data, config.scaleLimits(limits), mode == ModeStopOnFirstFailure, runWorkdir)
+	if err != nil {
+		return BuildResult{
+			internalError: err,
 		}
 	}
-	errs := checkSolution(exePath, cases, workdir)
 	return BuildResult{
-		testCaseErrors: errs,
+		compileLog:  compiled.log,
+		diagnostics: diagnostics,
+		testResults: results,
 	}
 }
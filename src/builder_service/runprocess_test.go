@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestLimits() *processLimits {
+	return newProcessLimits(AssignmentLimits{TimeLimitMs: 1000, MemoryLimitMB: 64, OutputLimitKB: 64, StackSizeMB: 8})
+}
+
+func TestCheckSolutionReportsVerdicts(t *testing.T) {
+	runner := newFakeRunner(
+		&processResult{Stdout: []byte("3\n"), CPUTime: 10 * time.Millisecond},
+		&processResult{Stdout: []byte("5\n")},
+		&processResult{Signal: signalCPULimit, CPUTime: 1100 * time.Millisecond},
+		&processResult{Signal: syscall.SIGKILL, OOMKilled: true},
+	)
+	cases := []TestCase{
+		{Input: "1 2\n", Expected: "3\n"},
+		{Input: "2 2\n", Expected: "4\n"},
+		{Input: "3 3\n", Expected: "6\n"},
+		{Input: "4 4\n", Expected: "8\n"},
+	}
+	results, err := checkSolution(runner, new(exactChecker), nil, AssignmentIO{}, []string{"/build/solution/solution"}, "/build/solution",
+		cases, &dataStore{}, newTestLimits(), false, "/build/run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verdicts []Verdict
+	for _, result := range results {
+		verdicts = append(verdicts, result.Verdict)
+	}
+	want := []Verdict{VerdictAccepted, VerdictWrongAnswer, VerdictTimeLimitExceeded, VerdictMemoryLimitExceeded}
+	if !reflect.DeepEqual(verdicts, want) {
+		t.Fatalf("got verdicts %v, want %v", verdicts, want)
+	}
+	if results[0].CPUTimeMs != 10 {
+		t.Errorf("got CPU time %d ms, want 10 ms", results[0].CPUTimeMs)
+	}
+	if results[2].LimitExceeded != LimitCPU || results[3].LimitExceeded != LimitMemory {
+		t.Errorf("got limits %q and %q", results[2].LimitExceeded, results[3].LimitExceeded)
+	}
+	if results[0].Message != "" || !strings.Contains(results[1].Message, "--OUTPUT--\n5\n") {
+		t.Errorf("got messages %q and %q", results[0].Message, results[1].Message)
+	}
+
+	for i, run := range runner.runs {
+		if run.cmd != "/build/solution/solution" || run.options.input != cases[i].Input {
+			t.Errorf("run %d: got command %q with input %q", i, run.cmd, run.options.input)
+		}
+		if run.options.workdir != "/build/run" || run.options.writableWorkdir {
+			t.Errorf("run %d: solution should run in read-only /build/run, got %q", i, run.options.workdir)
+		}
+		if !reflect.DeepEqual(run.options.readonlyDirs, []string{"/build/solution"}) {
+			t.Errorf("run %d: got read-only dirs %v", i, run.options.readonlyDirs)
+		}
+	}
+}
+
+func TestCheckSolutionStopsOnFailure(t *testing.T) {
+	runner := newFakeRunner(
+		&processResult{ExitCode: 1},
+		&processResult{Stdout: []byte("4\n")},
+	)
+	cases := []TestCase{
+		{Input: "1 2\n", Expected: "3\n"},
+		{Input: "2 2\n", Expected: "4\n"},
+	}
+	results, err := checkSolution(runner, new(exactChecker), nil, AssignmentIO{}, []string{"solution"}, "/build/solution",
+		cases, &dataStore{}, newTestLimits(), true, "/build/run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Verdict != VerdictRuntimeError {
+		t.Fatalf("got %d results, want single RE result", len(results))
+	}
+	if len(runner.runs) != 1 {
+		t.Errorf("solution started %d times after failure", len(runner.runs))
+	}
+}
+
+func TestCheckSolutionFailsOnRunnerError(t *testing.T) {
+	runner := newFakeRunner()
+	_, err := checkSolution(runner, new(exactChecker), nil, AssignmentIO{}, []string{"solution"}, "/build/solution",
+		[]TestCase{{Input: "1 2\n", Expected: "3\n"}}, &dataStore{}, newTestLimits(), false, "/build/run")
+	if err == nil {
+		t.Fatal("runner error is not reported as internal error")
+	}
+}
+
+func newTestLanguageRegistry(t *testing.T) *languageRegistry {
+	languages, err := newLanguageRegistry([]LanguageConfig{{
+		ID:             languageCpp,
+		SourceFile:     "solution.cpp",
+		CompileCommand: []string{"g++", placeholderSource, "-o", placeholderExecutable},
+		RunCommand:     []string{placeholderExecutable},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return languages
+}
+
+func TestBuildSolutionReportsCompileLog(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workdir)
+	compilerOutput := "solution.cpp:5:5: error: 'x' was not declared in this scope\n"
+	runner := newFakeRunner(&processResult{ExitCode: 1, Stderr: []byte(compilerOutput)})
+	compiler := newSolutionCompiler(runner, CompileLimitsConfig{}, nil)
+
+	result := buildSolution(runner, newTestLanguageRegistry(t), compiler, "int main() { x = 1; }", languageCpp,
+		[]TestCase{{Input: "1\n", Expected: "1\n"}}, &dataStore{}, newTestLimits(), AssignmentChecker{}, newDefaultAssignmentIO(), ModeFull, workdir)
+	if result.internalError != nil || result.buildError == nil {
+		t.Fatalf("got internal error %v, build error %v", result.internalError, result.buildError)
+	}
+	if result.compileLog != compilerOutput {
+		t.Errorf("got compile log %q, want %q", result.compileLog, compilerOutput)
+	}
+	if len(result.diagnostics) != 1 || result.diagnostics[0].Line != 5 {
+		t.Errorf("got diagnostics %+v", result.diagnostics)
+	}
+	if len(runner.runs) != 1 || runner.runs[0].cmd != "g++" {
+		t.Errorf("solution started after failed compilation: %+v", runner.runs)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	runnerNamespaces = "namespaces"
+	runnerPrlimit    = "prlimit"
+)
+
+// processRunner - runs solution process with given limits.
+// Returned error means internal failure, while solution failures are reported with processResult.
+type processRunner interface {
+	Run(options processRunOptions, cmd string, arg ...string) (*processResult, error)
+}
+
+// processResult - exit status, resources usage and output of the finished process
+type processResult struct {
+	ExitCode  int
+	Signal    syscall.Signal
+	Stdout    []byte
+	Stderr    []byte
+	WallTime  time.Duration
+	CPUTime   time.Duration
+	MemoryKB  int64
+	OOMKilled bool
+	// WallTimeExceeded - process was killed on wall clock deadline
+	WallTimeExceeded bool
+	// OutputLimitExceeded - process was killed because it wrote more than output limit to stdout or stderr
+	OutputLimitExceeded bool
+}
+
+// Succeed - returns true if process exited normally with zero code
+func (r *processResult) Succeed() bool {
+	return r.Signal == 0 && r.ExitCode == 0 && !r.OOMKilled && !r.WallTimeExceeded && !r.OutputLimitExceeded
+}
+
+// Describe - returns human-readable reason of the process failure
+func (r *processResult) Describe() string {
+	if r.OOMKilled {
+		return "memory limit exceeded"
+	}
+	if r.OutputLimitExceeded {
+		return "output limit exceeded"
+	}
+	if r.WallTimeExceeded {
+		return "time limit exceeded (wall)"
+	}
+	if r.Signal != 0 {
+		return fmt.Sprintf("killed by signal: %s", r.Signal.String())
+	}
+	return fmt.Sprintf("exit status %d", r.ExitCode)
+}
+
+// newProcessRunner - creates process runner selected in sandbox configuration
+func newProcessRunner(config SandboxConfig) (processRunner, error) {
+	switch config.Runner {
+	case "", runnerNamespaces:
+		return newNamespaceRunner(config)
+	case runnerPrlimit:
+		return newPrlimitRunner()
+	}
+	return nil, errors.New("unknown sandbox runner '" + config.Runner + "'")
+}
+
+// setProcessStdio - connects process with input and output buffers, or with pipes given in options.
+// Output sent to the pipe passes through stdout buffer if output is limited,
+// so solution talking with interactor is stopped on output limit too.
+func setProcessStdio(process *exec.Cmd, options processRunOptions, stdout, stderr *limitedBuffer) {
+	process.Stdin = strings.NewReader(options.input)
+	if options.stdin != nil {
+		process.Stdin = options.stdin
+	}
+	process.Stdout = stdout
+	if options.stdout != nil {
+		process.Stdout = options.stdout
+		if stdout.onExceed != nil {
+			stdout.pipe = options.stdout
+			process.Stdout = stdout
+		}
+	}
+	process.Stderr = stderr
+}
+
+// limitedBuffer - keeps process output up to the limit, so process printing in infinite loop
+// cannot exhaust builder memory. Keeps one byte more than limit, so truncated output can be detected.
+// onExceed is called once when process writes more than limit, it should stop the process.
+// If pipe is set, output up to the limit is written to pipe instead of buffer.
+type limitedBuffer struct {
+	buffer     bytes.Buffer
+	limit      int64
+	written    int64
+	onExceed   func()
+	stopped    bool
+	pipe       io.Writer
+	pipeClosed bool
+}
+
+// newOutputBuffers - creates buffers for stdout and stderr of the process.
+// Process is killed with cancel when it exceeds output limit, unless output is just truncated to logLimit.
+func newOutputBuffers(options processRunOptions, cancel func()) (stdout *limitedBuffer, stderr *limitedBuffer) {
+	if options.logLimit != 0 {
+		limit := int64(options.logLimit)
+		return &limitedBuffer{limit: limit}, &limitedBuffer{limit: limit}
+	}
+	limit := options.limits.OutputLimit()
+	return &limitedBuffer{limit: limit, onExceed: cancel}, &limitedBuffer{limit: limit, onExceed: cancel}
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if b.pipe != nil {
+		return b.writePipe(data)
+	}
+	if remaining := b.limit + 1 - int64(b.buffer.Len()); remaining > 0 {
+		if int64(len(data)) > remaining {
+			b.buffer.Write(data[:remaining])
+		} else {
+			b.buffer.Write(data)
+		}
+	}
+	b.written += int64(len(data))
+	if b.Exceeded() && b.onExceed != nil && !b.stopped {
+		b.stopped = true
+		b.onExceed()
+	}
+	// Excess output is discarded, process is not stopped by write error.
+	return len(data), nil
+}
+
+// writePipe - passes output to pipe until process exceeds limit or reader closes pipe,
+// then output is discarded, but still counted
+func (b *limitedBuffer) writePipe(data []byte) (int, error) {
+	b.written += int64(len(data))
+	if b.Exceeded() {
+		if b.onExceed != nil && !b.stopped {
+			b.stopped = true
+			b.onExceed()
+		}
+		return len(data), nil
+	}
+	if !b.pipeClosed {
+		// Process gets no broken pipe error, it is stopped on output limit if it keeps writing.
+		_, err := b.pipe.Write(data)
+		b.pipeClosed = err != nil
+	}
+	return len(data), nil
+}
+
+// Bytes - returns kept output
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buffer.Bytes()
+}
+
+// Exceeded - returns true if process wrote more than limit
+func (b *limitedBuffer) Exceeded() bool {
+	return b.written > b.limit
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sandboxInitArg - first argument of the builder executable re-executed as sandbox init
+	sandboxInitArg = "sandbox-init"
+	// sandboxInitFailureCode - exit code used when sandbox init failed before running solution
+	sandboxInitFailureCode = 125
+	sandboxSpecFd          = 3
+	sandboxErrorFd         = 4
+	sandboxPidsFd          = 5
+	sandboxHostname        = "sandbox"
+	defaultTmpfsSizeMB     = 64
+	// sandboxRootOptions - options of the tmpfs which holds mount points of the sandbox root
+	sandboxRootOptions = "size=1m,mode=0755"
+	// rlimitLocks - RLIMIT_LOCKS, missed in syscall package
+	rlimitLocks = 10
+)
+
+// sandboxRlimit - resource limit applied by sandbox init before running solution
+type sandboxRlimit struct {
+	Resource int    `json:"resource"`
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+// sandboxTmpfs - tmpfs mounted by sandbox init
+type sandboxTmpfs struct {
+	Target string `json:"target"`
+	SizeMB int    `json:"size_mb"`
+}
+
+// sandboxDevices - device files available in the sandbox
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom"}
+
+// defaultSandboxSystemDirs - host directories with programs and libraries visible in the sandbox
+var defaultSandboxSystemDirs = []string{"/bin", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/sbin", "/usr"}
+
+// sandboxSpec - describes sandbox environment, passed from builder to sandbox init process
+// SystemDirs - host directories visible read-only, other host files are not visible
+// HiddenDirs - builder directories which are covered with empty tmpfs if they are inside system directories
+// ReadonlyBinds - host directories visible read-only, like directory with the solution executable
+// Binds - host directories which stay writable in the sandbox
+// PidsLimit - cgroup pids.max applied right before exec, so threads of the sandbox init are not limited
+type sandboxSpec struct {
+	Root          string          `json:"root"`
+	Workdir       string          `json:"workdir"`
+	SystemDirs    []string        `json:"system_dirs"`
+	HiddenDirs    []string        `json:"hidden_dirs"`
+	ReadonlyBinds []string        `json:"readonly_binds"`
+	Tmpfs         []sandboxTmpfs  `json:"tmpfs"`
+	Binds         []string        `json:"binds"`
+	MountProc     bool            `json:"mount_proc"`
+	Rlimits       []sandboxRlimit `json:"rlimits"`
+	PidsLimit     int             `json:"pids_limit"`
+	Command       string          `json:"command"`
+	Args          []string        `json:"args"`
+	Env           []string        `json:"env"`
+}
+
+// namespaceRunner - runs process in the new user, pid, network, mount, ipc and uts namespaces,
+// with root built from read-only system directories, tmpfs work directory, cgroup v2 limits and seccomp filter.
+type namespaceRunner struct {
+	config  SandboxConfig
+	cgroups *cgroupManager
+}
+
+func newNamespaceRunner(config SandboxConfig) (processRunner, error) {
+	cgroups, err := newCgroupManager(config.CgroupRoot)
+	if err != nil {
+		return nil, err
+	}
+	if config.TmpfsSizeMB == 0 {
+		config.TmpfsSizeMB = defaultTmpfsSizeMB
+	}
+	if len(config.SystemDirs) == 0 {
+		config.SystemDirs = defaultSandboxSystemDirs
+	}
+
+	runner := new(namespaceRunner)
+	runner.config = config
+	runner.cgroups = cgroups
+	return runner, nil
+}
+
+func (r *namespaceRunner) Run(options processRunOptions, cmd string, arg ...string) (*processResult, error) {
+	workdir, err := filepath.Abs(options.workdir)
+	if err != nil {
+		return nil, err
+	}
+	root, err := ioutil.TempDir("", "psjudge-root-")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create sandbox root")
+	}
+	defer os.Remove(root)
+	// Sandbox init has no PATH lookup, so programs like compilers are found before entering sandbox.
+	if !filepath.IsAbs(cmd) {
+		cmd, err = exec.LookPath(cmd)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot find program")
+		}
+	}
+
+	spec := sandboxSpec{
+		Root:       root,
+		Workdir:    workdir,
+		SystemDirs: r.config.SystemDirs,
+		HiddenDirs: r.config.HiddenDirs,
+		Tmpfs: []sandboxTmpfs{
+			{Target: "/tmp", SizeMB: r.config.TmpfsSizeMB},
+		},
+		MountProc: r.config.MountProc,
+		Rlimits:   newSandboxRlimits(options.limits),
+		PidsLimit: options.limits.NumberOfProc,
+		Command:   cmd,
+		Args:      arg,
+		Env:       []string{"PATH=/usr/local/bin:/usr/bin:/bin", "HOME=/tmp"},
+	}
+	for _, dir := range options.readonlyDirs {
+		dir, err = filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		spec.ReadonlyBinds = append(spec.ReadonlyBinds, dir)
+	}
+	if options.writableWorkdir {
+		spec.Binds = append(spec.Binds, workdir)
+	} else {
+		spec.Tmpfs = append(spec.Tmpfs, sandboxTmpfs{Target: workdir, SizeMB: r.config.TmpfsSizeMB})
+	}
+
+	group, err := r.cgroups.create(options.limits)
+	if err != nil {
+		return nil, err
+	}
+	defer group.destroy()
+	pidsLimit, err := group.openPidsLimit()
+	if err != nil {
+		return nil, err
+	}
+	defer pidsLimit.Close()
+
+	specReader, specWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer specWriter.Close()
+	errReader, errWriter, err := os.Pipe()
+	if err != nil {
+		specReader.Close()
+		return nil, err
+	}
+	defer errReader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.limits.WallTime())
+	defer cancel()
+
+	stdout, stderr := newOutputBuffers(options, cancel)
+	process := newLimitedCommand(ctx, "/proc/self/exe", sandboxInitArg)
+	setProcessStdio(process, options, stdout, stderr)
+	process.ExtraFiles = []*os.File{specReader, errWriter, pidsLimit}
+	process.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+		Setpgid:                    true,
+	}
+
+	start := time.Now()
+	err = process.Start()
+	specReader.Close()
+	errWriter.Close()
+	pidsLimit.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot start sandbox init")
+	}
+
+	// Sandbox init waits for the spec, so process cannot escape cgroup before it's added there.
+	err = group.addProcess(process.Process.Pid)
+	if err == nil {
+		err = json.NewEncoder(specWriter).Encode(&spec)
+	}
+	specWriter.Close()
+	if err != nil {
+		process.Process.Kill()
+		process.Wait()
+		return nil, errors.Wrap(err, "cannot setup sandbox")
+	}
+
+	// Error pipe closed on exec, so read returns as soon as solution started or init failed.
+	initError, _ := ioutil.ReadAll(errReader)
+	err = process.Wait()
+	if len(initError) != 0 {
+		return nil, errors.New("sandbox init failed: " + string(initError))
+	}
+
+	result, err := collectProcessResult(ctx, process, err, start, stdout, stderr)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := group.stats()
+	if err != nil {
+		return nil, err
+	}
+	result.CPUTime = stats.CPUTime
+	result.OOMKilled = stats.OOMKilled
+	if stats.MemoryKB != 0 {
+		result.MemoryKB = stats.MemoryKB
+	}
+	return result, nil
+}
+
+func newSandboxRlimits(limits *processLimits) []sandboxRlimit {
+	cpuTime := uint64(limits.CPUTimeSeconds())
+	stackSize := uint64(limits.StackSizeMB) * 1024 * 1024
+	fileSize := uint64(limits.OutputLimit())
+	return []sandboxRlimit{
+		// Solution gets SIGXCPU on soft limit and SIGKILL one second later.
+		{Resource: syscall.RLIMIT_CPU, Soft: cpuTime, Hard: cpuTime + 1},
+		{Resource: syscall.RLIMIT_NOFILE, Soft: uint64(limits.NumberOfFiles), Hard: uint64(limits.NumberOfFiles)},
+		{Resource: syscall.RLIMIT_CORE, Soft: 0, Hard: 0},
+		{Resource: syscall.RLIMIT_STACK, Soft: stackSize, Hard: stackSize},
+		{Resource: syscall.RLIMIT_FSIZE, Soft: fileSize, Hard: fileSize},
+		{Resource: rlimitLocks, Soft: uint64(limits.NumberOfLocks), Hard: uint64(limits.NumberOfLocks)},
+	}
+}
+
+// isSandboxInit - returns true if process was started by namespaceRunner as sandbox init
+func isSandboxInit() bool {
+	return len(os.Args) > 1 && os.Args[0] == "/proc/self/exe" && os.Args[1] == sandboxInitArg
+}
+
+// runSandboxInit - prepares sandbox and replaces current process with solution, never returns
+func runSandboxInit() {
+	// Capabilities, securebits and seccomp filter are per-thread attributes
+	runtime.LockOSThread()
+
+	syscall.CloseOnExec(sandboxErrorFd)
+	errPipe := os.NewFile(sandboxErrorFd, "error-pipe")
+	err := execSandboxInit()
+
+	// We are here only if something went wrong
+	errPipe.WriteString(err.Error())
+	os.Exit(sandboxInitFailureCode)
+}
+
+func execSandboxInit() error {
+	specPipe := os.NewFile(sandboxSpecFd, "spec-pipe")
+	var spec sandboxSpec
+	err := json.NewDecoder(specPipe).Decode(&spec)
+	specPipe.Close()
+	if err != nil {
+		return errors.Wrap(err, "cannot read sandbox spec")
+	}
+
+	err = setupSandboxMounts(&spec)
+	if err != nil {
+		return err
+	}
+	err = syscall.Sethostname([]byte(sandboxHostname))
+	if err != nil {
+		return errors.Wrap(err, "cannot set hostname")
+	}
+	err = dropCapabilities()
+	if err != nil {
+		return err
+	}
+	err = installSeccompFilter()
+	if err != nil {
+		return err
+	}
+	for _, limit := range spec.Rlimits {
+		err = syscall.Setrlimit(limit.Resource, &syscall.Rlimit{Cur: limit.Soft, Max: limit.Hard})
+		if err != nil {
+			return errors.Wrapf(err, "cannot set rlimit %d", limit.Resource)
+		}
+	}
+	// pids.max counts threads, so it's lowered only when Go runtime does not need new threads anymore.
+	// Limit lower than current number of threads is allowed, other threads are gone after exec.
+	pidsLimit := os.NewFile(sandboxPidsFd, "pids-limit")
+	_, err = pidsLimit.WriteString(strconv.Itoa(spec.PidsLimit))
+	pidsLimit.Close()
+	if err != nil {
+		return errors.Wrap(err, "cannot set pids limit")
+	}
+
+	argv := append([]string{spec.Command}, spec.Args...)
+	return errors.Wrap(syscall.Exec(spec.Command, argv, spec.Env), "cannot exec "+spec.Command)
+}
+
+// setupSandboxMounts - builds sandbox root on tmpfs from read-only system directories, device files
+// and directories of the process, then pivots into it. Other host files, like builder config,
+// work directories of other workers, blob store and compile cache are not visible in the sandbox.
+func setupSandboxMounts(spec *sandboxSpec) error {
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return errors.Wrap(err, "cannot make mounts private")
+	}
+	err = syscall.Mount("tmpfs", spec.Root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, sandboxRootOptions)
+	if err != nil {
+		return errors.Wrap(err, "cannot mount sandbox root")
+	}
+
+	for _, dir := range spec.SystemDirs {
+		err = bindSystemDir(spec.Root, dir)
+		if err != nil {
+			return err
+		}
+	}
+	err = bindDevices(spec.Root)
+	if err != nil {
+		return err
+	}
+	var hidden []string
+	for _, dir := range spec.HiddenDirs {
+		// Directory exists in the sandbox only if it's inside one of system directories.
+		target := filepath.Join(spec.Root, dir)
+		if _, err := os.Stat(target); err != nil || containsSystemDir(dir, spec.SystemDirs) {
+			continue
+		}
+		err = syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, sandboxRootOptions)
+		if err != nil {
+			return errors.Wrap(err, "cannot hide "+dir)
+		}
+		hidden = append(hidden, target)
+	}
+
+	for _, tmpfs := range spec.Tmpfs {
+		target := filepath.Join(spec.Root, tmpfs.Target)
+		// Target may be hidden by previous tmpfs, in that case it's writable.
+		err = os.MkdirAll(target, 0755)
+		if err != nil {
+			return errors.Wrap(err, "cannot create tmpfs mount point "+tmpfs.Target)
+		}
+		data := fmt.Sprintf("size=%dm,mode=1777", tmpfs.SizeMB)
+		err = syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, data)
+		if err != nil {
+			return errors.Wrap(err, "cannot mount tmpfs on "+tmpfs.Target)
+		}
+	}
+	// Binds are mounted after tmpfs, so directory inside "/tmp" is still visible.
+	for _, dir := range spec.ReadonlyBinds {
+		target := filepath.Join(spec.Root, dir)
+		err = bindDir(dir, target)
+		if err == nil {
+			err = remountReadOnly(target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, dir := range spec.Binds {
+		err = bindDir(dir, filepath.Join(spec.Root, dir))
+		if err != nil {
+			return err
+		}
+	}
+	if spec.MountProc {
+		target := filepath.Join(spec.Root, "proc")
+		err = os.MkdirAll(target, 0755)
+		if err != nil {
+			return errors.Wrap(err, "cannot create proc mount point")
+		}
+		err = syscall.Mount("proc", target, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+		if err != nil {
+			return errors.Wrap(err, "cannot mount proc")
+		}
+	}
+
+	// All mount points are created, so sandbox root and hidden directories become read-only.
+	for _, target := range append(hidden, spec.Root) {
+		err = syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, "")
+		if err != nil {
+			return errors.Wrap(err, "cannot remount read-only "+target)
+		}
+	}
+
+	// pivot_root(".", ".") stacks old root under the new one, so it can be detached without extra directory.
+	err = syscall.Chdir(spec.Root)
+	if err != nil {
+		return err
+	}
+	err = syscall.PivotRoot(".", ".")
+	if err != nil {
+		return errors.Wrap(err, "cannot pivot root")
+	}
+	err = syscall.Unmount(".", syscall.MNT_DETACH)
+	if err != nil {
+		return errors.Wrap(err, "cannot detach old root")
+	}
+	return syscall.Chdir(spec.Workdir)
+}
+
+// bindSystemDir - makes host system directory visible read-only, missed directories are skipped.
+// Symbolic links like "/lib64 -> usr/lib64" on merged /usr systems are copied as is.
+func bindSystemDir(root string, dir string) error {
+	info, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot stat "+dir)
+	}
+	target := filepath.Join(root, dir)
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(dir)
+		if err != nil {
+			return errors.Wrap(err, "cannot read link "+dir)
+		}
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err == nil {
+			err = os.Symlink(link, target)
+		}
+		return errors.Wrap(err, "cannot copy link "+dir)
+	}
+	err = bindDir(dir, target)
+	if err != nil {
+		return err
+	}
+	return remountReadOnly(target)
+}
+
+// containsSystemDir - returns true if dir is one of system directories or their parent,
+// such directory cannot be hidden without hiding programs and libraries
+func containsSystemDir(dir string, systemDirs []string) bool {
+	for _, systemDir := range systemDirs {
+		if systemDir == dir || strings.HasPrefix(systemDir, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// bindDevices - makes device files and standard links in "/dev"
+func bindDevices(root string) error {
+	devDir := filepath.Join(root, "dev")
+	err := os.MkdirAll(devDir, 0755)
+	if err != nil {
+		return errors.Wrap(err, "cannot create /dev")
+	}
+	for _, device := range sandboxDevices {
+		target := filepath.Join(root, device)
+		err = ioutil.WriteFile(target, nil, 0666)
+		if err != nil {
+			return errors.Wrap(err, "cannot create mount point "+device)
+		}
+		err = syscall.Mount(device, target, "", syscall.MS_BIND, "")
+		if err != nil {
+			return errors.Wrap(err, "cannot bind "+device)
+		}
+	}
+	// Links work only with mounted /proc, they are dangling otherwise.
+	links := []struct {
+		name   string
+		target string
+	}{
+		{"fd", "/proc/self/fd"},
+		{"stdin", "/proc/self/fd/0"},
+		{"stdout", "/proc/self/fd/1"},
+		{"stderr", "/proc/self/fd/2"},
+	}
+	for _, link := range links {
+		err = os.Symlink(link.target, filepath.Join(devDir, link.name))
+		if err != nil {
+			return errors.Wrap(err, "cannot create /dev/"+link.name)
+		}
+	}
+	return nil
+}
+
+// bindDir - recursively binds host directory to the target inside sandbox root
+func bindDir(dir string, target string) error {
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return errors.Wrap(err, "cannot create bind mount point "+dir)
+	}
+	err = syscall.Mount(dir, target, "", syscall.MS_BIND|syscall.MS_REC, "")
+	if err != nil {
+		return errors.Wrap(err, "cannot bind "+dir)
+	}
+	return nil
+}
+
+// remountReadOnly - remounts bind mount and all its submounts read-only
+func remountReadOnly(root string) error {
+	mountinfo, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	defer mountinfo.Close()
+
+	var targets []string
+	scanner := bufio.NewScanner(mountinfo)
+	for scanner.Scan() {
+		// See proc(5): mount point is the 5th field, spaces are escaped as octal codes.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		target := strings.Replace(fields[4], "\\040", " ", -1)
+		if target == root || strings.HasPrefix(target, root+"/") {
+			targets = append(targets, target)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		// Unprivileged user cannot clear locked mount flags, so keep them on remount.
+		var stat syscall.Statfs_t
+		err = syscall.Statfs(target, &stat)
+		if err != nil {
+			return errors.Wrap(err, "cannot stat "+target)
+		}
+		lockedFlags := uintptr(stat.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+			syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME)
+		err = syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|lockedFlags, "")
+		if err != nil {
+			return errors.Wrap(err, "cannot remount read-only "+target)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// errUnsupportedPlatform - builder runs solutions only on Linux, other platforms can only serve API
+var errUnsupportedPlatform = errors.New("sandbox runners are supported only on Linux")
+
+func newNamespaceRunner(config SandboxConfig) (processRunner, error) {
+	return nil, errUnsupportedPlatform
+}
+
+func newPrlimitRunner() (processRunner, error) {
+	return nil, errUnsupportedPlatform
+}
+
+func isSandboxInit() bool {
+	return false
+}
+
+func runSandboxInit() {
+	panic(errUnsupportedPlatform)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// prlimitRunner - runs process wrapped with prlimit, does not isolate it from the host.
+// Useful on developer machines where namespaces and cgroups are not available.
+type prlimitRunner struct {
+}
+
+func newPrlimitRunner() (processRunner, error) {
+	return new(prlimitRunner), nil
+}
+
+func (r *prlimitRunner) Run(options processRunOptions, cmd string, arg ...string) (*processResult, error) {
+	prlimitArgs := []string{
+		fmt.Sprintf("--nofile=%d", options.limits.NumberOfFiles),
+		// Solution gets SIGXCPU on soft limit and SIGKILL one second later, as in namespaces sandbox.
+		fmt.Sprintf("--cpu=%d:%d", options.limits.CPUTimeSeconds(), options.limits.CPUTimeSeconds()+1),
+		fmt.Sprintf("--nproc=%d", options.limits.NumberOfProc),
+		fmt.Sprintf("--locks=%d", options.limits.NumberOfLocks),
+		fmt.Sprintf("--as=%d", options.limits.AddessSpaceMB*1024*1024),
+		fmt.Sprintf("--stack=%d", options.limits.StackSizeMB*1024*1024),
+		fmt.Sprintf("--fsize=%d", options.limits.OutputLimit()),
+		"--core=0",
+	}
+	prlimitArgs = append(prlimitArgs, cmd)
+	prlimitArgs = append(prlimitArgs, arg...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.limits.WallTime())
+	defer cancel()
+	process := newLimitedCommand(ctx, "prlimit", prlimitArgs...)
+	stdout, stderr := newOutputBuffers(options, cancel)
+	process.Dir = options.workdir
+	setProcessStdio(process, options, stdout, stderr)
+
+	start := time.Now()
+	err := process.Run()
+	return collectProcessResult(ctx, process, err, start, stdout, stderr)
+}
+
+// newLimitedCommand - creates command in its own process group,
+// the whole group is killed when context deadline exceeded
+func newLimitedCommand(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	process := exec.CommandContext(ctx, name, arg...)
+	process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	process.Cancel = func() error {
+		return syscall.Kill(-process.Process.Pid, syscall.SIGKILL)
+	}
+	return process
+}
+
+// collectProcessResult - converts finished command state into processResult
+func collectProcessResult(ctx context.Context, process *exec.Cmd, err error, start time.Time, stdout, stderr *limitedBuffer) (*processResult, error) {
+	if err != nil && process.ProcessState == nil {
+		return nil, errors.Wrap(err, "cannot run process")
+	}
+
+	result := new(processResult)
+	result.WallTime = time.Since(start)
+	result.Stdout = stdout.Bytes()
+	result.Stderr = stderr.Bytes()
+	result.OutputLimitExceeded = stdout.stopped || stderr.stopped
+	result.CPUTime = process.ProcessState.UserTime() + process.ProcessState.SystemTime()
+	if status, ok := process.ProcessState.Sys().(syscall.WaitStatus); ok {
+		if status.Signaled() {
+			result.Signal = status.Signal()
+			result.WallTimeExceeded = result.Signal == syscall.SIGKILL && ctx.Err() == context.DeadlineExceeded
+		} else {
+			result.ExitCode = status.ExitStatus()
+		}
+	}
+	if usage, ok := process.ProcessState.SysUsage().(*syscall.Rusage); ok {
+		result.MemoryKB = int64(usage.Maxrss)
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isProcessAlive - returns true if process exists and is not a zombie waiting for its parent
+func isProcessAlive(pid int) bool {
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) != 0 && fields[0] != "Z"
+}
+
+func TestPrlimitRunnerKillsProcessTreeOnWallTimeout(t *testing.T) {
+	if _, err := exec.LookPath("prlimit"); err != nil {
+		t.Skip("prlimit not found")
+	}
+	runner, err := newPrlimitRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := newTestLimits()
+	limits.TimeLimitMs = 100
+	limits.NumberOfProc = 16
+	workdir := t.TempDir()
+
+	// Background child keeps stdout open, so runner returns in time only if it kills the whole process group.
+	start := time.Now()
+	result, err := runner.Run(processRunOptions{workdir: workdir, limits: limits}, "sh", "-c", "sleep 30 & echo $!; wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("runner waited %v for killed process", elapsed)
+	}
+	if verdict, limit := getProcessVerdict(result, limits); verdict != VerdictWallTimeLimitExceeded || limit != LimitWall {
+		t.Errorf("got %s %s (%s), want wall time limit exceeded", verdict, limit, result.Describe())
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(result.Stdout)))
+	if err != nil {
+		t.Fatalf("cannot read child pid from %q", result.Stdout)
+	}
+	for i := 0; i < 100 && isProcessAlive(pid); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if isProcessAlive(pid) {
+		t.Errorf("child process %d survived wall timeout", pid)
+	}
+}
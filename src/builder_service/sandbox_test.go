@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLimitedBufferKeepsOutputUpToLimit(t *testing.T) {
+	stopped := 0
+	buffer := &limitedBuffer{limit: 4, onExceed: func() { stopped++ }}
+	buffer.Write([]byte("abc"))
+	if buffer.Exceeded() || stopped != 0 {
+		t.Fatal("output within limit is reported as exceeded")
+	}
+	buffer.Write([]byte("def"))
+	buffer.Write([]byte("ghi"))
+	if !buffer.Exceeded() || stopped != 1 || !buffer.stopped {
+		t.Errorf("process stopped %d times after exceeding limit", stopped)
+	}
+	if got := string(buffer.Bytes()); got != "abcde" {
+		t.Errorf("got %q, want limit and one more byte", got)
+	}
+}
+
+func TestLimitedBufferTruncatesLog(t *testing.T) {
+	buffer := &limitedBuffer{limit: 2}
+	buffer.Write([]byte("abcdef"))
+	if !buffer.Exceeded() || buffer.stopped {
+		t.Error("log buffer should be truncated without stopping the process")
+	}
+}
+
+type failingWriter struct {
+	bytes.Buffer
+	fail bool
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	if w.fail {
+		return 0, errors.New("broken pipe")
+	}
+	return w.Buffer.Write(data)
+}
+
+func TestLimitedBufferCountsPipeOutput(t *testing.T) {
+	pipe := new(failingWriter)
+	stopped := 0
+	buffer := &limitedBuffer{limit: 6, onExceed: func() { stopped++ }, pipe: pipe}
+	buffer.Write([]byte("1 2\n"))
+	buffer.Write([]byte("3\n"))
+	if pipe.String() != "1 2\n3\n" || stopped != 0 || len(buffer.Bytes()) != 0 {
+		t.Fatalf("got %q in pipe and %q in buffer", pipe.String(), buffer.Bytes())
+	}
+	n, err := buffer.Write([]byte("4\n"))
+	if n != 2 || err != nil {
+		t.Errorf("write over limit failed: %d, %v", n, err)
+	}
+	if pipe.String() != "1 2\n3\n" || stopped != 1 {
+		t.Errorf("output over limit passed to pipe: %q, stopped %d times", pipe.String(), stopped)
+	}
+}
+
+func TestLimitedBufferDiscardsOutputAfterPipeClosed(t *testing.T) {
+	pipe := &failingWriter{fail: true}
+	buffer := &limitedBuffer{limit: 4, onExceed: func() {}, pipe: pipe}
+	for i := 0; i < 2; i++ {
+		n, err := buffer.Write([]byte("ab"))
+		if n != 2 || err != nil {
+			t.Fatalf("write to closed pipe failed: %d, %v", n, err)
+		}
+	}
+	if !buffer.pipeClosed || buffer.Exceeded() {
+		t.Error("closed pipe is not detected")
+	}
+	buffer.Write([]byte("c"))
+	if !buffer.stopped {
+		t.Error("process is not stopped on output limit after pipe closed")
+	}
+}
+
+func TestSetProcessStdioLimitsPipeOutput(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	options := processRunOptions{limits: newTestLimits(), stdin: reader, stdout: writer}
+	process := exec.Command("solution")
+	stdout, stderr := newOutputBuffers(options, func() {})
+	setProcessStdio(process, options, stdout, stderr)
+	if process.Stdin != reader || process.Stdout != stdout || stdout.pipe != writer {
+		t.Error("solution output to interactor is not limited")
+	}
+
+	options.logLimit = checkerMessageLimit
+	process = exec.Command("interactor")
+	stdout, stderr = newOutputBuffers(options, func() {})
+	setProcessStdio(process, options, stdout, stderr)
+	if process.Stdout != writer {
+		t.Error("interactor output to solution should not be limited")
+	}
+
+	options = processRunOptions{input: "1 2\n", limits: newTestLimits()}
+	process = exec.Command("solution")
+	stdout, stderr = newOutputBuffers(options, func() {})
+	setProcessStdio(process, options, stdout, stderr)
+	if _, ok := process.Stdin.(*strings.Reader); !ok || process.Stdout != stdout || process.Stderr != stderr {
+		t.Error("solution is not connected with input and output buffers")
+	}
+}
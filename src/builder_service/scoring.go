@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// GroupScoring - defines how test group earns its points
+type GroupScoring string
+
+const (
+	// ScoringAll - group earns all points only if all its tests passed, like IOI subtasks
+	ScoringAll GroupScoring = "all"
+	// ScoringSum - group earns points in proportion to the weight of passed tests
+	ScoringSum GroupScoring = "sum"
+)
+
+// TestGroup - group of the assignment tests which has its own points
+// Dependencies - names of the groups listed earlier, group earns nothing unless all of them passed
+type TestGroup struct {
+	Name         string
+	Points       int
+	Scoring      GroupScoring
+	Dependencies []string
+}
+
+// GroupResult - result of the test group in the build report
+// Passed - all tests of the group and its dependencies passed
+type GroupResult struct {
+	Name        string
+	Points      int
+	Score       float64
+	TestsPassed int
+	TestsTotal  int
+	Passed      bool
+}
+
+// validateTestGroups - checks group names, points and dependencies, sets default scoring
+func validateTestGroups(groups []TestGroup) error {
+	defined := make(map[string]bool)
+	for i := range groups {
+		group := &groups[i]
+		if len(group.Name) == 0 {
+			return errors.Errorf("test group #%d has no name", i)
+		}
+		if defined[group.Name] {
+			return errors.New("test group '" + group.Name + "' listed twice")
+		}
+		if group.Points < 0 {
+			return errors.New("test group '" + group.Name + "' has negative points")
+		}
+		switch group.Scoring {
+		case "":
+			group.Scoring = ScoringAll
+		case ScoringAll, ScoringSum:
+		default:
+			return errors.New("test group '" + group.Name + "' has unknown scoring '" + string(group.Scoring) + "'")
+		}
+		for _, dependency := range group.Dependencies {
+			// Dependencies on earlier groups only, so there are no cycles.
+			if !defined[dependency] {
+				return errors.New("test group '" + group.Name + "' depends on '" + dependency + "' which is not listed before it")
+			}
+		}
+		defined[group.Name] = true
+	}
+	return nil
+}
+
+// scoreTestGroups - calculates results of the test groups.
+// Tests from groups which are not listed form implicit groups with "sum" scoring
+// and points equal to the total weight of their tests, so without groups score depends on passed tests weight only.
+// Tests without result, i.e. skipped after the first failure, are not passed.
+// Group without tests is passed, so it does not block its dependents, but earns nothing.
+func scoreTestGroups(groups []TestGroup, cases []TestCase, results []TestResult) []GroupResult {
+	type groupState struct {
+		group        TestGroup
+		implicit     bool
+		result       GroupResult
+		weight       int
+		passedWeight int
+	}
+	var states []*groupState
+	byName := make(map[string]*groupState)
+	for _, group := range groups {
+		state := &groupState{group: group}
+		states = append(states, state)
+		byName[group.Name] = state
+	}
+
+	for i, testCase := range cases {
+		state, ok := byName[testCase.Group]
+		if !ok {
+			state = &groupState{group: TestGroup{Name: testCase.Group, Scoring: ScoringSum}, implicit: true}
+			states = append(states, state)
+			byName[testCase.Group] = state
+		}
+		if state.implicit {
+			state.group.Points += testCase.Weight
+		}
+		state.weight += testCase.Weight
+		state.result.TestsTotal++
+		if i < len(results) && results[i].Accepted() {
+			state.passedWeight += testCase.Weight
+			state.result.TestsPassed++
+		}
+	}
+
+	groupResults := make([]GroupResult, 0, len(states))
+	passed := make(map[string]bool)
+	for _, state := range states {
+		result := state.result
+		result.Name = state.group.Name
+		result.Points = state.group.Points
+		result.Passed = result.TestsPassed == result.TestsTotal
+		dependenciesPassed := true
+		for _, dependency := range state.group.Dependencies {
+			dependenciesPassed = dependenciesPassed && passed[dependency]
+		}
+		result.Passed = result.Passed && dependenciesPassed
+		if dependenciesPassed {
+			switch state.group.Scoring {
+			case ScoringAll:
+				if result.Passed && result.TestsTotal != 0 {
+					result.Score = float64(result.Points)
+				}
+			case ScoringSum:
+				if state.weight != 0 {
+					result.Score = float64(result.Points) * float64(state.passedWeight) / float64(state.weight)
+				}
+			}
+		}
+		passed[result.Name] = result.Passed
+		groupResults = append(groupResults, result)
+	}
+	return groupResults
+}
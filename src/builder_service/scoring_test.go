@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateTestGroups(t *testing.T) {
+	groups := []TestGroup{{Name: "samples"}, {Name: "main", Points: 10, Scoring: ScoringSum, Dependencies: []string{"samples"}}}
+	if err := validateTestGroups(groups); err != nil {
+		t.Fatal(err)
+	}
+	if groups[0].Scoring != ScoringAll {
+		t.Errorf("got default scoring %q, want %q", groups[0].Scoring, ScoringAll)
+	}
+
+	invalid := [][]TestGroup{
+		{{Name: ""}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Points: -1}},
+		{{Name: "a", Scoring: "max"}},
+		{{Name: "a", Dependencies: []string{"b"}}, {Name: "b"}},
+		{{Name: "a", Dependencies: []string{"a"}}},
+	}
+	for _, groups := range invalid {
+		if err := validateTestGroups(groups); err == nil {
+			t.Errorf("invalid groups %v accepted", groups)
+		}
+	}
+}
+
+func TestScoreTestGroups(t *testing.T) {
+	groups := []TestGroup{
+		{Name: "samples", Points: 0, Scoring: ScoringAll},
+		{Name: "small", Points: 30, Scoring: ScoringAll, Dependencies: []string{"samples"}},
+		{Name: "large", Points: 70, Scoring: ScoringSum, Dependencies: []string{"small"}},
+		{Name: "partial", Points: 10, Scoring: ScoringSum},
+	}
+	cases := []TestCase{
+		{Group: "samples", Weight: 1},
+		{Group: "small", Weight: 1},
+		{Group: "small", Weight: 1},
+		{Group: "large", Weight: 1},
+		{Group: "large", Weight: 3},
+		{Group: "partial", Weight: 1},
+		{Group: "partial", Weight: 1},
+		{Group: "", Weight: 2},
+		{Group: "", Weight: 2},
+	}
+	accepted := TestResult{Verdict: VerdictAccepted}
+	failed := TestResult{Verdict: VerdictWrongAnswer}
+	results := []TestResult{accepted, accepted, accepted, failed, accepted, accepted, failed, accepted}
+
+	want := []GroupResult{
+		{Name: "samples", Points: 0, Score: 0, TestsPassed: 1, TestsTotal: 1, Passed: true},
+		{Name: "small", Points: 30, Score: 30, TestsPassed: 2, TestsTotal: 2, Passed: true},
+		{Name: "large", Points: 70, Score: 52.5, TestsPassed: 1, TestsTotal: 2, Passed: false},
+		{Name: "partial", Points: 10, Score: 5, TestsPassed: 1, TestsTotal: 2, Passed: false},
+		// Last test has no result, i.e. it was skipped.
+		{Name: "", Points: 4, Score: 2, TestsPassed: 1, TestsTotal: 2, Passed: false},
+	}
+	got := scoreTestGroups(groups, cases, results)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestScoreTestGroupsDependencyFailed(t *testing.T) {
+	groups := []TestGroup{
+		{Name: "small", Points: 30, Scoring: ScoringAll},
+		{Name: "large", Points: 70, Scoring: ScoringSum, Dependencies: []string{"small"}},
+	}
+	cases := []TestCase{{Group: "small", Weight: 1}, {Group: "large", Weight: 1}}
+	results := []TestResult{{Verdict: VerdictWrongAnswer}, {Verdict: VerdictAccepted}}
+
+	got := scoreTestGroups(groups, cases, results)
+	if got[1].Score != 0 || got[1].Passed || got[1].TestsPassed != 1 {
+		t.Fatalf("group with failed dependency got %+v", got[1])
+	}
+}
+
+func TestScoreTestGroupsEmptyGroup(t *testing.T) {
+	groups := []TestGroup{
+		{Name: "samples", Points: 5, Scoring: ScoringAll},
+		{Name: "main", Points: 10, Scoring: ScoringAll, Dependencies: []string{"samples"}},
+	}
+	cases := []TestCase{{Group: "main", Weight: 1}}
+	results := []TestResult{{Verdict: VerdictAccepted}}
+
+	got := scoreTestGroups(groups, cases, results)
+	if !got[0].Passed || got[0].Score != 0 {
+		t.Errorf("empty group got %+v, want passed without score", got[0])
+	}
+	if !got[1].Passed || got[1].Score != 10 {
+		t.Errorf("group depending on empty group got %+v", got[1])
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// Constants from linux/seccomp.h, linux/prctl.h, linux/securebits.h and linux/capability.h
+const (
+	seccompModeFilter     = 2
+	seccompRetKill        = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+	seccompDataNrOffset   = 0
+	seccompDataArchOffset = 4
+
+	prSetNoNewPrivs = 38
+
+	secbitNoRoot              = 1 << 0
+	secbitNoRootLocked        = 1 << 1
+	secbitNoSetuidFixup       = 1 << 2
+	secbitNoSetuidFixupLocked = 1 << 3
+	secbitKeepCapsLocked      = 1 << 5
+
+	linuxCapabilityVersion3 = 0x20080522
+)
+
+// seccompDeniedSyscalls - syscalls which solution never needs, they fail with EPERM.
+// Architecture-specific syscalls listed in seccompArchDeniedSyscalls.
+var seccompDeniedSyscalls = []uint32{
+	syscall.SYS_PTRACE,
+	syscall.SYS_MOUNT,
+	syscall.SYS_UMOUNT2,
+	syscall.SYS_PIVOT_ROOT,
+	syscall.SYS_CHROOT,
+	syscall.SYS_REBOOT,
+	syscall.SYS_KEXEC_LOAD,
+	syscall.SYS_INIT_MODULE,
+	syscall.SYS_DELETE_MODULE,
+	syscall.SYS_SWAPON,
+	syscall.SYS_SWAPOFF,
+	syscall.SYS_UNSHARE,
+	syscall.SYS_KEYCTL,
+	syscall.SYS_ADD_KEY,
+	syscall.SYS_REQUEST_KEY,
+	syscall.SYS_PERF_EVENT_OPEN,
+	syscall.SYS_ACCT,
+	syscall.SYS_SETTIMEOFDAY,
+	syscall.SYS_CLOCK_SETTIME,
+	syscall.SYS_ADJTIMEX,
+	syscall.SYS_SETHOSTNAME,
+	syscall.SYS_SETDOMAINNAME,
+	syscall.SYS_QUOTACTL,
+	syscall.SYS_LOOKUP_DCOOKIE,
+	syscall.SYS_MBIND,
+	syscall.SYS_MIGRATE_PAGES,
+	syscall.SYS_MOVE_PAGES,
+}
+
+func bpfStatement(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt uint8, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// newSeccompProgram - creates BPF program which kills process on foreign architecture
+// and returns EPERM for denied syscalls
+func newSeccompProgram() []syscall.SockFilter {
+	program := []syscall.SockFilter{
+		bpfStatement(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataArchOffset),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, seccompAuditArch, 1, 0),
+		bpfStatement(syscall.BPF_RET|syscall.BPF_K, seccompRetKill),
+		bpfStatement(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataNrOffset),
+	}
+	if seccompSyscallNrLimit != 0 {
+		// Block alternative ABI like x32 which has the same audit arch
+		program = append(program,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, seccompSyscallNrLimit, 0, 1),
+			bpfStatement(syscall.BPF_RET|syscall.BPF_K, seccompRetKill))
+	}
+
+	denied := append(append([]uint32{}, seccompDeniedSyscalls...), seccompArchDeniedSyscalls...)
+	for _, nr := range denied {
+		program = append(program,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, 0, 1),
+			bpfStatement(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)))
+	}
+	return append(program, bpfStatement(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow))
+}
+
+// installSeccompFilter - installs filter for the current thread, it's inherited on exec
+func installSeccompFilter() error {
+	if seccompAuditArch == 0 {
+		return errors.New("seccomp filter is not supported on this architecture")
+	}
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "cannot set no_new_privs")
+	}
+
+	program := newSeccompProgram()
+	fprog := syscall.SockFprog{
+		Len:    uint16(len(program)),
+		Filter: &program[0],
+	}
+	_, _, errno = syscall.RawSyscall6(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, seccompModeFilter,
+		uintptr(unsafe.Pointer(&fprog)), 0, 0, 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "cannot install seccomp filter")
+	}
+	return nil
+}
+
+type capabilityHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capabilityData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// dropCapabilities - drops all capabilities of the current thread and forbids
+// to regain them on exec, even though process has uid 0 in its user namespace
+func dropCapabilities() error {
+	securebits := secbitNoRoot | secbitNoRootLocked | secbitNoSetuidFixup | secbitNoSetuidFixupLocked | secbitKeepCapsLocked
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, syscall.PR_SET_SECUREBITS, uintptr(securebits), 0, 0, 0, 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "cannot set securebits")
+	}
+
+	header := capabilityHeader{version: linuxCapabilityVersion3}
+	var data [2]capabilityData
+	_, _, errno = syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "cannot drop capabilities")
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+const (
+	// seccompAuditArch - AUDIT_ARCH_X86_64
+	seccompAuditArch = 0xc000003e
+	// seccompSyscallNrLimit - x32 syscalls have __X32_SYSCALL_BIT set
+	seccompSyscallNrLimit = 0x40000000
+)
+
+// seccompArchDeniedSyscalls - numbers of syscalls missed in syscall package for amd64
+var seccompArchDeniedSyscalls = []uint32{
+	172, // iopl
+	173, // ioperm
+	303, // name_to_handle_at
+	304, // open_by_handle_at
+	305, // clock_adjtime
+	308, // setns
+	310, // process_vm_readv
+	311, // process_vm_writev
+	313, // finit_module
+	321, // bpf
+	323, // userfaultfd
+}
@@ -0,0 +1,22 @@
+package main
+
+import "syscall"
+
+const (
+	// seccompAuditArch - AUDIT_ARCH_AARCH64
+	seccompAuditArch = 0xc00000b7
+	// seccompSyscallNrLimit - arm64 has no alternative syscall ABI
+	seccompSyscallNrLimit = 0
+)
+
+var seccompArchDeniedSyscalls = []uint32{
+	syscall.SYS_NAME_TO_HANDLE_AT,
+	syscall.SYS_OPEN_BY_HANDLE_AT,
+	syscall.SYS_CLOCK_ADJTIME,
+	syscall.SYS_SETNS,
+	syscall.SYS_PROCESS_VM_READV,
+	syscall.SYS_PROCESS_VM_WRITEV,
+	syscall.SYS_FINIT_MODULE,
+	syscall.SYS_BPF,
+	282, // userfaultfd
+}
@@ -0,0 +1,12 @@
+//go:build linux && !amd64 && !arm64
+// +build linux,!amd64,!arm64
+
+package main
+
+const (
+	// seccompAuditArch - zero means that sandbox cannot filter syscalls on this architecture
+	seccompAuditArch      = 0
+	seccompSyscallNrLimit = 0
+)
+
+var seccompArchDeniedSyscalls = []uint32{}
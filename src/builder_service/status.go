@@ -8,4 +8,6 @@ const (
 	StatusFailed    = "failed"
 	StatusSucceed   = "succeed"
 	StatusException = "exception"
+	// StatusCompilationTimeout - build failed because compiler exceeded time limit
+	StatusCompilationTimeout = "compilation_timeout"
 )
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxTestArchiveSize - max size of uploaded ZIP archive with tests
+	maxTestArchiveSize = 64 * 1024 * 1024
+	// maxTestArchiveUnpackedSize - max total size of files read from archive, protects from ZIP bombs
+	maxTestArchiveUnpackedSize = 512 * 1024 * 1024
+	// polygonDescriptor - name of the Polygon problem descriptor with limits, groups and checker
+	polygonDescriptor = "problem.xml"
+	// polygonTestSetName - name of the Polygon test set which is imported
+	polygonTestSetName = "tests"
+)
+
+// testArchive - assignment test set unpacked from ZIP archive.
+// Groups is nil if archive has no test groups.
+// TimeLimitMs, MemoryLimitMB - zero if archive does not define them.
+// Checker is nil if archive has no checker source.
+type testArchive struct {
+	Cases         []TestCase
+	Groups        []TestGroup
+	TimeLimitMs   int
+	MemoryLimitMB int
+	Checker       *AssignmentChecker
+}
+
+// archiveTest - pair of input and answer files found in archive
+// Number - test number parsed from file name, -1 if name is not a number
+type archiveTest struct {
+	name     string
+	number   int
+	input    *zip.File
+	expected *zip.File
+}
+
+// polygonProblem - part of the Polygon problem.xml used by import
+type polygonProblem struct {
+	TestSets []polygonTestSet `xml:"judging>testset"`
+	Checker  struct {
+		Source struct {
+			Path string `xml:"path,attr"`
+		} `xml:"source"`
+	} `xml:"assets>checker"`
+	Interactor struct {
+		Source struct {
+			Path string `xml:"path,attr"`
+		} `xml:"source"`
+	} `xml:"assets>interactor"`
+}
+
+type polygonTestSet struct {
+	Name        string         `xml:"name,attr"`
+	TimeLimitMs int            `xml:"time-limit"`
+	MemoryLimit int64          `xml:"memory-limit"`
+	Tests       []polygonTest  `xml:"tests>test"`
+	Groups      []polygonGroup `xml:"groups>group"`
+}
+
+type polygonTest struct {
+	Sample bool    `xml:"sample,attr"`
+	Group  string  `xml:"group,attr"`
+	Points float64 `xml:"points,attr"`
+}
+
+// polygonGroup - Polygon test group, "complete-group" points policy means "all" scoring, "each-test" - "sum" scoring
+type polygonGroup struct {
+	Name         string  `xml:"name,attr"`
+	Points       float64 `xml:"points,attr"`
+	PointsPolicy string  `xml:"points-policy,attr"`
+	Dependencies []struct {
+		Group string `xml:"group,attr"`
+	} `xml:"dependencies>dependency"`
+}
+
+// archiveReader - reads files from ZIP archive while total unpacked size is below the limit
+type archiveReader struct {
+	remaining int64
+}
+
+func (r *archiveReader) read(file *zip.File) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot open '"+file.Name+"' in archive")
+	}
+	defer src.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(src, r.remaining+1))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read '"+file.Name+"' from archive")
+	}
+	if int64(len(data)) > r.remaining {
+		return "", errors.Errorf("archive unpacked size exceeds %d bytes", maxTestArchiveUnpackedSize)
+	}
+	r.remaining -= int64(len(data))
+	return string(data), nil
+}
+
+// parseTestArchive - reads tests from ZIP archive with either Polygon layout ("tests/01" input and "tests/01.a" answer)
+// or "01.in" input and "01.out" answer files. Tests are ordered by number.
+// Optional Polygon "problem.xml" defines limits, samples, groups and checker or interactor,
+// otherwise checker is taken from "check.*" or "checker.*" source file in archive root.
+func parseTestArchive(data []byte, languages *languageRegistry) (*testArchive, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open ZIP archive")
+	}
+	reader := archiveReader{remaining: maxTestArchiveUnpackedSize}
+
+	files := make(map[string]*zip.File)
+	testsByName := make(map[string]*archiveTest)
+	var tests []*archiveTest
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		filePath := path.Clean(file.Name)
+		files[filePath] = file
+		name, isInput, ok := parseTestFileName(filePath)
+		if !ok {
+			continue
+		}
+		test := testsByName[name]
+		if test == nil {
+			test = &archiveTest{name: name, number: -1}
+			if number, err := strconv.Atoi(path.Base(name)); err == nil {
+				test.number = number
+			}
+			testsByName[name] = test
+			tests = append(tests, test)
+		}
+		if isInput {
+			test.input = file
+		} else {
+			test.expected = file
+		}
+	}
+	if len(tests) == 0 {
+		return nil, errors.New("archive has no tests")
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].number != tests[j].number {
+			return tests[i].number < tests[j].number
+		}
+		return tests[i].name < tests[j].name
+	})
+
+	var archive testArchive
+	for i, test := range tests {
+		if test.input == nil {
+			return nil, errors.New("test '" + test.name + "' has no input file")
+		}
+		if test.expected == nil {
+			return nil, errors.New("test '" + test.name + "' has no answer file")
+		}
+		testCase := TestCase{Index: i, Weight: 1}
+		testCase.Input, err = reader.read(test.input)
+		if err != nil {
+			return nil, err
+		}
+		testCase.Expected, err = reader.read(test.expected)
+		if err != nil {
+			return nil, err
+		}
+		archive.Cases = append(archive.Cases, testCase)
+	}
+
+	checkerPath := ""
+	checkerKind := CheckerCustom
+	if file, ok := files[polygonDescriptor]; ok {
+		descriptor, err := reader.read(file)
+		if err != nil {
+			return nil, err
+		}
+		checkerPath, checkerKind, err = applyPolygonDescriptor(&archive, tests, descriptor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(checkerPath) == 0 {
+		checkerPath = findArchiveChecker(files, languages)
+	}
+	if len(checkerPath) != 0 {
+		file, ok := files[path.Clean(checkerPath)]
+		if !ok {
+			return nil, errors.New("checker '" + checkerPath + "' not found in archive")
+		}
+		checkerLanguage, ok := getLanguageByFileName(languages, checkerPath)
+		if !ok {
+			return nil, errors.New("checker '" + checkerPath + "' is written in unknown language")
+		}
+		source, err := reader.read(file)
+		if err != nil {
+			return nil, err
+		}
+		archive.Checker = &AssignmentChecker{
+			Kind:     checkerKind,
+			Source:   source,
+			Language: checkerLanguage,
+		}
+	}
+	return &archive, nil
+}
+
+// parseTestFileName - returns test name and kind of the test file, ok is false for other files
+func parseTestFileName(filePath string) (name string, isInput bool, ok bool) {
+	ext := path.Ext(filePath)
+	inTestsDir := path.Base(path.Dir(filePath)) == polygonTestSetName
+	switch ext {
+	case ".in":
+		return strings.TrimSuffix(filePath, ext), true, true
+	case ".out", ".ans":
+		return strings.TrimSuffix(filePath, ext), false, true
+	case ".a":
+		if inTestsDir {
+			return strings.TrimSuffix(filePath, ext), false, true
+		}
+	case "":
+		if _, err := strconv.Atoi(path.Base(filePath)); err == nil && inTestsDir {
+			return filePath, true, true
+		}
+	}
+	return "", false, false
+}
+
+// applyPolygonDescriptor - reads limits, samples and groups from Polygon problem.xml,
+// returns path of the checker source if descriptor has it.
+// Interactive problem returns interactor source, which replaces checker.
+func applyPolygonDescriptor(archive *testArchive, tests []*archiveTest, descriptor string) (string, CheckerKind, error) {
+	var problem polygonProblem
+	err := xml.Unmarshal([]byte(descriptor), &problem)
+	if err != nil {
+		return "", "", errors.Wrap(err, "cannot parse "+polygonDescriptor)
+	}
+	for _, testSet := range problem.TestSets {
+		if testSet.Name != polygonTestSetName {
+			continue
+		}
+		archive.TimeLimitMs = testSet.TimeLimitMs
+		archive.MemoryLimitMB = int(testSet.MemoryLimit / (1024 * 1024))
+
+		// Polygon tests are numbered from 1 in the order of descriptor.
+		groupPoints := make(map[string]float64)
+		for i := range archive.Cases {
+			number := tests[i].number
+			if number < 1 || number > len(testSet.Tests) {
+				continue
+			}
+			test := testSet.Tests[number-1]
+			testCase := &archive.Cases[i]
+			testCase.Sample = test.Sample
+			testCase.Group = test.Group
+			if weight := int(math.Round(test.Points)); weight > 0 {
+				testCase.Weight = weight
+			}
+			groupPoints[test.Group] += test.Points
+		}
+
+		for _, group := range testSet.Groups {
+			testGroup := TestGroup{
+				Name:   group.Name,
+				Points: int(math.Round(group.Points)),
+			}
+			switch group.PointsPolicy {
+			case "each-test":
+				testGroup.Scoring = ScoringSum
+				if group.Points == 0 {
+					testGroup.Points = int(math.Round(groupPoints[group.Name]))
+				}
+			default:
+				testGroup.Scoring = ScoringAll
+			}
+			for _, dependency := range group.Dependencies {
+				testGroup.Dependencies = append(testGroup.Dependencies, dependency.Group)
+			}
+			archive.Groups = append(archive.Groups, testGroup)
+		}
+	}
+	if len(problem.Interactor.Source.Path) != 0 {
+		return problem.Interactor.Source.Path, CheckerInteractor, nil
+	}
+	return problem.Checker.Source.Path, CheckerCustom, nil
+}
+
+// findArchiveChecker - returns path of "check.*" or "checker.*" source in archive root, empty if there is no checker
+func findArchiveChecker(files map[string]*zip.File, languages *languageRegistry) string {
+	for _, config := range languages.languages {
+		ext := path.Ext(config.SourceFile)
+		if len(ext) == 0 {
+			continue
+		}
+		for _, name := range []string{"check" + ext, "checker" + ext} {
+			if _, ok := files[name]; ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// getLanguageByFileName - returns enabled language which source files have the same extension
+func getLanguageByFileName(languages *languageRegistry, name string) (language, bool) {
+	ext := path.Ext(name)
+	if len(ext) == 0 {
+		return "", false
+	}
+	for _, config := range languages.languages {
+		if path.Ext(config.SourceFile) == ext {
+			return config.ID, true
+		}
+	}
+	return "", false
+}
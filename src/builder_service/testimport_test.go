@@ -0,0 +1,177 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPolygonDescriptor = `<?xml version="1.0" encoding="utf-8"?>
+<problem>
+  <judging>
+    <testset name="pretests"><time-limit>500</time-limit></testset>
+    <testset name="tests">
+      <time-limit>2000</time-limit>
+      <memory-limit>268435456</memory-limit>
+      <tests>
+        <test sample="true" group="samples"/>
+        <test group="main" points="2"/>
+        <test group="main" points="3"/>
+      </tests>
+      <groups>
+        <group name="samples" points="0" points-policy="complete-group"/>
+        <group name="main" points-policy="each-test">
+          <dependencies><dependency group="samples"/></dependencies>
+        </group>
+      </groups>
+    </testset>
+  </judging>
+  <assets>
+    <checker><source path="files/check.cpp" type="cpp.g++17"/></checker>
+  </assets>
+</problem>`
+
+// newTestArchive - returns ZIP archive with given files
+func newTestArchive(t *testing.T, files map[string]string) []byte {
+	var data bytes.Buffer
+	writer := zip.NewWriter(&data)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte(content))
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data.Bytes()
+}
+
+func TestParsePolygonTestArchive(t *testing.T) {
+	data := newTestArchive(t, map[string]string{
+		"problem.xml":           testPolygonDescriptor,
+		"tests/01":              "1 1\n",
+		"tests/01.a":            "2\n",
+		"tests/10":              "10 10\n",
+		"tests/10.a":            "20\n",
+		"tests/2":               "2 2\n",
+		"tests/2.a":             "4\n",
+		"files/check.cpp":       "int main() {}\n",
+		"statements/readme.txt": "not a test\n",
+	})
+	archive, err := parseTestArchive(data, newTestLanguageRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, testCase := range archive.Cases {
+		expected = append(expected, testCase.Expected)
+	}
+	// Tests are ordered by number, not by file name.
+	if want := []string{"2\n", "4\n", "20\n"}; !reflect.DeepEqual(expected, want) {
+		t.Fatalf("got answers %q, want %q", expected, want)
+	}
+	if !archive.Cases[0].Sample || archive.Cases[1].Sample || archive.Cases[1].Group != "main" || archive.Cases[1].Weight != 2 {
+		t.Errorf("test properties from descriptor are not applied: %+v", archive.Cases)
+	}
+	if archive.Cases[2].Weight != 1 || archive.Cases[2].Group != "" {
+		t.Errorf("test missed in descriptor got %+v", archive.Cases[2])
+	}
+	if archive.TimeLimitMs != 2000 || archive.MemoryLimitMB != 256 {
+		t.Errorf("got limits %d ms, %d MB", archive.TimeLimitMs, archive.MemoryLimitMB)
+	}
+	// Points of "each-test" group are summed from its tests found in archive.
+	wantGroups := []TestGroup{
+		{Name: "samples", Points: 0, Scoring: ScoringAll},
+		{Name: "main", Points: 2, Scoring: ScoringSum, Dependencies: []string{"samples"}},
+	}
+	if !reflect.DeepEqual(archive.Groups, wantGroups) {
+		t.Errorf("got groups %+v, want %+v", archive.Groups, wantGroups)
+	}
+	wantChecker := &AssignmentChecker{Kind: CheckerCustom, Source: "int main() {}\n", Language: languageCpp}
+	if !reflect.DeepEqual(archive.Checker, wantChecker) {
+		t.Errorf("got checker %+v", archive.Checker)
+	}
+}
+
+func TestParseInOutTestArchive(t *testing.T) {
+	data := newTestArchive(t, map[string]string{
+		"2.in":        "2 2\n",
+		"2.out":       "4\n",
+		"1.in":        "1 1\n",
+		"1.ans":       "2\n",
+		"extra.in":    "3 3\n",
+		"extra.out":   "6\n",
+		"checker.cpp": "int main() {}\n",
+	})
+	archive, err := parseTestArchive(data, newTestLanguageRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tests without number go first, then numbered tests in number order.
+	if len(archive.Cases) != 3 || archive.Cases[0].Input != "3 3\n" || archive.Cases[1].Input != "1 1\n" {
+		t.Fatalf("got tests %+v", archive.Cases)
+	}
+	if archive.Groups != nil || archive.TimeLimitMs != 0 {
+		t.Error("archive without descriptor defines groups or limits")
+	}
+	if archive.Checker == nil || archive.Checker.Kind != CheckerCustom || archive.Checker.Language != languageCpp {
+		t.Errorf("got checker %+v", archive.Checker)
+	}
+}
+
+func TestParseInvalidTestArchive(t *testing.T) {
+	languages := newTestLanguageRegistry(t)
+	cases := map[string][]byte{
+		"not a ZIP":          []byte("tests"),
+		"no tests":           newTestArchive(t, map[string]string{"readme.txt": "no tests\n"}),
+		"no answer":          newTestArchive(t, map[string]string{"1.in": "1\n"}),
+		"no input":           newTestArchive(t, map[string]string{"1.out": "1\n"}),
+		"missed checker":     newTestArchive(t, map[string]string{"1.in": "1\n", "1.out": "1\n", "problem.xml": testPolygonDescriptor}),
+		"unknown language":   newTestArchive(t, map[string]string{"1.in": "1\n", "1.out": "1\n", "problem.xml": strings.Replace(testPolygonDescriptor, "check.cpp", "check.kt", 1), "files/check.kt": ""}),
+		"invalid descriptor": newTestArchive(t, map[string]string{"1.in": "1\n", "1.out": "1\n", "problem.xml": "<problem>"}),
+	}
+	for name, data := range cases {
+		if _, err := parseTestArchive(data, languages); err == nil {
+			t.Errorf("%s: archive accepted", name)
+		}
+	}
+}
+
+func TestParseInteractiveTestArchive(t *testing.T) {
+	descriptor := strings.Replace(testPolygonDescriptor, "<checker><source path=\"files/check.cpp\"", "<interactor><source path=\"files/interactor.cpp\"", 1)
+	descriptor = strings.Replace(descriptor, "</checker>", "</interactor>", 1)
+	data := newTestArchive(t, map[string]string{
+		"problem.xml":          descriptor,
+		"tests/1":              "1\n",
+		"tests/1.a":            "1\n",
+		"files/interactor.cpp": "int main() {}\n",
+	})
+	archive, err := parseTestArchive(data, newTestLanguageRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Checker == nil || archive.Checker.Kind != CheckerInteractor {
+		t.Errorf("got checker %+v, want interactor", archive.Checker)
+	}
+}
+
+func TestArchiveReaderLimitsUnpackedSize(t *testing.T) {
+	data := newTestArchive(t, map[string]string{"1.in": "12345"})
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := archiveReader{remaining: 4}
+	if _, err := reader.read(zipReader.File[0]); err == nil {
+		t.Error("file bigger than remaining size is read")
+	}
+	reader = archiveReader{remaining: 5}
+	if content, err := reader.read(zipReader.File[0]); err != nil || content != "12345" || reader.remaining != 0 {
+		t.Errorf("got %q, error %v, remaining %d", content, err, reader.remaining)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// Verdict - result code of the single test case run
+type Verdict string
+
+const (
+	VerdictAccepted          Verdict = "AC"
+	VerdictWrongAnswer       Verdict = "WA"
+	VerdictTimeLimitExceeded Verdict = "TLE"
+	// VerdictWallTimeLimitExceeded - process was idle (sleeping or waiting for input) until wall clock deadline
+	VerdictWallTimeLimitExceeded Verdict = "WTLE"
+	VerdictMemoryLimitExceeded   Verdict = "MLE"
+	VerdictRuntimeError          Verdict = "RE"
+	VerdictOutputLimitExceeded   Verdict = "OLE"
+	// VerdictNoOutputFile - solution did not create output file in "file" I/O mode
+	VerdictNoOutputFile Verdict = "NOF"
+)
+
+// LimitKind - kind of resource limit which stopped the process
+type LimitKind string
+
+const (
+	LimitCPU    LimitKind = "cpu"
+	LimitWall   LimitKind = "wall"
+	LimitMemory LimitKind = "memory"
+	LimitOutput LimitKind = "output"
+)
+
+const (
+	// maxTestOutputLength - max length of solution stdout/stderr kept in test result
+	maxTestOutputLength = 4096
+	truncatedMarker     = "\n...[truncated]"
+)
+
+// TestResult - structured result of the single test case run
+type TestResult struct {
+	Verdict    Verdict
+	WallTimeMs int64
+	CPUTimeMs  int64
+	MemoryKB   int64
+	ExitCode   int
+	Signal     int
+	Stdout     string
+	Stderr     string
+	Message    string
+	// LimitExceeded - limit which stopped the process, empty if process finished itself
+	LimitExceeded LimitKind
+}
+
+// newTestResult - creates test result with resources usage of the finished process
+func newTestResult(verdict Verdict, result *processResult) TestResult {
+	return TestResult{
+		Verdict:    verdict,
+		WallTimeMs: int64(result.WallTime / time.Millisecond),
+		CPUTimeMs:  int64(result.CPUTime / time.Millisecond),
+		MemoryKB:   result.MemoryKB,
+		ExitCode:   result.ExitCode,
+		Signal:     int(result.Signal),
+		Stdout:     truncateOutput(result.Stdout, maxTestOutputLength),
+		Stderr:     truncateOutput(result.Stderr, maxTestOutputLength),
+	}
+}
+
+// getProcessVerdict - returns verdict and exceeded limit for the process which failed or was stopped,
+// or empty verdict if process finished normally and its output should be checked
+func getProcessVerdict(result *processResult, limits *processLimits) (Verdict, LimitKind) {
+	cpuLimit := limits.CPUTime()
+	killed := result.Signal == syscall.SIGKILL || result.WallTimeExceeded
+	switch {
+	case result.OOMKilled:
+		return VerdictMemoryLimitExceeded, LimitMemory
+	case result.OutputLimitExceeded:
+		return VerdictOutputLimitExceeded, LimitOutput
+	case result.Signal == signalCPULimit:
+		return VerdictTimeLimitExceeded, LimitCPU
+	case killed && result.CPUTime >= cpuLimit:
+		return VerdictTimeLimitExceeded, LimitCPU
+	case result.WallTimeExceeded:
+		return VerdictWallTimeLimitExceeded, LimitWall
+	case result.Signal == signalFileSizeLimit || int64(len(result.Stdout)) > limits.OutputLimit():
+		return VerdictOutputLimitExceeded, LimitOutput
+	case result.CPUTime > cpuLimit:
+		// RLIMIT_CPU has seconds precision, so process can finish after the millisecond limit
+		return VerdictTimeLimitExceeded, LimitCPU
+	case !result.Succeed():
+		return VerdictRuntimeError, ""
+	}
+	return "", ""
+}
+
+// Accepted - returns true if test passed
+func (r *TestResult) Accepted() bool {
+	return r.Verdict == VerdictAccepted
+}
+
+func truncateOutput(output []byte, maxLength int) string {
+	if len(output) <= maxLength {
+		return string(output)
+	}
+	return string(output[:maxLength]) + truncatedMarker
+}
+
+// truncateToSize - truncates text, so it fits size bytes together with truncation marker
+func truncateToSize(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	if size < len(truncatedMarker) {
+		return ""
+	}
+	return truncateOutput([]byte(text), size-len(truncatedMarker))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGetProcessVerdict(t *testing.T) {
+	limits := newProcessLimits(AssignmentLimits{TimeLimitMs: 1000, MemoryLimitMB: 64, OutputLimitKB: 1, StackSizeMB: 8})
+	tests := []struct {
+		name    string
+		result  processResult
+		verdict Verdict
+		limit   LimitKind
+	}{
+		{"succeed", processResult{CPUTime: 500 * time.Millisecond}, "", ""},
+		{"nonzero exit code", processResult{ExitCode: 1}, VerdictRuntimeError, ""},
+		{"crash", processResult{Signal: syscall.SIGSEGV}, VerdictRuntimeError, ""},
+		{"out of memory", processResult{Signal: syscall.SIGKILL, OOMKilled: true}, VerdictMemoryLimitExceeded, LimitMemory},
+		{"output limit", processResult{Signal: syscall.SIGKILL, OutputLimitExceeded: true}, VerdictOutputLimitExceeded, LimitOutput},
+		{"cpu limit signal", processResult{Signal: signalCPULimit}, VerdictTimeLimitExceeded, LimitCPU},
+		{"killed after cpu limit", processResult{Signal: syscall.SIGKILL, CPUTime: 1000 * time.Millisecond}, VerdictTimeLimitExceeded, LimitCPU},
+		{"busy until wall deadline", processResult{Signal: syscall.SIGKILL, WallTimeExceeded: true, CPUTime: 1200 * time.Millisecond}, VerdictTimeLimitExceeded, LimitCPU},
+		{"idle until wall deadline", processResult{Signal: syscall.SIGKILL, WallTimeExceeded: true, CPUTime: 10 * time.Millisecond}, VerdictWallTimeLimitExceeded, LimitWall},
+		{"file size limit signal", processResult{Signal: signalFileSizeLimit}, VerdictOutputLimitExceeded, LimitOutput},
+		{"output over limit", processResult{Stdout: make([]byte, 1025)}, VerdictOutputLimitExceeded, LimitOutput},
+		{"output at limit", processResult{Stdout: make([]byte, 1024)}, "", ""},
+		{"finished after millisecond limit", processResult{CPUTime: 1001 * time.Millisecond}, VerdictTimeLimitExceeded, LimitCPU},
+	}
+	for _, test := range tests {
+		verdict, limit := getProcessVerdict(&test.result, limits)
+		if verdict != test.verdict || limit != test.limit {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", test.name, verdict, limit, test.verdict, test.limit)
+		}
+	}
+}
+
+func TestTruncateToSize(t *testing.T) {
+	if got := truncateToSize("short", 10); got != "short" {
+		t.Errorf("text which fits size changed: %q", got)
+	}
+	got := truncateToSize("0123456789abcdefghijklmnopqrstuvwxyz", 20)
+	if len(got) != 20 || got != "01234"+truncatedMarker {
+		t.Errorf("got %q, want 20 bytes ending with marker", got)
+	}
+	if got := truncateToSize("0123456789abcdefghijklmnopqrstuvwxyz", 3); got != "" {
+		t.Errorf("size less than marker: got %q", got)
+	}
+}
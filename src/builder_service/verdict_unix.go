@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"syscall"
+)
+
+// Signals sent by kernel to the process which exceeded RLIMIT_CPU and RLIMIT_FSIZE
+const (
+	signalCPULimit      = syscall.SIGXCPU
+	signalFileSizeLimit = syscall.SIGXFSZ
+)
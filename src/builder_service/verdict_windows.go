@@ -0,0 +1,11 @@
+package main
+
+import (
+	"syscall"
+)
+
+// Windows has no resource limit signals, these values never match signal of the process
+const (
+	signalCPULimit      syscall.Signal = -1
+	signalFileSizeLimit syscall.Signal = -2
+)
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"sync"
 	"time"
 
@@ -8,85 +12,115 @@ import (
 )
 
 const (
-	workerNum     = 1
-	sleepInterval = 5 * time.Second
+	defaultWorkerNum    = 1
+	defaultPollInterval = 30 * time.Second
+	defaultLease        = 60 * time.Second
+	defaultMaxAttempts  = 3
+	workerDirFormat     = "builder_%d"
 )
 
 type Task interface {
-	Run(workerID int) error
+	Run(workerID int, workdir string) error
 }
 
+// TaskGenerator - provides tasks for workers, should be safe for concurrent use
 type TaskGenerator interface {
-	Next() (bool, Task)
+	Next(workerID int) (bool, Task)
 }
 
-func TaskProvider(generator TaskGenerator, stopChan chan struct{}) <-chan Task {
-	tasksChan := make(chan Task)
-	go func() {
-		active := true
-		for active {
-			select {
-			case <-stopChan:
-				close(tasksChan)
-				active = false
-			default:
-				ok, task := generator.Next()
-				if ok {
-					tasksChan <- task
-				} else {
-					time.Sleep(sleepInterval)
-				}
-			}
-		}
-	}()
-	return tasksChan
+// workerPoolOptions - validated worker pool settings
+type workerPoolOptions struct {
+	workers      int
+	pollInterval time.Duration
+	cpus         []int
+	workdir      string
+	lease        time.Duration
+	maxAttempts  int
 }
 
-func RunTaskProvider(generator TaskGenerator, stopChan chan struct{}) <-chan Task {
-	resultChan := make(chan Task)
-	stopTaskProviderChan := make(chan struct{})
-	taskProviderChan := TaskProvider(generator, stopTaskProviderChan)
-	onStop := func() {
-		stopTaskProviderChan <- struct{}{}
-		close(resultChan)
+func newWorkerPoolOptions(config WorkersConfig) workerPoolOptions {
+	options := workerPoolOptions{
+		workers:      config.Count,
+		pollInterval: time.Duration(config.PollIntervalMs) * time.Millisecond,
+		cpus:         config.CPUs,
+		workdir:      config.WorkDir,
+		lease:        time.Duration(config.LeaseSeconds) * time.Second,
+		maxAttempts:  config.MaxAttempts,
+	}
+	if options.workers <= 0 {
+		options.workers = defaultWorkerNum
 	}
+	if options.pollInterval <= 0 {
+		options.pollInterval = defaultPollInterval
+	}
+	if options.lease <= 0 {
+		options.lease = defaultLease
+	}
+	if options.maxAttempts <= 0 {
+		options.maxAttempts = defaultMaxAttempts
+	}
+	return options
+}
 
-	go func() {
-		for {
+// Worker - pulls tasks from generator and runs them in its own work directory until stopped.
+// Worker pulls task only when it's free, so other builder nodes can take pending tasks meanwhile.
+// Idle worker waits for wakeup signal, polling interval is only a fallback when signal was lost.
+func Worker(generator TaskGenerator, options workerPoolOptions, workerID int, wakeup <-chan struct{}, stopChan <-chan struct{}) {
+	workdir := filepath.Join(options.workdir, fmt.Sprintf(workerDirFormat, workerID))
+	if workerID < len(options.cpus) {
+		// Processes started from this thread inherit its CPU affinity. Compiler and checker run
+		// on this thread, interactor runs on its own thread pinned to the same CPU, see runInteractiveProcess.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		err := setThreadCPUAffinity(options.cpus[workerID])
+		if err != nil {
+			logrus.WithField("error", err).WithField("worker", workerID).Warn("cannot pin worker to CPU")
+		}
+	}
+	for {
+		select {
+		case <-stopChan:
+			return
+		default:
+		}
+		ok, task := generator.Next(workerID)
+		if !ok {
 			select {
 			case <-stopChan:
-				onStop()
 				return
-			case task := <-taskProviderChan:
-				select {
-				case <-stopChan:
-					onStop()
-					return
-				case resultChan <- task:
-				}
+			case <-wakeup:
+			case <-time.After(options.pollInterval):
 			}
+			continue
+		}
+		err := prepareWorkDir(workdir)
+		if err == nil {
+			err = task.Run(workerID, workdir)
 		}
-	}()
-	return resultChan
-}
-
-func Worker(taskChan <-chan Task, workerID int) {
-	for task := range taskChan {
-		err := task.Run(workerID)
 		if err != nil {
 			logrus.WithField("error", err).Error("failed to execute task")
 		}
 	}
 }
 
-func RunWorkerPool(generator TaskGenerator, stopChan chan struct{}) *sync.WaitGroup {
+// prepareWorkDir - removes files left by the previous task
+func prepareWorkDir(workdir string) error {
+	err := os.RemoveAll(workdir)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(workdir, os.ModePerm)
+}
+
+// RunWorkerPool - runs workers which stop after stopChan closed and their current tasks finished
+// Each signal sent to wakeup channel wakes one idle worker.
+func RunWorkerPool(generator TaskGenerator, options workerPoolOptions, wakeup <-chan struct{}, stopChan <-chan struct{}) *sync.WaitGroup {
 	var wg sync.WaitGroup
-	tasksChan := RunTaskProvider(generator, stopChan)
-	for i := 0; i < workerNum; i++ {
+	wg.Add(options.workers)
+	for i := 0; i < options.workers; i++ {
 		go func(i int) {
-			wg.Add(1)
-			Worker(tasksChan, i)
-			wg.Done()
+			defer wg.Done()
+			Worker(generator, options, i, wakeup, stopChan)
 		}(i)
 	}
 	return &wg
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTask - records work directory of the worker which ran it
+type fakeTask struct {
+	generator *fakeTaskGenerator
+}
+
+func (t *fakeTask) Run(workerID int, workdir string) error {
+	t.generator.mutex.Lock()
+	defer t.generator.mutex.Unlock()
+	t.generator.workdirs = append(t.generator.workdirs, workdir)
+	t.generator.done <- struct{}{}
+	return nil
+}
+
+// fakeTaskGenerator - returns given number of tasks
+type fakeTaskGenerator struct {
+	mutex    sync.Mutex
+	tasks    int
+	workdirs []string
+	done     chan struct{}
+}
+
+func (g *fakeTaskGenerator) Next(workerID int) (bool, Task) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.tasks == 0 {
+		return false, nil
+	}
+	g.tasks--
+	return true, &fakeTask{g}
+}
+
+func (g *fakeTaskGenerator) add(tasks int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.tasks += tasks
+}
+
+func TestNewWorkerPoolOptionsDefaults(t *testing.T) {
+	options := newWorkerPoolOptions(WorkersConfig{})
+	if options.workers != defaultWorkerNum || options.pollInterval != defaultPollInterval ||
+		options.lease != defaultLease || options.maxAttempts != defaultMaxAttempts {
+		t.Errorf("got options %+v", options)
+	}
+	options = newWorkerPoolOptions(WorkersConfig{Count: 4, PollIntervalMs: 500, CPUs: []int{2, 3}})
+	if options.workers != 4 || options.pollInterval != 500*time.Millisecond || len(options.cpus) != 2 {
+		t.Errorf("got options %+v", options)
+	}
+}
+
+func TestWorkerPoolRunsTasks(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "workers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workdir)
+	generator := &fakeTaskGenerator{tasks: 3, done: make(chan struct{}, 10)}
+	options := newWorkerPoolOptions(WorkersConfig{Count: 2, PollIntervalMs: 60000, WorkDir: workdir})
+	wakeup := make(chan struct{})
+	stopChan := make(chan struct{})
+	wg := RunWorkerPool(generator, options, wakeup, stopChan)
+
+	waitTasks := func(count int) {
+		for i := 0; i < count; i++ {
+			select {
+			case <-generator.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("task is not run")
+			}
+		}
+	}
+	waitTasks(3)
+	// Idle workers wait for wakeup signal instead of long polling interval.
+	generator.add(1)
+	wakeup <- struct{}{}
+	waitTasks(1)
+
+	close(stopChan)
+	wg.Wait()
+	for _, dir := range generator.workdirs {
+		if dir != filepath.Join(workdir, "builder_0") && dir != filepath.Join(workdir, "builder_1") {
+			t.Errorf("task run in unexpected directory %q", dir)
+		}
+	}
+}
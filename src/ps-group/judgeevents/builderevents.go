@@ -2,86 +2,198 @@ package judgeevents
 
 import (
 	"encoding/json"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
 )
 
 const (
 	// ExchangeBuildFinished - exchange name for BuildFinished event
 	ExchangeBuildFinished = "psjudge-build-finished"
+	// ExchangeBuildRequested - exchange name for BuildRequested event
+	ExchangeBuildRequested = "psjudge-build-requested"
+
+	// consumerReconnectInterval - delay between attempts to restore dropped consumer connection
+	consumerReconnectInterval = 5 * time.Second
 )
 
 // BuildFinishedCallback - callback which receives BuildFinished event
 type BuildFinishedCallback func(event BuildFinishedEvent)
 
+// BuildRequestedCallback - callback which receives BuildRequested event
+type BuildRequestedCallback func(event BuildRequestedEvent)
+
 // BuildFinishedEvent - represents info attached to BuildFinished event
 type BuildFinishedEvent struct {
 	Key     string `json:"key"`
 	Succeed bool   `json:"succeed"`
 }
 
+// BuildRequestedEvent - represents info attached to BuildRequested event,
+// sent when new builds are waiting in the queue
+// Count - number of queued builds, 1 if not set
+type BuildRequestedEvent struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
 // BuilderEvents - allows to publish and subscribe to the Builder events.
+// Error returns error of the last publish or consume call, or nil if it succeed.
+// Consumers restore dropped connection in background until Close, even if the first consume call failed.
+// BuildFinished queue is shared by consumers, while each BuildRequested consumer has its own exclusive queue,
+// which is deleted when consumer disconnects.
 type BuilderEvents interface {
 	Error() error
 	PublishBuildFinished(event BuildFinishedEvent)
 	ConsumeBuildFinished(queue string, cb BuildFinishedCallback)
+	PublishBuildRequested(event BuildRequestedEvent)
+	ConsumeBuildRequested(queue string, cb BuildRequestedCallback)
 	Close()
 }
 
+// builderEventsImpl - publisher router is reconnected after failure, each consumed queue has its own router,
+// so failed consume doesn't stop publishing and failed publish doesn't stop consumers.
+// Consumer routers are owned by consumer goroutines, mutex guards publisher and lastError.
 type builderEventsImpl struct {
-	router  *EventRouter
-	closing chan struct{}
-	started bool
+	socket    string
+	publisher *EventRouter
+	lastError error
+	mutex     sync.Mutex
+	closing   chan struct{}
+	closeOnce sync.Once
+	consumers sync.WaitGroup
 }
 
 // NewBuilderEvents - creates new BuilderEvents router
 func NewBuilderEvents(socket string) BuilderEvents {
 	events := new(builderEventsImpl)
-	events.router = NewEventRouter(socket)
+	events.socket = socket
+	events.publisher = NewEventRouter(socket)
+	events.lastError = events.publisher.Error()
+	events.closing = make(chan struct{})
 	return events
 }
 
 func (impl *builderEventsImpl) Error() error {
-	return impl.router.Error()
+	impl.mutex.Lock()
+	defer impl.mutex.Unlock()
+	return impl.lastError
 }
 
 func (impl *builderEventsImpl) PublishBuildFinished(event BuildFinishedEvent) {
-	impl.router.DeclareExchange(ExchangeBuildFinished)
-	impl.router.PublishJSON(ExchangeBuildFinished, event)
+	impl.publish(ExchangeBuildFinished, event)
 }
 
 func (impl *builderEventsImpl) ConsumeBuildFinished(queue string, cb BuildFinishedCallback) {
-	impl.router.BindQueue(queue, ExchangeBuildFinished)
-
-	channel := impl.router.Consume(queue)
-	if channel != nil {
-		impl.closing = make(chan struct{})
-		impl.started = true
-
-		go func() {
-			active := true
-			for active {
-				var event BuildFinishedEvent
-				select {
-				case delivery := <-channel:
-					err := json.Unmarshal(delivery.Body, &event)
-					if err != nil {
-						logrus.WithField("error", err).Error("cannot decode router message")
-					}
-					cb(event)
-				case <-impl.closing:
-					impl.closing <- struct{}{}
-					active = false
-				}
+	impl.consume(queue, ExchangeBuildFinished, false, func(body []byte) {
+		var event BuildFinishedEvent
+		err := json.Unmarshal(body, &event)
+		if err != nil {
+			logrus.WithField("error", err).Error("cannot decode router message")
+		}
+		cb(event)
+	})
+}
+
+func (impl *builderEventsImpl) PublishBuildRequested(event BuildRequestedEvent) {
+	impl.publish(ExchangeBuildRequested, event)
+}
+
+func (impl *builderEventsImpl) ConsumeBuildRequested(queue string, cb BuildRequestedCallback) {
+	impl.consume(queue, ExchangeBuildRequested, true, func(body []byte) {
+		var event BuildRequestedEvent
+		err := json.Unmarshal(body, &event)
+		if err != nil {
+			logrus.WithField("error", err).Error("cannot decode router message")
+		}
+		cb(event)
+	})
+}
+
+// publish - publishes event, safe for concurrent use
+func (impl *builderEventsImpl) publish(exchange string, event interface{}) {
+	impl.mutex.Lock()
+	defer impl.mutex.Unlock()
+	if impl.publisher.Error() != nil {
+		// Router ignores calls after the first error, so connection is reopened for the next event.
+		impl.publisher.Close()
+		impl.publisher = NewEventRouter(impl.socket)
+	}
+	impl.publisher.DeclareExchange(exchange)
+	impl.publisher.PublishJSON(exchange, event)
+	impl.lastError = impl.publisher.Error()
+}
+
+// consume - runs goroutine which passes messages from queue bound to exchange to the handler until Close.
+// Error of the first connection is returned by Error, dropped connection is restored in background.
+func (impl *builderEventsImpl) consume(queue string, exchange string, exclusive bool, handler func(body []byte)) {
+	router, deliveries, err := connectConsumer(impl.socket, queue, exchange, exclusive)
+	impl.mutex.Lock()
+	impl.lastError = err
+	impl.mutex.Unlock()
+
+	impl.consumers.Add(1)
+	go func() {
+		defer impl.consumers.Done()
+		for {
+			if router != nil {
+				impl.receive(deliveries, handler)
+				router.Close()
+			}
+			select {
+			case <-impl.closing:
+				return
+			case <-time.After(consumerReconnectInterval):
+			}
+			router, deliveries, err = connectConsumer(impl.socket, queue, exchange, exclusive)
+			if err != nil {
+				logrus.WithField("queue", queue).WithField("error", err).Warn("cannot reconnect events consumer")
+			} else {
+				logrus.WithField("queue", queue).Info("events consumer reconnected")
+			}
+		}
+	}()
+}
+
+// receive - passes messages to the handler until connection dropped or Close called
+func (impl *builderEventsImpl) receive(deliveries <-chan amqp.Delivery, handler func(body []byte)) {
+	for {
+		select {
+		case delivery, ok := <-deliveries:
+			if !ok {
+				logrus.Warn("events consumer disconnected, reconnecting")
+				return
 			}
-		}()
+			handler(delivery.Body)
+			delivery.Ack(false)
+		case <-impl.closing:
+			return
+		}
 	}
 }
 
-func (impl *builderEventsImpl) Close() {
-	if impl.started {
-		impl.closing <- struct{}{}
-		<-impl.closing
-		impl.started = false
+// connectConsumer - creates router which consumes messages from queue bound to exchange
+func connectConsumer(socket string, queue string, exchange string, exclusive bool) (*EventRouter, <-chan amqp.Delivery, error) {
+	router := NewEventRouter(socket)
+	if exclusive {
+		router.BindExclusiveQueue(queue, exchange)
+	} else {
+		router.BindQueue(queue, exchange)
+	}
+	deliveries := router.Consume(queue)
+	err := router.Error()
+	if err != nil {
+		router.Close()
+		return nil, nil, err
 	}
+	return router, deliveries, nil
+}
+
+func (impl *builderEventsImpl) Close() {
+	impl.closeOnce.Do(func() {
+		close(impl.closing)
+	})
+	impl.consumers.Wait()
 }
@@ -36,9 +36,19 @@ func (router *EventRouter) DeclareExchange(name string) {
 
 // DeclareQueue - declares message receiver queue
 func (router *EventRouter) DeclareQueue(name string) *amqp.Queue {
+	return router.declareQueue(name, false)
+}
+
+// DeclareExclusiveQueue - declares message receiver queue which is used only by this router connection
+// and deleted by RabbitMQ when connection is closed
+func (router *EventRouter) DeclareExclusiveQueue(name string) *amqp.Queue {
+	return router.declareQueue(name, true)
+}
+
+func (router *EventRouter) declareQueue(name string, exclusive bool) *amqp.Queue {
 	if router.lastError == nil {
 		var queue amqp.Queue
-		queue, router.lastError = router.channel.QueueDeclare(name, false, false, false, false, nil)
+		queue, router.lastError = router.channel.QueueDeclare(name, false, exclusive, exclusive, false, nil)
 		if router.lastError == nil {
 			return &queue
 		}
@@ -48,11 +58,20 @@ func (router *EventRouter) DeclareQueue(name string) *amqp.Queue {
 
 // BindQueue - binds message receiver queue to given exchange event source.
 func (router *EventRouter) BindQueue(queue string, exchange string) {
+	router.bindQueue(queue, exchange, false)
+}
+
+// BindExclusiveQueue - binds exclusive message receiver queue to given exchange event source.
+func (router *EventRouter) BindExclusiveQueue(queue string, exchange string) {
+	router.bindQueue(queue, exchange, true)
+}
+
+func (router *EventRouter) bindQueue(queue string, exchange string, exclusive bool) {
 	if router.lastError == nil {
 		router.DeclareExchange(exchange)
 	}
 	if router.lastError == nil {
-		router.DeclareQueue(queue)
+		router.declareQueue(queue, exclusive)
 	}
 	if router.lastError == nil {
 		router.lastError = router.channel.QueueBind(queue, "", exchange, false, nil)
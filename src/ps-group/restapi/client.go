@@ -25,18 +25,23 @@ func NewClient(baseURL string) *Client {
 
 // Post - calls POST method of the API, writes results into `result` parameter
 func (c *Client) Post(method string, params interface{}, result interface{}) error {
-	url := c.baseURL + method
 	requestBytes, err := json.Marshal(params)
 	if err != nil {
 		return errors.Wrap(err, "cannot encode request for POST method "+method)
 	}
+	return c.PostBody(method, "application/json", requestBytes, result)
+}
 
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBytes))
+// PostBody - calls POST method of the API with raw body, like uploaded file,
+// writes results into `result` parameter
+func (c *Client) PostBody(method string, contentType string, body []byte, result interface{}) error {
+	url := c.baseURL + method
+	request, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return errors.Wrap(err, "cannot create request for POST method "+method+", url="+url)
 	}
 
-	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Content-Type", contentType)
 	response, err := c.httpClient.Do(request)
 	if err != nil {
 		return errors.Wrap(err, "cannot send request for POST method "+method)
@@ -2,16 +2,19 @@ package restapi
 
 import (
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
 // Request - provides access to request parameters and other information for the API handler
 type Request interface {
 	Var(name string) string
 	ReadJSON(result interface{}) error
+	ReadBody(maxSize int64) ([]byte, error)
 }
 
 // requestImpl - wrapper for http.Request which implements Request interface
@@ -40,3 +43,15 @@ func (req *requestImpl) ReadJSON(result interface{}) error {
 	}
 	return nil
 }
+
+// ReadBody - reads raw request body, like uploaded file, or returns error if body is larger than maxSize
+func (req *requestImpl) ReadBody(maxSize int64) ([]byte, error) {
+	bytes, err := ioutil.ReadAll(io.LimitReader(req.request.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bytes)) > maxSize {
+		return nil, errors.Errorf("request body is larger than %d bytes", maxSize)
+	}
+	return bytes, nil
+}
@@ -33,6 +33,11 @@ type Unauthorized struct {
 	Data interface{}
 }
 
+// NotFound - represents HttpNotFound response
+type NotFound struct {
+	Data interface{}
+}
+
 // InternalError - represents HttpInternalError response
 type InternalError struct {
 	Data interface{}
@@ -100,6 +105,10 @@ func (res *Unauthorized) write(w http.ResponseWriter) error {
 	return writeResponse(res.Data, http.StatusUnauthorized, w)
 }
 
+func (res *NotFound) write(w http.ResponseWriter) error {
+	return writeResponse(res.Data, http.StatusNotFound, w)
+}
+
 func (res *InternalError) write(w http.ResponseWriter) error {
 	return writeResponse(res.Data, http.StatusInternalServerError, w)
 }
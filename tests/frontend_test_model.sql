@@ -113,6 +113,7 @@ CREATE TABLE IF NOT EXISTS `psjudge_frontend_test`.`commit` (
   `uuid` VARCHAR(32) NULL,
   `build_status` ENUM('pending', 'failed', 'succeed') NULL DEFAULT 'pending',
   `build_score` INT NULL,
+  `mode` ENUM('full', 'stop_on_first_failure', 'samples_only') NOT NULL DEFAULT 'full',
   PRIMARY KEY (`id`),
   INDEX `fk_solution_id_idx` (`solution_id` ASC),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC),
@@ -8,6 +8,7 @@ from test_runner import TestScenario, run_test_scenarios
 
 SCRIPT_DIR = os.path.dirname(os.path.realpath(__file__))
 BACKEND_API_URL = 'http://localhost:9091/api/v1/'
+BUILDER_API_URL = 'http://localhost:9092/api/v1/'
 
 PASCAL_SOURCE = """PROGRAM APLUSB;
 VAR
@@ -74,15 +75,12 @@ class ViewAndCommitScenario(BackendTestScenario):
         assignment = self.get_aplusb_assignment(assignments)
         assignment_id = assignment['id']
         self.check_assignment_info(assignment)
+        self.check_languages()
 
         build_uuid = self.commit_aplusb_solution(user_id, assignment_id)
         
         solutions = self.get_user_solutions(user_id, contest_id)
         solution = self.get_solution_of_assignment(solutions, assignment_id)
-<<<<<<< HEAD
-=======
-
->>>>>>> PSJ-8
         self.check_commit_report(solutions[0]['commit_id'])
         
         assert solution['assignment_title'] == 'A+B Problem'
@@ -130,6 +128,11 @@ class ViewAndCommitScenario(BackendTestScenario):
         assert isinstance(response['uuid'], str)
         return response['uuid']
 
+    def check_languages(self):
+        response = self.get_json('languages')
+        assert isinstance(response, list)
+        assert 'pascal' in [language['id'] for language in response]
+
     def check_assignment_info(self, assignment):
         response = self.get_json('assignment/{0}'.format(str(assignment['id'])))
         assert assignment['id'] == response['id']
@@ -157,6 +160,7 @@ class ViewAndCommitScenario(BackendTestScenario):
         assert isinstance(response['tests_log'], str)
         assert isinstance(response['tests_passed'], int)
         assert isinstance(response['tests_total'], int)
+        assert isinstance(response['tests'], list)
 
 class CreateScenario(BackendTestScenario):
     def run(self):
@@ -169,7 +173,9 @@ class CreateScenario(BackendTestScenario):
         contest_id = self.create_contest('Olympic Games', timestamp, timestamp + 7200)
         user_id = self.create_user(username, password_hash, ['student'], contest_id)
         assignment_id = self.create_assignment(assignment_uuid, contest_id, 'A+B Problem', 'Solve A+B Problem')
-        self.create_test_case(testcase_uuid, assignment_id, '1\n2\n', '3\n')
+        self.create_test_case(testcase_uuid, assignment_id, '1\n2\n', '3\n', sample=True)
+        self.check_builder_test_set(assignment_uuid, testcase_uuid)
+        self.check_rejected_assignment(contest_id)
 
     def create_contest(self, title, start_time, end_time):
         params = {
@@ -199,27 +205,102 @@ class CreateScenario(BackendTestScenario):
             'uuid': uuid,
             'contest_id': contest_id,
             'title': title,
-            'description': description
+            'description': description,
+            'time_limit_ms': 1000,
+            'memory_limit_mb': 64,
+            'checker': 'trailing_whitespace',
         }
         response = self.post_json('assignment/create', params)
         id = response['id']
         assert isinstance(id, int)
         return id
 
-    def create_test_case(self, uuid, assignment_id, input, expected):
+    def create_test_case(self, uuid, assignment_id, input, expected, sample=False):
         params = {
             'uuid': uuid,
             'assignment_id': assignment_id,
             'input': input,
-            'expected': expected
+            'expected': expected,
+            'sample': sample,
         }
         self.post_json('testcase/create', params)
 
+    def check_builder_test_set(self, assignment_uuid, testcase_uuid):
+        builder = TestScenario(BUILDER_API_URL)
+        response = builder.get_json('assignment/{0}/testset'.format(assignment_uuid))
+        tests = [test for test in response['tests'] if test['uuid'] == testcase_uuid]
+        assert len(tests) == 1
+        assert tests[0]['sample'] is True
+
+    def check_rejected_assignment(self, contest_id):
+        """
+        Checks that assignment with settings rejected by builder is not saved
+        """
+        params = {
+            'uuid': self.create_uuid(),
+            'contest_id': contest_id,
+            'title': 'Rejected Problem',
+            'description': 'Has unknown checker',
+            'checker': 'unknown',
+        }
+        try:
+            self.post_json('assignment/create', params)
+        except RuntimeError:
+            pass
+        else:
+            raise RuntimeError('assignment with unknown checker created')
+        response = self.get_json('contest/{0}/assignments'.format(str(contest_id)))
+        assert 'Rejected Problem' not in [assignment['title'] for assignment in response]
+
+class RejudgeScenario(CreateScenario):
+    """
+    Checks that rejudge returns finished commits of the assignment and contest to builder
+    """
+    def run(self):
+        timestamp = int(time.time())
+        contest_id = self.create_contest('Rejudge Cup', timestamp, timestamp + 7200)
+        user_id = self.create_user('Test' + self.create_uuid(), self.create_uuid(), ['student'], contest_id)
+        assignment_id = self.create_assignment(self.create_uuid(), contest_id, 'A+B Problem', 'Solve A+B Problem')
+        self.create_test_case(self.create_uuid(), assignment_id, '1\n2\n', '3\n')
+        self.commit_solution(user_id, assignment_id)
+        self.wait_commits_finished(user_id, contest_id)
+
+        response = self.post_json('assignment/{0}/rejudge'.format(assignment_id), {})
+        print('rejudged assignment #{0}: {1}'.format(assignment_id, response))
+        assert response['rejudged'] == 1
+        self.wait_commits_finished(user_id, contest_id)
+
+        response = self.post_json('contest/{0}/rejudge'.format(contest_id), {})
+        print('rejudged contest #{0}: {1}'.format(contest_id, response))
+        assert response['rejudged'] == 1
+        assert response['rejudged_assignments'] == [assignment_id]
+        assert response['failed_assignments'] == []
+        self.wait_commits_finished(user_id, contest_id)
+
+    def commit_solution(self, user_id, assignment_id):
+        params = {
+            'uuid': self.create_uuid(),
+            'assignment_id': assignment_id,
+            'language': 'pascal',
+            'source': PASCAL_SOURCE
+        }
+        self.post_json('user/{0}/commit'.format(user_id), params)
+
+    def wait_commits_finished(self, user_id, contest_id):
+        for _ in range(0, 20):
+            solutions = self.get_json('user/{0}/contest/{1}/solutions'.format(user_id, contest_id))
+            if all(solution['build_status'] != 'pending' for solution in solutions):
+                assert [solution['build_status'] for solution in solutions] == ['succeed']
+                return
+            time.sleep(1)
+        raise RuntimeError('commits of contest #{0} are not judged'.format(contest_id))
+
 def main():
     run_test_scenarios([
         CreateScenario,
         LoginScenario,
         ViewAndCommitScenario,
+        RejudgeScenario,
     ])
 
 if __name__ == "__main__":
@@ -1,12 +1,17 @@
 #!/usr/bin/env python3
 
 from __future__ import print_function
+import hashlib
+import io
 import json
 import uuid
 import os
+import requests
 import time
+import zipfile
 
 from test_runner import TestScenario, run_test_scenarios
+from test_config_master import TEST_COMPILE_CACHE_DIR, TEST_BLOB_STORE_DIR, TEST_S3_ENDPOINT, test_blob_inline_limit_kb
 
 SCRIPT_DIR = os.path.dirname(os.path.realpath(__file__))
 BUILDER_API_URL = 'http://localhost:9092/api/v1/'
@@ -19,54 +24,212 @@ BEGIN
   WRITELN(a+b);
 END.
 """
+CPP_APLUSB_SOURCE = """#include <cstdio>
+int main() { int a, b; scanf("%d %d", &a, &b); printf("%d\\n", a + b); }
+"""
+CPP_VERDICT_SOURCES = [
+    ('AC', CPP_APLUSB_SOURCE),
+    ('TLE', 'int main() { volatile unsigned i = 0; for (;;) ++i; }'),
+    ('WTLE', '#include <unistd.h>\nint main() { sleep(100); }'),
+    ('MLE', '#include <cstring>\n#include <cstdlib>\nint main() { for (;;) { char *p = (char *)malloc(1 << 20); if (p) memset(p, 1, 1 << 20); } }'),
+    ('RE', '#include <cstdlib>\nint main() { abort(); }'),
+    ('OLE', '#include <cstdio>\nint main() { for (;;) puts("spam spam spam spam"); }'),
+]
+# CPP_SMALL_APLUSB_SOURCE - solution which fails tests with a > 100
+CPP_SMALL_APLUSB_SOURCE = """#include <cstdio>
+int main() { int a, b; scanf("%d %d", &a, &b); printf("%d\\n", a > 100 ? 0 : a + b); }
+"""
+# SCORING_GROUPS - test groups and expected results of CPP_SMALL_APLUSB_SOURCE:
+# "easy" passed, "medium" earns 3 of 4 weight units, "hard" failed, so dependent "bonus" earns nothing
+SCORING_GROUPS = [
+    ({'name': 'easy', 'points': 40, 'scoring': 'all'}, [(1, 2, 1), (5, 5, 1)], 40, True),
+    ({'name': 'medium', 'points': 60, 'scoring': 'sum', 'dependencies': ['easy']}, [(1, 1, 1), (200, 1, 1), (3, 4, 2)], 45, False),
+    ({'name': 'hard', 'points': 30, 'scoring': 'all'}, [(2, 3, 1), (300, 1, 1)], 0, False),
+    ({'name': 'bonus', 'points': 20, 'scoring': 'sum', 'dependencies': ['hard']}, [(2, 2, 1)], 0, False),
+]
+
+# CPP_WARNING_SOURCE, CPP_ERROR_SOURCE - sources with compiler warning on line 2 and error on line 5, column 12
+CPP_WARNING_SOURCE = """#include <cstdio>
+#warning diagnostics check
+int main() { int a, b; scanf("%d %d", &a, &b); printf("%d\\n", a + b); }
+"""
+CPP_ERROR_SOURCE = """#include <cstdio>
+#warning diagnostics check
+int main() {
+    int a = 1;
+    return undefined_name;
+}
+"""
+
+# CPP_BIG_SOURCE - solution with 600 KB executable, two of them do not fit into test compile cache
+CPP_BIG_SOURCE = """#include <cstdio>
+static char big[600 * 1024] = {1};
+int main() { int a, b; scanf("%d %d", &a, &b); printf("%d\\n", a + b + big[1]); }
+"""
+
+# CHECKER_CASES - checker settings, expected answer, accepted and rejected outputs
+CHECKER_CASES = [
+    ({'checker': 'float', 'checker_abs_epsilon': 1e-6}, '3.1415926\n', '3.1415930\n', '3.1416\n'),
+    ({'checker': 'float', 'checker_rel_epsilon': 1e-3}, '1000000 x\n', '1000500.0 x\n', '1002000 x\n'),
+    ({'checker': 'tokens'}, '1 2 3\n', '1\n2   3', '1 2 3 4\n'),
+    ({'checker': 'case_insensitive'}, 'YES\n', 'yes\n', 'no\n'),
+]
+
+# INTERPRETED_SOURCES - A+B solutions and sources with syntax error for interpreted languages
+INTERPRETED_SOURCES = {
+    'python3': ('a, b = map(int, open(0).read().split())\nprint(a + b)\n', 'print(1 +\n'),
+    'javascript': ('const [a, b] = require("fs").readFileSync(0, "utf8").split(/\\s+/).map(Number);\nconsole.log(a + b);\n', 'console.log(1 +;\n'),
+}
+
+# CPP_INTERACTOR_SOURCE - interactor which sends numbers from input file and accepts their sum,
+# exit codes follow testlib convention: 0 - accepted, 1 - wrong answer
+CPP_INTERACTOR_SOURCE = """#include <cstdio>
+int main(int argc, char *argv[]) {
+    FILE *input = fopen(argv[1], "r");
+    int a, b, sum;
+    if (!input || fscanf(input, "%d %d", &a, &b) != 2) return 3;
+    printf("%d %d\\n", a, b);
+    fflush(stdout);
+    if (scanf("%d", &sum) != 1 || sum != a + b) { fprintf(stderr, "wrong sum"); return 1; }
+    return 0;
+}
+"""
+# CPP_INTERACTIVE_SOURCES - solutions talking with CPP_INTERACTOR_SOURCE and their expected verdicts
+CPP_INTERACTIVE_SOURCES = [
+    ('AC', '#include <cstdio>\nint main() { int a, b; scanf("%d %d", &a, &b); printf("%d\\n", a + b); fflush(stdout); }\n'),
+    ('WA', '#include <cstdio>\nint main() { int a, b; scanf("%d %d", &a, &b); printf("%d\\n", a - b); fflush(stdout); }\n'),
+    ('TLE', '#include <cstdio>\nint main() { int a, b; scanf("%d %d", &a, &b); volatile unsigned i = 0; for (;;) ++i; }\n'),
+]
+
+def cpp_print_source(text):
+    """
+    Returns C++ solution which ignores input and prints given text
+    """
+    literal = text.replace('\\', '\\\\').replace('"', '\\"').replace('\n', '\\n')
+    return '#include <cstdio>\nint main() {{ fputs("{0}", stdout); }}\n'.format(literal)
+
+# APLUSB_ASSIGNMENT - settings of assignment used by scenarios unless they override some of them
+APLUSB_ASSIGNMENT = {
+    'time_limit_ms': 1000,
+    'memory_limit_mb': 64,
+    'output_limit_kb': 1024,
+    'stack_size_mb': 16,
+    'checker': 'tokens',
+}
 
 class BuilderTestScenario(TestScenario):
     def __init__(self):
         super().__init__(BUILDER_API_URL)
 
+    def register_assignment(self, **settings):
+        """
+        Registers assignment self.assignment_uuid with APLUSB_ASSIGNMENT settings updated by given ones
+        """
+        request = dict(APLUSB_ASSIGNMENT, uuid=self.assignment_uuid)
+        request.update(settings)
+        response = self.post_json('assignment/new', request)
+        print('registered assignment ' + self.assignment_uuid)
+        assert response.get('uuid') == self.assignment_uuid
+
+    def register_test_case(self, input='1\n2\n', expected='3\n', **fields):
+        """
+        Registers test case for assignment self.assignment_uuid, returns test case UUID
+        """
+        uuid = self.create_uuid()
+        request = {
+            'uuid': uuid,
+            'assignment_uuid': self.assignment_uuid,
+            'input': input,
+            'expected': expected,
+        }
+        request.update(fields)
+        response = self.post_json('testcase/new', request)
+        print('registered test case ' + uuid)
+        assert response.get('uuid') == uuid
+        return uuid
+
 class RegisterBuildScenario(BuilderTestScenario):
     def __init__(self):
         super().__init__()
         self.assignment_uuid = self.create_uuid()
 
     def run(self):
-        self.register_test_case()
+        self.check_languages()
+        self.register_assignment()
+        test_uuid = self.register_test_case()
+        self.update_test_case(test_uuid)
+        self.check_test_set(test_uuid)
         build_uuid = self.register_new_build()
+        self.wait_build_finished(build_uuid)
+        report = self.get_build_report(build_uuid)
+        print('build {0} report:\n{1}'.format(build_uuid, json.dumps(report, indent=2)))
+        self.rejudge_build(build_uuid)
+        self.wait_build_finished(build_uuid)
+        report = self.get_build_report(build_uuid)
+        reports = self.get_build_reports(build_uuid)
+        assert [r['version'] for r in reports] == [1, 2]
+        assert [r['attempts'] for r in reports] == [1, 1]
+        assert report['version'] == 2
+        self.register_test_case()
+        sample_build_uuid = self.register_new_build('samples_only')
+        self.wait_build_finished(sample_build_uuid)
+        report = self.get_build_report(sample_build_uuid)
+        assert report['mode'] == 'samples_only'
+        assert report['tests_total'] == 1
+
+    def wait_build_finished(self, build_uuid):
         for _ in range(0, 20):
             response = self.get_build_status(build_uuid)
-            if response["status"] != "pending":
+            if response["status"] not in ["pending", "building"]:
                 break
             time.sleep(1.0)
         else:
             raise RuntimeError('build timeout exceed')
         print('build {0} finished'.format(build_uuid))
-        report = self.get_build_report(build_uuid)
-        print('build {0} report:\n{1}'.format(build_uuid, json.dumps(report, indent=2)))
 
-    def register_new_build(self):
+    def rejudge_build(self, uuid):
+        response = self.post_json('build/{0}/rejudge'.format(uuid), {})
+        print('rejudged build ' + uuid)
+        assert response.get('rejudged') == 1
+
+    def register_new_build(self, mode='full', language='pascal', source=PASCAL_SOURCE):
         uuid = self.create_uuid()
         response = self.post_json('build/new', {
             'uuid': uuid,
             'assignment_uuid': self.assignment_uuid,
-            'language': "pascal",
-            'source': PASCAL_SOURCE,
+            'language': language,
+            'source': source,
+            'priority': 'contest',
+            'mode': mode,
         })
         print('registered build ' + uuid)
         assert response.get('uuid') == uuid
         return uuid
 
-    def register_test_case(self):
-        uuid = self.create_uuid()
-        request = {
-            'uuid': uuid,
-            'assignment_uuid': self.assignment_uuid,
-            'input': '1\n2\n',
-            'expected': '3\n',
-        }
-        response = self.post_json('testcase/new', request)
-        print('registered test case ' + uuid)
-        assert response.get('uuid') == uuid
-        return uuid
+    def check_languages(self):
+        response = self.get_json('languages')
+        assert isinstance(response, list)
+        ids = [language['id'] for language in response]
+        print('builder languages: ' + ', '.join(ids))
+        assert 'pascal' in ids
+
+    def update_test_case(self, uuid):
+        response = self.post_json('testcase/{0}/update'.format(uuid), {
+            'input': '2\n2\n',
+            'expected': '4\n',
+            'sample': True,
+        })
+        print('updated test case ' + uuid)
+        assert response.get('testset_revision') == 2
+
+    def check_test_set(self, test_uuid):
+        response = self.get_json('assignment/{0}/testset'.format(self.assignment_uuid))
+        assert response.get('revision') == 2
+        assert [test['uuid'] for test in response['tests']] == [test_uuid]
+        assert response['tests'][0]['expected'] == '4\n'
+        assert response['tests'][0]['sample']
+        response = self.get_json('assignment/{0}/testset/1'.format(self.assignment_uuid))
+        assert response['tests'][0]['expected'] == '3\n'
 
     def get_build_status(self, uuid):
         response = self.get_json('build/status/' + uuid)
@@ -75,15 +238,319 @@ class RegisterBuildScenario(BuilderTestScenario):
         assert response.get('status') != ''
         return response
 
+    def get_build_reports(self, uuid):
+        response = self.get_json('build/{0}/reports'.format(uuid))
+        print('got report history for build ' + uuid)
+        assert isinstance(response, list)
+        for report in response:
+            assert report.get('uuid') == uuid
+            assert isinstance(report.get('created_at'), int)
+            assert report.get('testset_revision') >= 1
+        return response
+
     def get_build_report(self, uuid):
         response = self.get_json('build/report/' + uuid)
         print('got report for build ' + uuid)
         assert response.get('uuid') == uuid
+        assert isinstance(response.get('tests'), list)
+        assert response.get('attempts') >= 1
+        assert isinstance(response.get('diagnostics'), list)
+        for diagnostic in response['diagnostics']:
+            assert diagnostic['severity'] in ['error', 'warning', 'note']
+            assert isinstance(diagnostic['line'], int)
+        for test in response['tests']:
+            assert test['verdict'] in ['AC', 'WA', 'TLE', 'WTLE', 'MLE', 'RE', 'OLE', 'NOF']
+            assert test['limit_exceeded'] in ['', 'cpu', 'wall', 'memory', 'output']
+            assert isinstance(test['message'], str)
+            assert isinstance(test['wall_time_ms'], int)
+            assert isinstance(test['cpu_time_ms'], int)
+            assert isinstance(test['memory_kb'], int)
         return response
 
+class ImportTestSetScenario(BuilderTestScenario):
+    def __init__(self):
+        super().__init__()
+        self.assignment_uuid = self.create_uuid()
+
+    def run(self):
+        self.register_assignment()
+        archive = io.BytesIO()
+        with zipfile.ZipFile(archive, 'w') as zip_file:
+            for number in range(1, 12):
+                zip_file.writestr('tests/{0:02d}'.format(number), '{0}\n{0}\n'.format(number))
+                zip_file.writestr('tests/{0:02d}.a'.format(number), '{0}\n'.format(2 * number))
+        response = self.post_body('assignment/{0}/testset/import'.format(self.assignment_uuid),
+                                  archive.getvalue(), 'application/zip')
+        print('imported test set for assignment ' + self.assignment_uuid)
+        assert response.get('tests') == 11
+        assert not response.get('checker_updated')
+        response = self.get_json('assignment/{0}/testset'.format(self.assignment_uuid))
+        assert len(response['tests']) == 11
+        assert response['tests'][10]['expected'] == '22\n'
+
+class SandboxVerdictsScenario(RegisterBuildScenario):
+    """
+    Runs solutions in the sandbox configured for test builder (namespaces runner)
+    and checks verdict of each kind of failure
+    """
+    def run(self):
+        self.register_assignment(output_limit_kb=64)
+        self.register_test_case()
+        builds = []
+        for verdict, source in CPP_VERDICT_SOURCES:
+            builds.append((verdict, self.register_new_build(language='c++', source=source)))
+        for verdict, build_uuid in builds:
+            self.wait_build_finished(build_uuid)
+            report = self.get_build_report(build_uuid)
+            print('expected {0}, got {1}'.format(verdict, report['tests'][0]['verdict']))
+            assert report['tests'][0]['verdict'] == verdict
+
+class CheckerKindsScenario(RegisterBuildScenario):
+    """
+    Checks that each built-in checker accepts output within its tolerance and rejects other output
+    """
+    def run(self):
+        builds = []
+        for settings, expected, accepted, rejected in CHECKER_CASES:
+            self.assignment_uuid = self.create_uuid()
+            self.register_assignment(**settings)
+            self.register_test_case('\n', expected)
+            for verdict, output in [('AC', accepted), ('WA', rejected)]:
+                build_uuid = self.register_new_build(language='c++', source=cpp_print_source(output))
+                builds.append((settings['checker'], verdict, build_uuid))
+        for checker, verdict, build_uuid in builds:
+            self.wait_build_finished(build_uuid)
+            report = self.get_build_report(build_uuid)
+            print('{0} checker: expected {1}, got {2}'.format(checker, verdict, report['tests'][0]['verdict']))
+            assert report['tests'][0]['verdict'] == verdict
+
+class GroupScoringScenario(RegisterBuildScenario):
+    """
+    Checks scores of test groups with "all" and "sum" scoring and dependencies
+    """
+    def run(self):
+        self.register_assignment()
+        for group, tests, _, _ in SCORING_GROUPS:
+            for a, b, weight in tests:
+                self.register_test_case('{0}\n{1}\n'.format(a, b), '{0}\n'.format(a + b), group=group['name'], weight=weight)
+        response = self.post_json('assignment/{0}/groups'.format(self.assignment_uuid), {
+            'groups': [group for group, _, _, _ in SCORING_GROUPS],
+        })
+        assert response.get('uuid') == self.assignment_uuid
+        build_uuid = self.register_new_build(language='c++', source=CPP_SMALL_APLUSB_SOURCE)
+        self.wait_build_finished(build_uuid)
+        report = self.get_build_report(build_uuid)
+        assert report['tests_passed'] == 6
+        assert report['tests_total'] == 8
+        groups = report['groups']
+        print('group results:\n{0}'.format(json.dumps(groups, indent=2)))
+        assert [group['name'] for group in groups] == [group['name'] for group, _, _, _ in SCORING_GROUPS]
+        for result, (group, tests, score, passed) in zip(groups, SCORING_GROUPS):
+            assert result['points'] == group['points']
+            assert result['tests_total'] == len(tests)
+            assert abs(result['score'] - score) < 1e-9
+            assert result['passed'] == passed
+
+class DiagnosticsScenario(RegisterBuildScenario):
+    """
+    Checks compiler messages parsed into report diagnostics for failed and succeed compilation
+    """
+    def run(self):
+        self.register_assignment()
+        self.register_test_case()
+        warning_build_uuid = self.register_new_build(language='c++', source=CPP_WARNING_SOURCE)
+        error_build_uuid = self.register_new_build(language='c++', source=CPP_ERROR_SOURCE)
+
+        self.wait_build_finished(warning_build_uuid)
+        report = self.get_build_report(warning_build_uuid)
+        assert report['status'] == 'succeed'
+        assert [self.describe(d) for d in report['diagnostics']] == [('solution.cpp', 2, 'warning')]
+
+        self.wait_build_finished(error_build_uuid)
+        report = self.get_build_report(error_build_uuid)
+        print('diagnostics:\n{0}'.format(json.dumps(report['diagnostics'], indent=2)))
+        assert report['status'] == 'failed'
+        assert [self.describe(d) for d in report['diagnostics']] == [('solution.cpp', 2, 'warning'), ('solution.cpp', 5, 'error')]
+        error = report['diagnostics'][1]
+        assert error['column'] == 12
+        assert 'undefined_name' in error['message']
+
+    def describe(self, diagnostic):
+        return (diagnostic['file'], diagnostic['line'], diagnostic['severity'])
+
+class CompileCacheScenario(RegisterBuildScenario):
+    """
+    Checks compile cache of the test builder: resubmitted source reuses cached executable,
+    changed source gets its own entry, least recently used entry is evicted when cache exceeds its size
+    """
+    def run(self):
+        self.register_assignment()
+        self.register_test_case()
+        # Unique comment makes sources which were never cached before.
+        source = '{0}// {1}\n'.format(CPP_APLUSB_SOURCE, self.create_uuid())
+        key = self.build_new_entry(source)
+        used_at = os.path.getmtime(os.path.join(TEST_COMPILE_CACHE_DIR, key))
+        time.sleep(1.1)
+        entries = self.list_entries()
+        self.build_accepted(source)
+        assert self.list_entries() == entries
+        assert os.path.getmtime(os.path.join(TEST_COMPILE_CACHE_DIR, key)) > used_at
+        print('resubmitted source reused cache entry ' + key)
+
+        changed_key = self.build_new_entry(source + '// changed\n')
+        assert changed_key != key
+
+        first_key = self.build_new_entry('{0}// {1}\n'.format(CPP_BIG_SOURCE, self.create_uuid()))
+        second_key = self.build_new_entry('{0}// {1}\n'.format(CPP_BIG_SOURCE, self.create_uuid()))
+        entries = self.list_entries()
+        assert second_key in entries
+        assert first_key not in entries
+        print('cache entry {0} evicted'.format(first_key))
+
+    def build_new_entry(self, source):
+        entries = self.list_entries()
+        self.build_accepted(source)
+        added = self.list_entries() - entries
+        assert len(added) == 1
+        return added.pop()
+
+    def build_accepted(self, source):
+        build_uuid = self.register_new_build(language='c++', source=source)
+        self.wait_build_finished(build_uuid)
+        report = self.get_build_report(build_uuid)
+        assert report['tests'][0]['verdict'] == 'AC'
+
+    def list_entries(self):
+        return set(name for name in os.listdir(TEST_COMPILE_CACHE_DIR) if len(name) == 64)
+
+class BlobStoreScenario(RegisterBuildScenario):
+    """
+    Checks that tests and sources up to inline limit are kept in database and larger ones are kept in blob store.
+    With S3 blob store test blobs are removed from builder cache before build, so builder downloads them from S3.
+    """
+    def run(self):
+        self.register_assignment()
+        inline_limit = test_blob_inline_limit_kb * 1024
+        inline_input = '1\n2\n'.ljust(inline_limit)
+        blob_input = '3\n4\n'.ljust(inline_limit + 1)
+        blob_expected = '7\n'.ljust(inline_limit + 1, '\n')
+        inline_uuid = self.register_test_case(inline_input, '3\n')
+        blob_uuid = self.register_test_case(blob_input, blob_expected)
+
+        response = self.get_json('assignment/{0}/testset'.format(self.assignment_uuid))
+        tests = dict((test['uuid'], test) for test in response['tests'])
+        assert tests[inline_uuid]['input'] == inline_input
+        assert tests[inline_uuid]['input_hash'] == ''
+        assert tests[inline_uuid]['expected_hash'] == ''
+        assert tests[blob_uuid]['input'] == ''
+        assert tests[blob_uuid]['expected'] == ''
+        assert tests[blob_uuid]['input_hash'] == self.get_hash(blob_input)
+        assert tests[blob_uuid]['expected_hash'] == self.get_hash(blob_expected)
+
+        for hash in [self.get_hash(blob_input), self.get_hash(blob_expected)]:
+            assert os.path.exists(self.get_blob_path(hash))
+            if TEST_S3_ENDPOINT:
+                os.remove(self.get_blob_path(hash))
+        if TEST_S3_ENDPOINT:
+            print('removed test blobs from builder cache, they will be loaded from ' + TEST_S3_ENDPOINT)
+
+        source = CPP_APLUSB_SOURCE + '// {0}\n'.format(self.create_uuid()).ljust(inline_limit, '/')
+        build_uuid = self.register_new_build(language='c++', source=source)
+        assert os.path.exists(self.get_blob_path(self.get_hash(source)))
+        self.wait_build_finished(build_uuid)
+        report = self.get_build_report(build_uuid)
+        assert report['status'] == 'succeed'
+        assert [test['verdict'] for test in report['tests']] == ['AC', 'AC']
+
+    def get_hash(self, content):
+        return hashlib.sha256(content.encode('utf-8')).hexdigest()
+
+    def get_blob_path(self, hash):
+        return os.path.join(TEST_BLOB_STORE_DIR, hash[:2], hash[2:])
+
+class InterpretedLanguagesScenario(RegisterBuildScenario):
+    """
+    Checks that interpreted languages enabled on builder run solutions and report syntax errors as failed build
+    """
+    def run(self):
+        self.register_assignment()
+        self.register_test_case()
+        enabled = [language['id'] for language in self.get_json('languages')]
+        for language, (source, invalid_source) in INTERPRETED_SOURCES.items():
+            if language not in enabled:
+                print('language {0} is not enabled on builder, skipped'.format(language))
+                continue
+            build_uuid = self.register_new_build(language=language, source=source)
+            invalid_build_uuid = self.register_new_build(language=language, source=invalid_source)
+            self.wait_build_finished(build_uuid)
+            report = self.get_build_report(build_uuid)
+            assert [test['verdict'] for test in report['tests']] == ['AC']
+            self.wait_build_finished(invalid_build_uuid)
+            report = self.get_build_report(invalid_build_uuid)
+            assert report['status'] == 'failed'
+            assert report['tests'] == []
+
+class FileIOScenario(RegisterBuildScenario):
+    def run(self):
+        self.register_assignment(io_mode='file', input_file='aplusb.in', output_file='aplusb.out')
+        self.register_test_case()
+        # Solution writes answer to stdout, but assignment expects it in output file.
+        build_uuid = self.register_new_build()
+        self.wait_build_finished(build_uuid)
+        report = self.get_build_report(build_uuid)
+        assert report['tests'][0]['verdict'] == 'NOF'
+
+class InteractiveScenario(RegisterBuildScenario):
+    """
+    Checks that solutions of interactive assignment get verdict from interactor or solution limits
+    """
+    def run(self):
+        self.register_assignment(checker='interactor', checker_source=CPP_INTERACTOR_SOURCE, checker_language='c++')
+        self.register_test_case('1 2\n', '3\n')
+        builds = []
+        for verdict, source in CPP_INTERACTIVE_SOURCES:
+            builds.append((verdict, self.register_new_build(language='c++', source=source)))
+        for verdict, build_uuid in builds:
+            self.wait_build_finished(build_uuid)
+            report = self.get_build_report(build_uuid)
+            print('expected {0}, got {1}'.format(verdict, report['tests'][0]['verdict']))
+            assert report['tests'][0]['verdict'] == verdict
+
+class UnknownAssignmentScenario(BuilderTestScenario):
+    """
+    Checks that requests for assignment or build which was never registered do not create it
+    """
+    def run(self):
+        assignment_uuid = self.create_uuid()
+        self.check_not_found('assignment/{0}/rejudge'.format(assignment_uuid))
+        self.check_get_not_found('assignment/{0}/testset'.format(assignment_uuid))
+        self.check_not_found('assignment/{0}/rejudge'.format(assignment_uuid))
+        self.check_not_found('build/{0}/rejudge'.format(self.create_uuid()))
+
+    def check_not_found(self, method):
+        response = requests.post(self.api_url + method, '{}', headers={'Content-Type': 'application/json'})
+        print('  call {0}: status {1}'.format(method, response.status_code))
+        assert response.status_code == 404
+
+    def check_get_not_found(self, query):
+        response = requests.get(self.api_url + query)
+        print('  get {0}: status {1}'.format(query, response.status_code))
+        assert response.status_code == 404
+
 def main():
     run_test_scenarios([
-        RegisterBuildScenario
+        RegisterBuildScenario,
+        ImportTestSetScenario,
+        SandboxVerdictsScenario,
+        CheckerKindsScenario,
+        GroupScoringScenario,
+        DiagnosticsScenario,
+        CompileCacheScenario,
+        BlobStoreScenario,
+        InterpretedLanguagesScenario,
+        FileIOScenario,
+        InteractiveScenario,
+        UnknownAssignmentScenario,
     ])
 
 if __name__ == "__main__":
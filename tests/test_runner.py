@@ -9,11 +9,14 @@ class TestScenario:
         self.api_url = str(api_url)
 
     def post_json(self, method, request_dict):
+        data = json.dumps(request_dict, indent=2)
+        return self.post_body(method, data, 'application/json')
+
+    def post_body(self, method, data, content_type):
         print("  call {0}".format(method))
         url = self.api_url+ method
-        data = json.dumps(request_dict, indent=2)
         headers = {
-            'Content-Type': 'application/json'
+            'Content-Type': content_type
         }
         response = requests.post(url, data, headers=headers)
         if len(response.text) == 0: